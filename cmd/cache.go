@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/paths"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+const cacheUsage = `Usage: toshi cache clear
+       toshi cache info`
+
+// openCache returns the HTTP cache in the toshi cache directory.
+func openCache() (*scraper.Cache, error) {
+	dir, err := paths.CacheSubdir("http")
+	if err != nil {
+		return nil, err
+	}
+	return scraper.NewCache(dir)
+}
+
+// runCache clears or describes the HTTP cache.
+func runCache(s lib.Catalog, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		os.Exit(1)
+	}
+
+	cache, err := openCache()
+	if err != nil {
+		logger.Errorf("Error opening cache: %v", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "clear":
+		if err := cache.Clear(); err != nil {
+			logger.Errorf("Error clearing cache: %v", err)
+			os.Exit(1)
+		}
+		fmt.Println("Cache cleared.")
+	case "info":
+		entries, size, err := cache.Stats()
+		if err != nil {
+			logger.Errorf("Error reading cache: %v", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Directory: %s\n", cache.Dir)
+		fmt.Printf("Pages:     %d\n", entries)
+		fmt.Printf("Size:      %.1f MB of %d MB\n", float64(size)/(1<<20), cache.MaxBytes>>20)
+	default:
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+// Interactive interfaces selectable with --ui.
+const (
+	uiAuto = "auto"
+	uiTUI  = "tui"
+	uiCLI  = "cli"
+
+	// uiPicker pipes results to an external fuzzy finder.
+	uiPicker = "picker"
+)
+
+// options holds the search term and flags of a search invocation.
+type options struct {
+	term    string
+	verbose bool
+	format  string
+	sort    string
+	group   bool
+	ui      string
+	table   bool
+	color   string
+	theme   string
+
+	extensions    string
+	languages     string
+	years         string
+	maxSize       string
+	minPages      int
+	excludeAuthor string
+	publisher     string
+}
+
+// parseArgs returns the options of the search command, exiting on invalid input.
+func parseArgs(args []string) options {
+	if len(args) == 0 {
+		printUsageAndExit()
+	}
+
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.term == "" {
+		fmt.Fprintln(os.Stderr, "Error: No search term provided.")
+		os.Exit(1)
+	}
+
+	return opts
+}
+
+// parseFlags parses flags and search terms, which may be given in any order.
+func parseFlags(args []string) (options, error) {
+	var opts options
+
+	fs := flag.NewFlagSet("toshi", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.verbose, "v", false, "")
+	fs.StringVar(&opts.format, "format", "", "")
+	fs.StringVar(&opts.sort, "sort", lib.SortRelevance, "")
+	fs.BoolVar(&opts.group, "group", true, "")
+	fs.StringVar(&opts.ui, "ui", uiAuto, "")
+	fs.BoolVar(&opts.table, "table", false, "")
+	fs.StringVar(&opts.color, "color", ui.ColorAuto, "")
+	fs.StringVar(&opts.theme, "theme", defaultTheme(), "")
+	fs.StringVar(&opts.extensions, "ext", "epub", "")
+	fs.StringVar(&opts.extensions, "formats", "epub", "")
+	fs.StringVar(&opts.languages, "lang", "", "")
+	fs.StringVar(&opts.years, "year", "", "")
+	fs.StringVar(&opts.maxSize, "max-size", "", "")
+	fs.IntVar(&opts.minPages, "min-pages", 0, "")
+	fs.StringVar(&opts.excludeAuthor, "exclude-author", "", "")
+	fs.StringVar(&opts.publisher, "publisher", "", "")
+
+	var terms []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return options{}, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		terms = append(terms, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	opts.term = strings.Join(terms, " ")
+
+	if opts.format != "" && opts.format != ui.FormatText && opts.format != ui.FormatJSON {
+		return options{}, fmt.Errorf("invalid format %q, expected %s or %s", opts.format, ui.FormatText, ui.FormatJSON)
+	}
+
+	if !slices.Contains([]string{uiAuto, uiTUI, uiCLI, uiPicker}, opts.ui) {
+		return options{}, fmt.Errorf("invalid ui %q, expected %s, %s, %s or %s", opts.ui, uiAuto, uiTUI, uiCLI, uiPicker)
+	}
+
+	if !slices.Contains([]string{ui.ColorAuto, ui.ColorAlways, ui.ColorNever}, opts.color) {
+		return options{}, fmt.Errorf("invalid color %q, expected %s, %s or %s", opts.color, ui.ColorAuto, ui.ColorAlways, ui.ColorNever)
+	}
+
+	if _, ok := ui.Themes[opts.theme]; !ok {
+		return options{}, fmt.Errorf("invalid theme %q, expected one of %s", opts.theme, strings.Join(ui.ThemeNames(), ", "))
+	}
+
+	if !slices.Contains(lib.SortKeys, opts.sort) {
+		return options{}, fmt.Errorf("invalid sort %q, expected one of %s", opts.sort, strings.Join(lib.SortKeys, ", "))
+	}
+
+	return opts, nil
+}
+
+// optionArgs returns a command line for opts: the search term followed by
+// the search flags that differ from their defaults.
+func optionArgs(opts options) []string {
+	defaults, _ := parseFlags(nil)
+	args := strings.Fields(opts.term)
+	add := func(name, value, def string) {
+		if value != def {
+			args = append(args, "--"+name, value)
+		}
+	}
+
+	add("sort", opts.sort, defaults.sort)
+	add("ext", opts.extensions, defaults.extensions)
+	add("lang", opts.languages, defaults.languages)
+	add("year", opts.years, defaults.years)
+	add("max-size", opts.maxSize, defaults.maxSize)
+	add("min-pages", strconv.Itoa(opts.minPages), strconv.Itoa(defaults.minPages))
+	add("exclude-author", opts.excludeAuthor, defaults.excludeAuthor)
+	add("publisher", opts.publisher, defaults.publisher)
+	return args
+}
+
+// flagSummary returns the non-default search flags of a recorded command
+// line, or an empty string if there are none or it cannot be parsed.
+func flagSummary(args []string) string {
+	opts, err := parseFlags(args)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(optionArgs(opts)[len(strings.Fields(opts.term)):], " ")
+}
+
+// defaultTheme returns the theme named by TOSHI_THEME, or "dark".
+func defaultTheme() string {
+	if name := os.Getenv("TOSHI_THEME"); name != "" {
+		return name
+	}
+	return "dark"
+}
+
+// searchOptions converts the filter and sort flags into lib search options.
+func searchOptions(opts options) (lib.SearchOptions, error) {
+	filters, err := buildFilters(opts)
+	if err != nil {
+		return lib.SearchOptions{}, err
+	}
+
+	languages, err := lib.ParseLanguages(splitList(opts.languages))
+	if err != nil {
+		return lib.SearchOptions{}, err
+	}
+	prefs := lib.Preferences{Languages: languages}
+	if exts := splitList(opts.extensions); len(exts) > 0 && exts[0] != "all" {
+		prefs.Formats = exts
+	}
+
+	return lib.SearchOptions{Filters: filters, Sort: opts.sort, Preferences: prefs}, nil
+}
+
+// buildFilters converts the filter flags into lib filters.
+func buildFilters(opts options) ([]lib.Filter, error) {
+	var filters []lib.Filter
+
+	if exts := splitList(opts.extensions); len(exts) > 0 && exts[0] != "all" {
+		filters = append(filters, lib.ByExtension(exts...))
+	}
+	if langs := splitList(opts.languages); len(langs) > 0 {
+		codes, err := lib.ParseLanguages(langs)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, lib.ByLanguage(codes...))
+	}
+	if opts.years != "" {
+		min, max, err := lib.ParseYearRange(opts.years)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, lib.ByYearRange(min, max))
+	}
+	if opts.maxSize != "" {
+		size, err := lib.ParseSize(opts.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, lib.ByMaxSize(size))
+	}
+	if opts.minPages > 0 {
+		filters = append(filters, lib.ByMinPages(opts.minPages))
+	}
+	if authors := splitList(opts.excludeAuthor); len(authors) > 0 {
+		filters = append(filters, lib.ExcludeAuthors(authors...))
+	}
+	if publishers := splitList(opts.publisher); len(publishers) > 0 {
+		filters = append(filters, lib.ByPublisher(publishers...))
+	}
+
+	return filters, nil
+}
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func printUsageAndExit() {
+	fmt.Fprintf(os.Stderr, `Usage: toshi <searchterm> [options]
+       toshi doctor [searchterm]
+       toshi shell [searchterm] [options]
+       toshi info <id|md5> [--format text|json]
+       toshi show [number ...] [--format text|json]
+       toshi get <number> ...
+       toshi history [rerun|redownload <number>]
+       toshi wish add|list|remove|sync
+       toshi watch add|list|remove|run
+       toshi cache clear|info
+Example: toshi The Iliad Homer --lang en --year 1990..2010
+Commands:
+  doctor  Check the site layout and print a diagnostic report
+  shell   Search, refine and download interactively; type 'help' inside
+  info    Show a book's description, series, identifiers and cover
+  show    List the results of the last search, or the numbered ones
+  get     Download books from the last search by number
+  history List past searches and downloads, or repeat one by number
+  wish    Keep searches to retry later and download confident matches
+  watch   Rerun saved searches and report books that were not there before
+  cache   Remove or describe the cached pages
+Options:
+  -v                       Enable verbose output with debug logs
+  --no-cache               Fetch every page from the site, for any command
+  --source name,name       Sources from sources.json to search (default
+                           $TOSHI_SOURCE or all of them)
+  --record dir             Save every request and response in dir
+  --replay dir             Answer requests from a recording in dir instead
+                           of the network
+  --format text|json       Print results instead of selecting interactively
+  --sort key               Order results by relevance (default), year, title,
+                           size, pages or none (site order)
+  --group=false            List every edition instead of grouping by work
+                           (plain interface only)
+  --table                  List one book per line (plain interface only)
+  --ui auto|tui|cli|picker Full-screen, plain line or external picker
+                           interface; auto uses $TOSHI_PICKER if set, else
+                           the full-screen one on a terminal (default auto)
+  --color auto|always|never
+                           Color output; auto disables it when stdout is not
+                           a terminal, NO_COLOR is set or TERM=dumb
+  --theme dark|light       Color palette (default $TOSHI_THEME or dark)
+  --ext epub,pdf           Formats to show, or "all" (default "epub");
+                           --formats is an alias
+  --lang en,de             Languages to show (ISO 639 codes or names)
+  --year 1990..2010        Publication years to show, either bound optional
+  --max-size 50MB          Largest file size to show
+  --min-pages 100          Smallest page count to show
+  --exclude-author names   Hide books by these authors
+  --publisher names        Show only books from these publishers
+`)
+	os.Exit(1)
+}
+
+// selectUI returns the interactive interface chosen by the --ui flag.
+func selectUI(s lib.Catalog, opts options, searchOpts lib.SearchOptions) lib.UI {
+	picker := ui.Picker{Command: ui.PickerCommand()}
+	if opts.ui == uiPicker || opts.ui == uiAuto && os.Getenv("TOSHI_PICKER") != "" && picker.Available() {
+		return picker
+	}
+
+	details := func(b lib.Book) (*lib.Details, error) { return lib.BookDetails(s, b) }
+	cli := ui.CLI{Group: opts.group, Table: opts.table, Details: details}
+	tui := ui.TUI{Query: opts.term, Sort: opts.sort, Preferences: searchOpts.Preferences, Fallback: cli}
+	if opts.ui == uiTUI || opts.ui == uiAuto && tui.Available() {
+		return tui
+	}
+	return cli
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+func TestParseFlags_Interspersed(t *testing.T) {
+	opts, err := parseFlags([]string{"The", "--lang", "en,de", "Iliad", "--year=1990..2010", "Homer", "--format", "json"})
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+	if opts.term != "The Iliad Homer" {
+		t.Fatalf("term = %q, want %q", opts.term, "The Iliad Homer")
+	}
+	if opts.languages != "en,de" || opts.years != "1990..2010" || opts.format != "json" {
+		t.Fatalf("unexpected options: %#v", opts)
+	}
+	if opts.extensions != "epub" {
+		t.Fatalf("extensions = %q, want epub default", opts.extensions)
+	}
+}
+
+func TestParseFlags_Invalid(t *testing.T) {
+	if _, err := parseFlags([]string{"Iliad", "--bogus"}); err == nil {
+		t.Fatal("expected error for unknown flag")
+	}
+	if _, err := parseFlags([]string{"Iliad", "--format", "xml"}); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
+
+func TestBuildFilters(t *testing.T) {
+	opts, err := parseFlags([]string{"x", "--ext", "all", "--lang", "en", "--max-size", "10MB", "--min-pages", "100"})
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+	filters, err := buildFilters(opts)
+	if err != nil {
+		t.Fatalf("buildFilters error = %v", err)
+	}
+	books := []lib.Book{
+		{Title: "keep", Extension: "pdf", Meta: lib.Metadata{Language: "en", Pages: 200, SizeBytes: 1 << 20}},
+		{Title: "too-big", Extension: "epub", Meta: lib.Metadata{Language: "en", Pages: 200, SizeBytes: 20 << 20}},
+		{Title: "german", Extension: "epub", Meta: lib.Metadata{Language: "de", Pages: 200}},
+	}
+	got := lib.ApplyFilters(books, filters...)
+	if len(got) != 1 || got[0].Title != "keep" {
+		t.Fatalf("unexpected filtered books: %#v", got)
+	}
+
+	opts.years = "later"
+	if _, err := buildFilters(opts); err == nil {
+		t.Fatal("expected error for invalid year range")
+	}
+
+	opts.years = ""
+	opts.languages = "klingon"
+	if _, err := buildFilters(opts); err == nil {
+		t.Fatal("expected error for unknown language")
+	}
+}
+
+func TestBuildFilters_LanguageNames(t *testing.T) {
+	opts, err := parseFlags([]string{"x", "--lang", "english"})
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+	filters, err := buildFilters(opts)
+	if err != nil {
+		t.Fatalf("buildFilters error = %v", err)
+	}
+	books := []lib.Book{
+		{Title: "english", Extension: "epub", Meta: lib.Metadata{Language: "en"}},
+		{Title: "german", Extension: "epub", Meta: lib.Metadata{Language: "de"}},
+	}
+	if got := lib.ApplyFilters(books, filters...); len(got) != 1 || got[0].Title != "english" {
+		t.Fatalf("unexpected filtered books: %#v", got)
+	}
+
+	searchOpts, err := searchOptions(opts)
+	if err != nil {
+		t.Fatalf("searchOptions error = %v", err)
+	}
+	if langs := searchOpts.Preferences.Languages; len(langs) != 1 || langs[0] != "en" {
+		t.Fatalf("preferred languages = %v, want [en]", langs)
+	}
+}
+
+func TestParseFlags_ColorAndTheme(t *testing.T) {
+	t.Setenv("TOSHI_THEME", "light")
+	opts, err := parseFlags([]string{"Iliad", "--color", "never"})
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+	if opts.color != "never" || opts.theme != "light" {
+		t.Fatalf("color = %q, theme = %q, want never and light", opts.color, opts.theme)
+	}
+
+	if _, err := parseFlags([]string{"Iliad", "--color", "sometimes"}); err == nil {
+		t.Fatal("expected error for unknown color mode")
+	}
+	if _, err := parseFlags([]string{"Iliad", "--theme", "solarized"}); err == nil {
+		t.Fatal("expected error for unknown theme")
+	}
+}
+
+func TestSelectUI_TUIFallsBackToConfiguredCLI(t *testing.T) {
+	opts, err := parseFlags([]string{"iliad", "--ui", "tui", "--table", "--group=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tui, ok := selectUI(nil, opts, lib.SearchOptions{}).(ui.TUI)
+	if !ok {
+		t.Fatal("selectUI() did not return the TUI")
+	}
+	if !tui.Fallback.Table || tui.Fallback.Group || tui.Fallback.Details == nil {
+		t.Fatalf("TUI fallback = %#v, want the configured CLI", tui.Fallback)
+	}
+}
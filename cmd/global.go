@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/scraper"
+
+	// Register the kinds of source beyond the default site.
+	_ "github.com/mfkd/toshi/internal/local"
+	_ "github.com/mfkd/toshi/internal/opds"
+)
+
+// globalOptions are the flags accepted by every command, anywhere on the
+// command line.
+type globalOptions struct {
+	noCache bool
+	// record and replay name a directory of recorded HTTP exchanges.
+	record string
+	replay string
+	// sources are the names of the sources to search, or all configured
+	// ones if empty.
+	sources []string
+}
+
+// parseGlobalFlags removes the global flags from args and returns them with
+// the remaining arguments.
+func parseGlobalFlags(args []string) ([]string, globalOptions, error) {
+	var g globalOptions
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") {
+			rest = append(rest, args[i])
+			continue
+		}
+
+		switch name {
+		case "no-cache":
+			g.noCache = true
+		case "record", "replay", "source":
+			if !hasValue {
+				if i+1 == len(args) {
+					return nil, g, fmt.Errorf("flag --%s needs a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			switch name {
+			case "record":
+				g.record = value
+			case "replay":
+				g.replay = value
+			case "source":
+				g.sources = splitList(value)
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	if g.sources == nil {
+		g.sources = splitList(os.Getenv("TOSHI_SOURCE"))
+	}
+	if g.record != "" && g.replay != "" {
+		return nil, g, errors.New("--record and --replay cannot be used together")
+	}
+	return rest, g, nil
+}
+
+// newSite returns the default site, reached through s with its pages
+// logged and spaced RequestDelay apart.
+func newSite(s *scraper.Scraper) *lib.Site {
+	return lib.NewSite(s.URL, s, scraper.Logging(), scraper.RateLimit(s.RequestDelay))
+}
+
+// openCatalog returns the sources selected by --source or TOSHI_SOURCE from
+// sources.json, sharing the default site's fetcher and downloader.
+func openCatalog(s *scraper.Scraper, g globalOptions) (lib.Catalog, error) {
+	configs, err := lib.LoadSourceConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if configs, err = lib.SelectSources(configs, g.sources); err != nil {
+		return nil, err
+	}
+
+	site := newSite(s)
+	c, err := lib.OpenCatalog(configs, lib.SourceDeps{Site: site, Pages: site.DocumentFetcher, Bodies: s, Files: site.FileDownloader})
+	if errors.Is(err, lib.ErrNoSiteURL) {
+		// Commands that do not search, such as 'toshi history', still work.
+		return missingCatalog{errNoDomain}, nil
+	}
+	return c, err
+}
+
+var errNoDomain = errors.New("no valid domain found: set the DOMAIN environment variable or add a valid domain to domains.txt")
+
+// missingCatalog stands in for a catalog that cannot be opened, failing
+// every use with err.
+type missingCatalog struct {
+	err error
+}
+
+func (m missingCatalog) Name() string { return lib.SiteSource }
+
+func (m missingCatalog) Search(ctx context.Context, term string) ([]lib.Book, error) {
+	return nil, m.err
+}
+
+func (m missingCatalog) Details(ctx context.Context, b lib.Book) (*lib.Details, error) {
+	return nil, m.err
+}
+
+func (m missingCatalog) ResolveDownloads(ctx context.Context, b lib.Book) ([]string, error) {
+	return nil, m.err
+}
+
+func (m missingCatalog) DownloadFile(ctx context.Context, filename, url, dir string) error {
+	return m.err
+}
+
+// requireSite returns the default site for commands that depend on its
+// layout, exiting if it is not among the selected sources.
+func requireSite(c lib.Catalog, command string) *lib.Site {
+	if m, ok := c.(missingCatalog); ok {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", m.err)
+		os.Exit(1)
+	}
+	site, ok := lib.SiteOf(c)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: toshi %s needs the %q source, which is not selected\n", command, lib.SiteSource)
+		os.Exit(1)
+	}
+	return site
+}
+
+// configureScraper applies the global options to s.
+func configureScraper(s *scraper.Scraper, g globalOptions) error {
+	if !g.noCache {
+		cache, err := openCache()
+		if err != nil {
+			logger.Debugf("HTTP cache disabled: %v\n", err)
+		}
+		s.Cache = cache
+	}
+
+	if g.record != "" {
+		if err := s.Record(g.record); err != nil {
+			return fmt.Errorf("cannot record to %s: %w", g.record, err)
+		}
+	}
+	if g.replay != "" {
+		if err := s.Replay(g.replay); err != nil {
+			return fmt.Errorf("cannot replay %s: %w", g.replay, err)
+		}
+	}
+	return nil
+}
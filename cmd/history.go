@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+const historyUsage = `Usage: toshi history [--format text|json]
+       toshi history rerun <number>
+       toshi history redownload <number>`
+
+// runHistory lists past searches and downloads, or repeats one of them.
+func runHistory(s lib.Catalog, args []string) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.verbose {
+		logger.Configure(logger.LevelDebug, nil)
+	}
+
+	entries, err := lib.LoadHistory()
+	if err != nil {
+		logger.Errorf("Error loading history: %v", err)
+		os.Exit(1)
+	}
+
+	fields := strings.Fields(opts.term)
+	if len(fields) == 0 {
+		format := opts.format
+		if format == "" {
+			format = ui.FormatText
+		}
+		if err := printHistory(os.Stdout, entries, format); err != nil {
+			logger.Errorf("Error printing history: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(fields) != 2 {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		os.Exit(1)
+	}
+	entry, err := historyEntry(entries, fields[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch fields[0] {
+	case "rerun":
+		rerun(s, entry)
+	case "redownload":
+		redownload(s, entry)
+	default:
+		fmt.Fprintln(os.Stderr, historyUsage)
+		os.Exit(1)
+	}
+}
+
+// historyEntry returns the entry numbered n, counting from 1.
+func historyEntry(entries []lib.HistoryEntry, n string) (lib.HistoryEntry, error) {
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 1 || i > len(entries) {
+		return lib.HistoryEntry{}, fmt.Errorf("no history entry numbered %q", n)
+	}
+	return entries[i-1], nil
+}
+
+// rerun runs a recorded search again with the same options.
+func rerun(s lib.Catalog, entry lib.HistoryEntry) {
+	if entry.Kind != lib.HistorySearch {
+		fmt.Fprintln(os.Stderr, "Error: only searches can be rerun, use 'redownload' for downloads")
+		os.Exit(1)
+	}
+
+	args := entry.Args
+	if len(args) == 0 {
+		args = strings.Fields(entry.Query)
+	}
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: recorded search cannot be parsed: %v\n", err)
+		os.Exit(1)
+	}
+
+	// On stderr, so that a search recorded with --format prints only results.
+	fmt.Fprintf(os.Stderr, "Searching again: toshi %s\n", strings.Join(args, " "))
+	runSearch(s, opts, args)
+}
+
+// redownload fetches the exact edition of a recorded download again. If its
+// mirrors no longer work, a book from the site is looked up by MD5 for fresh
+// ones.
+func redownload(s lib.Catalog, entry lib.HistoryEntry) {
+	if entry.Kind != lib.HistoryDownload || entry.Book == nil {
+		fmt.Fprintln(os.Stderr, "Error: only downloads can be redownloaded, use 'rerun' for searches")
+		os.Exit(1)
+	}
+
+	b := *entry.Book
+	fmt.Printf("Selected Book: %s\n", b.Title)
+	_, err := lib.DownloadBook(s, b, os.Stdout)
+	site, ok := lib.SiteOf(s)
+	if err != nil && b.MD5 != "" && ok && (b.Source == "" || b.Source == lib.SiteSource) {
+		logger.Infof("Recorded mirrors failed, looking up MD5 %s\n", b.MD5)
+		fresh, lookupErr := lib.FindBook(site, b.MD5)
+		if lookupErr == nil {
+			fresh.Source = b.Source
+			_, err = lib.DownloadBook(s, fresh, os.Stdout)
+		}
+	}
+	if err != nil {
+		logger.Errorf("Error downloading book: %v", err)
+		os.Exit(1)
+	}
+}
+
+// printHistory writes the history numbered from the oldest entry.
+func printHistory(w io.Writer, entries []lib.HistoryEntry, format string) error {
+	switch format {
+	case ui.FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if entries == nil {
+			entries = []lib.HistoryEntry{}
+		}
+		return enc.Encode(entries)
+	case ui.FormatText:
+		if len(entries) == 0 {
+			_, err := fmt.Fprintln(w, "No history yet.")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tTIME\tKIND\tQUERY / BOOK\tOUTCOME\tDETAILS")
+		for i, e := range entries {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				i+1, e.Started.Local().Format("2006-01-02 15:04"), e.Kind, e.Label(), e.Outcome, historyDetails(e))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// historyDetails summarizes the options, edition or error of an entry.
+func historyDetails(e lib.HistoryEntry) string {
+	if e.Error != "" {
+		return e.Error
+	}
+	switch e.Kind {
+	case lib.HistorySearch:
+		details := fmt.Sprintf("%d results", e.Results)
+		if flags := flagSummary(e.Args); flags != "" {
+			details += ", " + flags
+		}
+		return details
+	case lib.HistoryDownload:
+		id := "ID " + e.Book.ID
+		if e.Book.MD5 != "" {
+			id += ", MD5 " + e.Book.MD5
+		}
+		if e.File != "" {
+			id += ", " + e.File
+		}
+		return id
+	}
+	return ""
+}
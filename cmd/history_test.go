@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+func TestOptionArgs_RoundTrip(t *testing.T) {
+	args := []string{"The", "Iliad", "--lang", "en", "--year", "1990..", "--min-pages", "100", "--sort", "year"}
+	opts, err := parseFlags(args)
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+
+	got := optionArgs(opts)
+	again, err := parseFlags(got)
+	if err != nil {
+		t.Fatalf("parseFlags(%q) error = %v", got, err)
+	}
+	if again != opts {
+		t.Fatalf("round trip = %#v, want %#v", again, opts)
+	}
+
+	defaults, _ := parseFlags([]string{"Iliad"})
+	if got := optionArgs(defaults); !slices.Equal(got, []string{"Iliad"}) {
+		t.Fatalf("optionArgs(defaults) = %q, want only the term", got)
+	}
+}
+
+func TestPrintHistory(t *testing.T) {
+	book := &lib.Book{ID: "7", Title: "The Iliad", MD5: "abc"}
+	entries := []lib.HistoryEntry{
+		{Kind: lib.HistorySearch, Query: "iliad", Args: []string{"iliad", "--lang", "en"}, Results: 3, Outcome: lib.OutcomeOK},
+		{Kind: lib.HistoryDownload, Book: book, File: "/books/iliad.epub", Outcome: lib.OutcomeOK},
+		{Kind: lib.HistoryDownload, Book: book, Outcome: lib.OutcomeFailed, Error: "no download links available"},
+	}
+
+	var out bytes.Buffer
+	if err := printHistory(&out, entries, "text"); err != nil {
+		t.Fatalf("printHistory error = %v", err)
+	}
+	for _, want := range []string{"3 results, --lang en", "ID 7, MD5 abc, /books/iliad.epub", "failed", "no download links available"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("history output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := historyEntry(entries, "4"); err == nil {
+		t.Fatal("expected error for a number past the history")
+	}
+}
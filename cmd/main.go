@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mfkd/toshi/internal/embed"
 	"github.com/mfkd/toshi/internal/lib"
@@ -13,45 +15,6 @@ import (
 	"github.com/mfkd/toshi/internal/validate"
 )
 
-// parseArgs returns the search term and verbose flag
-func parseArgs() (string, bool) {
-	args := os.Args[1:]
-
-	if len(args) == 0 {
-		printUsageAndExit()
-	}
-
-	var searchTerms []string
-	verbose := false
-
-	for _, arg := range args {
-		if arg == "-v" {
-			verbose = true
-		} else if strings.HasPrefix(arg, "-") {
-			fmt.Fprintf(os.Stderr, "Invalid flag detected: %s\n", arg)
-			os.Exit(1)
-		} else {
-			searchTerms = append(searchTerms, arg)
-		}
-	}
-
-	if len(searchTerms) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: No search term provided.")
-		os.Exit(1)
-	}
-
-	return strings.Join(searchTerms, " "), verbose
-}
-
-func printUsageAndExit() {
-	fmt.Fprintf(os.Stderr, `Usage: toshi <searchterm> [options]
-Example: toshi The Iliad Homer
-Options:
-  -v  Enable verbose output with debug logs
-`)
-	os.Exit(1)
-}
-
 // parseEnv returns the domain from the environment variable
 func parseEnv() string {
 	domain := os.Getenv("DOMAIN")
@@ -83,26 +46,145 @@ func selectURL(env string, embed []string) string {
 	return embed[0]
 }
 
+// commands are the subcommands run instead of a search when named by the
+// first argument.
+var commands = map[string]func(lib.Catalog, []string){
+	"doctor":  runDoctor,
+	"info":    runInfo,
+	"shell":   runShell,
+	"get":     runGet,
+	"show":    runShow,
+	"history": runHistory,
+	"wish":    runWish,
+	"watch":   runWatch,
+	"cache":   runCache,
+}
+
 // Execute runs the CLI application
 func Execute() {
-	selected := selectURL(parseEnv(), embed.GetUrls())
-	if selected == "" {
-		fmt.Println("No valid domain found")
-		fmt.Println("Please set the DOMAIN environment variable or add a valid domain to domains.txt")
+	// Without a domain only the site source is unavailable; see openCatalog.
+	s := scraper.NewScraper(selectURL(parseEnv(), embed.GetUrls()))
+
+	args, global, err := parseGlobalFlags(os.Args[1:])
+	if err == nil {
+		err = configureScraper(s, global)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	s := scraper.NewScraper(selectURL(parseEnv(), embed.GetUrls()))
+	catalog, err := openCatalog(s, global)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) > 0 {
+		if run, ok := commands[args[0]]; ok {
+			run(catalog, args[1:])
+			return
+		}
+	}
 
-	searchTerm, verbose := parseArgs()
+	runSearch(catalog, parseArgs(args), args)
+}
 
-	if verbose {
+// runSearch searches with opts and lets the user pick a book to download,
+// or prints the results with --format. args is the command line recorded in
+// the history.
+func runSearch(s lib.Catalog, opts options, args []string) {
+	if opts.verbose {
 		logger.Configure(logger.LevelDebug, nil)
-		fmt.Println("DEBUG mode: Detailed logs are now enabled")
+		// On stderr, so that --format output stays clean.
+		fmt.Fprintln(os.Stderr, "DEBUG mode: Detailed logs are now enabled")
+	}
+
+	if err := ui.Configure(opts.color, opts.theme); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	searchOpts, err := searchOptions(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+	searchOpts.Args = args
 
-	if err := lib.ProcessBooks(s, searchTerm, ui.CLI{}); err != nil {
+	if opts.format != "" {
+		books, err := lib.Search(s, opts.term, searchOpts)
+		if err != nil {
+			logger.Errorf("Error searching books: %v", err)
+			os.Exit(1)
+		}
+		if err := lib.SaveSession(opts.term, books); err != nil {
+			logger.Debugf("Failed to save results: %v\n", err)
+		}
+		if err := ui.PrintBooks(os.Stdout, books, opts.format); err != nil {
+			logger.Errorf("Error printing books: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := lib.ProcessBooks(s, opts.term, selectUI(s, opts, searchOpts), searchOpts); err != nil {
 		logger.Errorf("Error processing books: %v", err)
 		os.Exit(1)
 	}
 }
+
+// defaultDoctorTerm is searched by the doctor command when no term is given.
+const defaultDoctorTerm = "The Iliad"
+
+// runDoctor checks the site layout and exits non-zero if a check failed.
+func runDoctor(s lib.Catalog, args []string) {
+	term := strings.Join(args, " ")
+	if term == "" {
+		term = defaultDoctorTerm
+	}
+
+	site := requireSite(s, "doctor")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report := lib.Diagnose(ctx, site, term)
+	report.Write(os.Stdout)
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+// runInfo prints the details of the book with the given ID or MD5.
+func runInfo(s lib.Catalog, args []string) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.term == "" || strings.Contains(opts.term, " ") {
+		fmt.Fprintln(os.Stderr, "Usage: toshi info <id|md5> [--format text|json]")
+		os.Exit(1)
+	}
+	if err := ui.Configure(opts.color, opts.theme); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.verbose {
+		logger.Configure(logger.LevelDebug, nil)
+	}
+
+	book, err := lib.FindBook(requireSite(s, "info"), opts.term)
+	if err != nil {
+		logger.Errorf("Error finding book: %v", err)
+		os.Exit(1)
+	}
+	details, err := lib.BookDetails(s, book)
+	if err != nil {
+		logger.Errorf("Error loading book details: %v", err)
+		os.Exit(1)
+	}
+	if err := ui.PrintBookDetails(os.Stdout, details, opts.format); err != nil {
+		logger.Errorf("Error printing book details: %v", err)
+		os.Exit(1)
+	}
+}
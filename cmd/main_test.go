@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/mfkd/toshi/internal/scraper"
 )
 
 func TestSelectURL(t *testing.T) {
@@ -39,16 +45,66 @@ func TestParseEnv(t *testing.T) {
 }
 
 func TestParseArgs_Success(t *testing.T) {
-	// Save and restore os.Args
-	oldArgs := os.Args
-	t.Cleanup(func() { os.Args = oldArgs })
-
-	os.Args = []string{"toshi", "The", "Iliad", "Homer", "-v"}
-	term, verbose := parseArgs()
-	if term != "The Iliad Homer" {
-		t.Fatalf("term = %q, want %q", term, "The Iliad Homer")
+	opts := parseArgs([]string{"The", "Iliad", "Homer", "-v"})
+	if opts.term != "The Iliad Homer" {
+		t.Fatalf("term = %q, want %q", opts.term, "The Iliad Homer")
 	}
-	if !verbose {
+	if !opts.verbose {
 		t.Fatalf("verbose = false, want true")
 	}
 }
+
+func TestParseGlobalFlags(t *testing.T) {
+	args, g, err := parseGlobalFlags([]string{"The", "--no-cache", "Iliad", "--record", "rec", "-v"})
+	if err != nil {
+		t.Fatalf("parseGlobalFlags error = %v", err)
+	}
+	if !g.noCache || g.record != "rec" || g.replay != "" {
+		t.Fatalf("global options = %+v, want no-cache and record rec", g)
+	}
+	if strings.Join(args, " ") != "The Iliad -v" {
+		t.Fatalf("args = %q, want [The Iliad -v]", args)
+	}
+
+	if _, g, _ := parseGlobalFlags([]string{"history", "--replay=rec"}); g.noCache || g.replay != "rec" {
+		t.Fatalf("global options = %+v, want replay rec only", g)
+	}
+	if _, g, _ := parseGlobalFlags([]string{"iliad", "--source", "calibre,site"}); strings.Join(g.sources, " ") != "calibre site" {
+		t.Fatalf("sources = %q, want [calibre site]", g.sources)
+	}
+	if _, _, err := parseGlobalFlags([]string{"iliad", "--record"}); err == nil {
+		t.Fatal("expected error for --record without a directory")
+	}
+	if _, _, err := parseGlobalFlags([]string{"--record", "a", "--replay", "b", "iliad"}); err == nil {
+		t.Fatal("expected error for --record with --replay")
+	}
+}
+
+func TestOpenCatalog_WithoutDomain(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("TOSHI_CONFIG_DIR", config)
+	s := scraper.NewScraper("")
+
+	// The default site needs a domain, but only once it is used.
+	c, err := openCatalog(s, globalOptions{})
+	if err != nil {
+		t.Fatalf("openCatalog() error = %v", err)
+	}
+	if _, err := c.Search(context.Background(), "the iliad"); !errors.Is(err, errNoDomain) {
+		t.Fatalf("Search() error = %v, want errNoDomain", err)
+	}
+
+	// Other sources work without one.
+	sources := `{"sources": [{"name": "nas", "kind": "local", "path": "` + filepath.ToSlash(t.TempDir()) + `"}]}`
+	if err := os.WriteFile(filepath.Join(config, "sources.json"), []byte(sources), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+	c, err = openCatalog(s, globalOptions{})
+	if err != nil {
+		t.Fatalf("openCatalog() error = %v", err)
+	}
+	if _, err := c.Search(context.Background(), "the iliad"); err != nil {
+		t.Fatalf("Search() of a local source error = %v", err)
+	}
+}
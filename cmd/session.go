@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+// runGet downloads books from the last search by number.
+func runGet(s lib.Catalog, args []string) {
+	_, numbers := parseSessionArgs(args)
+	if len(numbers) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: toshi get <number> ...")
+		os.Exit(1)
+	}
+
+	books := sessionBooks(numbers)
+
+	failed := 0
+	for _, b := range books {
+		fmt.Printf("Selected Book: %s\n", b.Title)
+		if _, err := lib.DownloadBook(s, b, os.Stdout); err != nil {
+			logger.Errorf("Error downloading %s: %v", b.Title, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runShow prints the last search results, or the books with the given
+// numbers.
+func runShow(_ lib.Catalog, args []string) {
+	opts, numbers := parseSessionArgs(args)
+
+	format := opts.format
+	if format == "" {
+		format = ui.FormatText
+	}
+
+	if len(numbers) == 0 {
+		session, err := lib.LoadSession()
+		if err != nil {
+			logger.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		if format == ui.FormatText {
+			fmt.Printf("%d results for %q, %s\n", len(session.Books), session.Query, session.Time.Format("2006-01-02 15:04"))
+		}
+		if err := ui.PrintBooks(os.Stdout, session.Books, format); err != nil {
+			logger.Errorf("Error printing books: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for i, b := range sessionBooks(numbers) {
+		if i > 0 && format == ui.FormatText {
+			fmt.Println()
+		}
+		if err := ui.PrintBook(os.Stdout, b, format); err != nil {
+			logger.Errorf("Error printing book: %v", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// parseSessionArgs parses the flags of get and show and returns the result
+// numbers given, exiting on invalid input.
+func parseSessionArgs(args []string) (options, []int) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ui.Configure(opts.color, opts.theme); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.verbose {
+		logger.Configure(logger.LevelDebug, nil)
+	}
+
+	var numbers []int
+	for _, field := range strings.Fields(opts.term) {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %q is not a result number\n", field)
+			os.Exit(1)
+		}
+		numbers = append(numbers, n)
+	}
+	return opts, numbers
+}
+
+// sessionBooks returns the books of the last search with the given numbers,
+// exiting if there is no saved search or a number is out of range.
+func sessionBooks(numbers []int) []lib.Book {
+	session, err := lib.LoadSession()
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	var books []lib.Book
+	for _, n := range numbers {
+		b, err := session.Book(n)
+		if err != nil {
+			logger.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		books = append(books, b)
+	}
+	return books
+}
@@ -0,0 +1,495 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/paths"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+const (
+	// shellPageSize is the number of results listed at a time.
+	shellPageSize = 20
+	// shellHistoryFile is the name of the command history in the data dir.
+	shellHistoryFile = "shell_history"
+	// maxShellHistory bounds the number of remembered commands.
+	maxShellHistory = 500
+)
+
+const shellHelp = `Commands:
+  search <terms>        Search and list the first results
+  filter key=value ...  Narrow the results; keys are ext, lang, year,
+                        max-size, min-pages, exclude-author and publisher
+  filter                Show the active filters
+  filter clear          Remove all filters (keeps ext=epub)
+  sort <key>            Order by relevance, year, title, size, pages or none
+  list                  List the current page again
+  next, prev            Page through the results
+  show <n>              Show the listed fields of result n
+  info <n>, i <n>       Load the description page of result n
+  get <n> ...           Download results by number
+  history               List previous commands
+  help                  Show this help
+  quit                  Leave the shell
+`
+
+// shell is an interactive session that keeps the site and the results of
+// the last search between commands.
+type shell struct {
+	site    lib.Catalog
+	out     io.Writer
+	opts    options
+	history *shellHistory
+
+	query   string
+	raw     []lib.Book // unfiltered results of the last search
+	results []lib.Book // raw after filtering and sorting
+	page    int
+}
+
+// runShell starts the interactive shell on the terminal.
+func runShell(s lib.Catalog, args []string) {
+	opts, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ui.Configure(opts.color, opts.theme); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	history, err := loadShellHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: command history is not saved: %v\n", err)
+		history = &shellHistory{}
+	}
+
+	sh := &shell{site: s, out: os.Stdout, opts: opts, history: history}
+	if opts.term != "" {
+		sh.execute("search " + opts.term)
+	}
+
+	read := newLineReader(history)
+	for {
+		line, err := read("toshi> ")
+		if err != nil {
+			fmt.Fprintln(sh.out)
+			return
+		}
+		if sh.execute(line) {
+			return
+		}
+	}
+}
+
+// newLineReader returns a function reading one command. On a terminal it
+// offers line editing and history; otherwise it reads lines from stdin, so
+// the shell can be scripted.
+func newLineReader(history *shellHistory) func(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		scanner := bufio.NewScanner(os.Stdin)
+		return func(string) (string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return "", err
+				}
+				return "", io.EOF
+			}
+			line := scanner.Text()
+			history.Add(line)
+			return line, nil
+		}
+	}
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	t.History = history
+	return func(prompt string) (string, error) {
+		// Only hold the terminal in raw mode while editing, so that search
+		// and download output is printed normally.
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(fd, oldState)
+
+		if width, height, err := term.GetSize(fd); err == nil {
+			t.SetSize(width, height)
+		}
+		t.SetPrompt(prompt)
+		return t.ReadLine()
+	}
+}
+
+// execute runs one command line and reports whether the shell should exit.
+func (sh *shell) execute(line string) (quit bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	command, args := fields[0], fields[1:]
+
+	var err error
+	switch command {
+	case "search", "s":
+		err = sh.search(strings.Join(args, " "))
+	case "filter", "f":
+		err = sh.filter(args)
+	case "sort":
+		err = sh.sort(args)
+	case "list", "ls":
+		err = sh.list()
+	case "next", "n":
+		err = sh.turnPage(1)
+	case "prev", "p":
+		err = sh.turnPage(-1)
+	case "show":
+		err = sh.show(args)
+	case "info", "i":
+		err = sh.info(args)
+	case "get":
+		err = sh.get(args)
+	case "history":
+		sh.printHistory()
+	case "help", "?":
+		fmt.Fprint(sh.out, shellHelp)
+	case "quit", "exit", "q":
+		return true
+	default:
+		err = fmt.Errorf("unknown command %q, type 'help' for a list", command)
+	}
+
+	if err != nil {
+		fmt.Fprintf(sh.out, "Error: %v\n", err)
+	}
+	return false
+}
+
+func (sh *shell) search(query string) error {
+	if query == "" {
+		return errors.New("usage: search <terms>")
+	}
+
+	// Fetch everything once so filters can be changed without searching
+	// again.
+	recorded := sh.opts
+	recorded.term = query
+	books, err := lib.Search(sh.site, query, lib.SearchOptions{Sort: lib.SortNone, Args: optionArgs(recorded)})
+	if err != nil {
+		return err
+	}
+
+	sh.query = query
+	sh.raw = books
+	return sh.refresh()
+}
+
+// refresh reapplies the filters and sort order to the last search results
+// and lists the first page.
+func (sh *shell) refresh() error {
+	searchOpts, err := searchOptions(sh.opts)
+	if err != nil {
+		return err
+	}
+
+	results := lib.ApplyFilters(sh.raw, searchOpts.Filters...)
+	if err := lib.SortBooks(results, searchOpts.Sort, sh.query, searchOpts.Preferences); err != nil {
+		return err
+	}
+
+	sh.results = results
+	sh.page = 0
+	if sh.query == "" {
+		return nil
+	}
+
+	// Keep 'toshi get' numbering in step with what the shell lists.
+	if err := lib.SaveSession(sh.query, sh.results); err != nil {
+		logger.Debugf("Failed to save results: %v\n", err)
+	}
+	return sh.list()
+}
+
+// filterFields maps the keys accepted by filter to the option they set.
+// min-pages is handled separately as it is not a string.
+func filterFields(opts *options) map[string]*string {
+	return map[string]*string{
+		"ext":            &opts.extensions,
+		"lang":           &opts.languages,
+		"year":           &opts.years,
+		"max-size":       &opts.maxSize,
+		"exclude-author": &opts.excludeAuthor,
+		"publisher":      &opts.publisher,
+	}
+}
+
+func (sh *shell) filter(args []string) error {
+	if len(args) == 0 {
+		sh.printFilters()
+		return nil
+	}
+
+	if len(args) == 1 && args[0] == "clear" {
+		defaults, _ := parseFlags(nil)
+		sh.opts.extensions = defaults.extensions
+		sh.opts.languages, sh.opts.years, sh.opts.maxSize = "", "", ""
+		sh.opts.minPages = 0
+		sh.opts.excludeAuthor, sh.opts.publisher = "", ""
+		return sh.refresh()
+	}
+
+	// Work on a copy so that an invalid argument changes nothing.
+	updated := sh.opts
+	fields := filterFields(&updated)
+	for _, arg := range joinFilterArgs(args) {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", arg)
+		}
+		if key == "min-pages" {
+			pages := 0
+			if value != "" {
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid min-pages %q", value)
+				}
+				pages = n
+			}
+			updated.minPages = pages
+			continue
+		}
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown filter %q", key)
+		}
+		*field = value
+	}
+	if _, err := buildFilters(updated); err != nil {
+		return err
+	}
+
+	sh.opts = updated
+	return sh.refresh()
+}
+
+// joinFilterArgs rejoins words without "=" to the value before them, so
+// that "publisher=penguin books" is one argument.
+func joinFilterArgs(args []string) []string {
+	var joined []string
+	for _, arg := range args {
+		if !strings.Contains(arg, "=") && len(joined) > 0 {
+			joined[len(joined)-1] += " " + arg
+			continue
+		}
+		joined = append(joined, arg)
+	}
+	return joined
+}
+
+func (sh *shell) printFilters() {
+	fields := filterFields(&sh.opts)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	active := 0
+	for _, key := range keys {
+		if value := *fields[key]; value != "" {
+			fmt.Fprintf(sh.out, "%s=%s\n", key, value)
+			active++
+		}
+	}
+	if sh.opts.minPages > 0 {
+		fmt.Fprintf(sh.out, "min-pages=%d\n", sh.opts.minPages)
+		active++
+	}
+	if active == 0 {
+		fmt.Fprintln(sh.out, "No filters.")
+	}
+}
+
+func (sh *shell) sort(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sort %s", strings.Join(lib.SortKeys, "|"))
+	}
+	if !slices.Contains(lib.SortKeys, args[0]) {
+		return fmt.Errorf("invalid sort %q, expected one of %s", args[0], strings.Join(lib.SortKeys, ", "))
+	}
+
+	sh.opts.sort = args[0]
+	return sh.refresh()
+}
+
+// list prints the current page of results.
+func (sh *shell) list() error {
+	if sh.query == "" {
+		return errors.New("no search yet, try 'search <terms>'")
+	}
+	if len(sh.results) == 0 {
+		fmt.Fprintf(sh.out, "No results for %q (%d before filtering).\n", sh.query, len(sh.raw))
+		return nil
+	}
+
+	start := sh.page * shellPageSize
+	if err := ui.PrintPage(sh.out, sh.results, start, shellPageSize); err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "Results %d-%d of %d for %q\n", start+1, min(start+shellPageSize, len(sh.results)), len(sh.results), sh.query)
+	return nil
+}
+
+func (sh *shell) turnPage(delta int) error {
+	page := sh.page + delta
+	if page < 0 || page*shellPageSize >= len(sh.results) {
+		return errors.New("no more results")
+	}
+
+	sh.page = page
+	return sh.list()
+}
+
+func (sh *shell) show(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: show <n>")
+	}
+	books, err := sh.selection(args)
+	if err != nil {
+		return err
+	}
+	return ui.PrintDetails(sh.out, books[0])
+}
+
+func (sh *shell) info(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: info <n>")
+	}
+	books, err := sh.selection(args)
+	if err != nil {
+		return err
+	}
+
+	details, err := lib.BookDetails(sh.site, books[0])
+	if err != nil {
+		return err
+	}
+	return ui.PrintBookDetails(sh.out, details, ui.FormatText)
+}
+
+func (sh *shell) get(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: get <n> ...")
+	}
+	books, err := sh.selection(args)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range books {
+		fmt.Fprintf(sh.out, "Selected Book: %s\n", b.Title)
+		if _, err := lib.DownloadBook(sh.site, b, sh.out); err != nil {
+			fmt.Fprintf(sh.out, "Error: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// selection returns the results numbered by args.
+func (sh *shell) selection(args []string) ([]lib.Book, error) {
+	var books []lib.Book
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(sh.results) {
+			return nil, fmt.Errorf("no result numbered %q", arg)
+		}
+		books = append(books, sh.results[n-1])
+	}
+	return books, nil
+}
+
+func (sh *shell) printHistory() {
+	for i := sh.history.Len() - 1; i >= 0; i-- {
+		fmt.Fprintf(sh.out, "%4d  %s\n", sh.history.Len()-i, sh.history.At(i))
+	}
+}
+
+// shellHistory is the command history of the shell. It implements
+// term.History and appends each command to a file when one is set.
+type shellHistory struct {
+	lines []string // oldest first
+	path  string
+}
+
+// loadShellHistory reads the saved history from the data directory.
+func loadShellHistory() (*shellHistory, error) {
+	path, err := paths.DataFile(shellHistoryFile)
+	if err != nil {
+		return nil, err
+	}
+	return readShellHistory(path)
+}
+
+func readShellHistory(path string) (*shellHistory, error) {
+	h := &shellHistory{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+
+	if len(h.lines) > maxShellHistory {
+		// Rewrite the file so it does not grow without bound.
+		h.lines = h.lines[len(h.lines)-maxShellHistory:]
+		if err := os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *shellHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || len(h.lines) > 0 && h.lines[len(h.lines)-1] == entry {
+		return
+	}
+
+	h.lines = append(h.lines, entry)
+	if len(h.lines) > maxShellHistory {
+		h.lines = h.lines[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, entry)
+}
+
+func (h *shellHistory) Len() int { return len(h.lines) }
+
+func (h *shellHistory) At(idx int) string { return h.lines[len(h.lines)-1-idx] }
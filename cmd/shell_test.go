@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+func newTestShell(t *testing.T, books []lib.Book) (*shell, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+	opts, err := parseFlags(nil)
+	if err != nil {
+		t.Fatalf("parseFlags error = %v", err)
+	}
+	opts.sort = lib.SortNone
+	out := &bytes.Buffer{}
+	sh := &shell{out: out, opts: opts, history: &shellHistory{}, query: "homer", raw: books}
+	if err := sh.refresh(); err != nil {
+		t.Fatalf("refresh error = %v", err)
+	}
+	return sh, out
+}
+
+func shellBooks() []lib.Book {
+	return []lib.Book{
+		{ID: "1", Title: "The Iliad", Authors: "Homer", Extension: "epub", Meta: lib.Metadata{Year: 1998, Language: "en"}},
+		{ID: "2", Title: "Ilias", Authors: "Homer", Extension: "epub", Meta: lib.Metadata{Year: 2005, Language: "de"}},
+		{ID: "3", Title: "The Odyssey", Authors: "Homer", Extension: "pdf", Meta: lib.Metadata{Year: 2010, Language: "en"}},
+	}
+}
+
+func resultIDs(books []lib.Book) string {
+	var ids []string
+	for _, b := range books {
+		ids = append(ids, b.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestShell_FilterAndSort(t *testing.T) {
+	sh, out := newTestShell(t, shellBooks())
+	if got := resultIDs(sh.results); got != "1,2" {
+		t.Fatalf("default results = %s, want epub books 1,2", got)
+	}
+	if session, err := lib.LoadSession(); err != nil || resultIDs(session.Books) != "1,2" {
+		t.Fatalf("saved session = %#v, %v, want the listed results", session, err)
+	}
+
+	sh.execute("filter lang=en ext=all")
+	if got := resultIDs(sh.results); got != "1,3" {
+		t.Fatalf("results after filter = %s, want 1,3", got)
+	}
+
+	sh.execute("sort year")
+	if got := resultIDs(sh.results); got != "3,1" {
+		t.Fatalf("results sorted by year = %s, want 3,1", got)
+	}
+
+	out.Reset()
+	sh.execute("filter year=2020..")
+	if len(sh.results) != 0 || !strings.Contains(out.String(), "No results") {
+		t.Fatalf("results = %s, output %q, want none", resultIDs(sh.results), out.String())
+	}
+
+	sh.execute("filter clear")
+	if got := resultIDs(sh.results); got != "2,1" {
+		t.Fatalf("results after clear = %s, want 2,1", got)
+	}
+}
+
+func TestShell_InvalidCommands(t *testing.T) {
+	sh, out := newTestShell(t, shellBooks())
+
+	for _, line := range []string{"filter color=red", "filter year=soon", "sort rating", "show 9", "get x", "frobnicate"} {
+		out.Reset()
+		if sh.execute(line) {
+			t.Fatalf("%q quit the shell", line)
+		}
+		if !strings.HasPrefix(out.String(), "Error:") {
+			t.Errorf("%q printed %q, want an error", line, out.String())
+		}
+	}
+	if got := resultIDs(sh.results); got != "1,2" {
+		t.Fatalf("results = %s, invalid commands should not change them", got)
+	}
+	if !sh.execute("quit") {
+		t.Fatal("quit did not end the shell")
+	}
+}
+
+func TestShell_ShowAndPaging(t *testing.T) {
+	var books []lib.Book
+	for i := 0; i < shellPageSize+5; i++ {
+		books = append(books, lib.Book{ID: "id", Title: "Book", Extension: "epub"})
+	}
+	books[1].Title = "Second Book"
+	sh, out := newTestShell(t, books)
+
+	out.Reset()
+	sh.execute("show 2")
+	if !strings.Contains(out.String(), "Second Book") {
+		t.Fatalf("show printed %q", out.String())
+	}
+
+	sh.execute("next")
+	if sh.page != 1 {
+		t.Fatalf("page = %d, want 1", sh.page)
+	}
+	out.Reset()
+	sh.execute("next")
+	if sh.page != 1 || !strings.Contains(out.String(), "no more results") {
+		t.Fatalf("page = %d, output %q, want to stay on the last page", sh.page, out.String())
+	}
+	sh.execute("prev")
+	if sh.page != 0 {
+		t.Fatalf("page = %d, want 0", sh.page)
+	}
+}
+
+func TestShellHistory_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), shellHistoryFile)
+
+	h, err := readShellHistory(path)
+	if err != nil {
+		t.Fatalf("readShellHistory error = %v", err)
+	}
+	h.Add("search iliad")
+	h.Add("search iliad")
+	h.Add("get 1")
+
+	h, err = readShellHistory(path)
+	if err != nil {
+		t.Fatalf("readShellHistory error = %v", err)
+	}
+	if h.Len() != 2 || h.At(0) != "get 1" || h.At(1) != "search iliad" {
+		t.Fatalf("history = %q, want [search iliad, get 1]", h.lines)
+	}
+}
+
+func TestShell_GetWritesProgress(t *testing.T) {
+	t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+	t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+	t.Chdir(t.TempDir())
+	srv := newBookServer(t)
+	scr := scraper.NewScraper(srv.URL + "/search.php")
+	scr.RequestDelay = 0
+	s := newSite(scr)
+
+	books, err := s.Search(context.Background(), "the iliad")
+	if err != nil || len(books) != 1 {
+		t.Fatalf("Search() = %#v, %v", books, err)
+	}
+	sh, out := newTestShell(t, books)
+	sh.site = s
+
+	out.Reset()
+	sh.execute("get 1")
+	if !strings.Contains(out.String(), "Book downloaded successfully") {
+		t.Fatalf("get printed %q, want the download progress", out.String())
+	}
+}
@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+const watchUsage = `Usage: toshi watch add "<query>" [options]
+       toshi watch list [--format text|json]
+       toshi watch remove <id>
+       toshi watch run [--interval 6h] [--output new.json] [--exec command]
+                       [--format text|json]`
+
+// watchRunOptions are the flags of 'toshi watch run'.
+type watchRunOptions struct {
+	interval time.Duration
+	output   string
+	exec     string
+	format   string
+	verbose  bool
+}
+
+// runWatch manages saved searches and reports new results for them.
+func runWatch(s lib.Catalog, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, watchUsage)
+		os.Exit(1)
+	}
+
+	if args[0] == "run" {
+		opts, err := parseWatchRunFlags(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n%s\n", err, watchUsage)
+			os.Exit(1)
+		}
+		if err := runWatches(s, opts); err != nil {
+			logger.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	opts, err := parseFlags(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	format := opts.format
+	if format == "" {
+		format = ui.FormatText
+	}
+
+	watchlist, err := lib.LoadWatchlist()
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		if opts.term == "" {
+			err = fmt.Errorf("no query given\n%s", watchUsage)
+			break
+		}
+		if _, err = buildFilters(opts); err != nil {
+			break
+		}
+		watch := watchlist.Add(opts.term, optionArgs(opts))
+		if err = watchlist.Save(); err == nil {
+			fmt.Printf("Added watch %d: %s\n", watch.ID, opts.term)
+		}
+	case "list":
+		err = printWatches(os.Stdout, watchlist.Items, format)
+	case "remove":
+		id, convErr := strconv.Atoi(opts.term)
+		if convErr != nil {
+			err = fmt.Errorf("expected a watch ID, got %q", opts.term)
+			break
+		}
+		if err = watchlist.Remove(id); err == nil {
+			err = watchlist.Save()
+		}
+	default:
+		fmt.Fprintln(os.Stderr, watchUsage)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func parseWatchRunFlags(args []string) (watchRunOptions, error) {
+	var opts watchRunOptions
+	fs := flag.NewFlagSet("watch run", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.DurationVar(&opts.interval, "interval", 0, "")
+	fs.StringVar(&opts.output, "output", "", "")
+	fs.StringVar(&opts.exec, "exec", "", "")
+	fs.StringVar(&opts.format, "format", ui.FormatText, "")
+	fs.BoolVar(&opts.verbose, "v", false, "")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if opts.format != ui.FormatText && opts.format != ui.FormatJSON {
+		return opts, fmt.Errorf("invalid format %q, expected %s or %s", opts.format, ui.FormatText, ui.FormatJSON)
+	}
+	if opts.interval < 0 {
+		return opts, fmt.Errorf("invalid interval %s", opts.interval)
+	}
+	return opts, nil
+}
+
+// runWatches runs every watch once, or every interval until interrupted.
+func runWatches(s lib.Catalog, opts watchRunOptions) error {
+	if opts.verbose {
+		logger.Configure(logger.LevelDebug, nil)
+	}
+
+	if opts.interval == 0 {
+		return runWatchesOnce(s, opts)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		// A failed run is reported and retried on the next tick.
+		if err := runWatchesOnce(s, opts); err != nil {
+			logger.Errorf("Error: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// runWatchesOnce runs every watch and emits the reports.
+func runWatchesOnce(s lib.Catalog, opts watchRunOptions) error {
+	watchlist, err := lib.LoadWatchlist()
+	if err != nil {
+		return err
+	}
+
+	reports := []*lib.WatchReport{}
+	for i := range watchlist.Items {
+		watch := &watchlist.Items[i]
+		report, err := runOneWatch(s, *watch)
+		if err != nil {
+			logger.Errorf("Watch %d %q failed: %v", watch.ID, watch.Query, err)
+			continue
+		}
+		watch.LastRun = report.Time
+		reports = append(reports, report)
+
+		if opts.exec != "" && len(report.New) > 0 {
+			if err := execWatchHook(opts.exec, report); err != nil {
+				logger.Errorf("Watch %d hook failed: %v", watch.ID, err)
+			}
+		}
+	}
+	if err := watchlist.Save(); err != nil {
+		return err
+	}
+
+	if opts.output != "" {
+		if err := writeWatchReports(opts.output, reports); err != nil {
+			return err
+		}
+	}
+	return printWatchReports(os.Stdout, reports, opts.format)
+}
+
+// runOneWatch runs watch with the filters it was saved with.
+func runOneWatch(s lib.Catalog, watch lib.Watch) (*lib.WatchReport, error) {
+	opts, err := parseFlags(watch.Args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored options: %w", err)
+	}
+	filters, err := buildFilters(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored options: %w", err)
+	}
+	return lib.RunWatch(s, watch, filters)
+}
+
+// execWatchHook runs command with the report as JSON on stdin. The watch
+// is also described in TOSHI_WATCH_* environment variables.
+func execWatchHook(command string, report *lib.WatchReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"TOSHI_WATCH_ID="+strconv.Itoa(report.WatchID),
+		"TOSHI_WATCH_QUERY="+report.Query,
+		"TOSHI_WATCH_NEW="+strconv.Itoa(len(report.New)),
+	)
+	return cmd.Run()
+}
+
+// writeWatchReports replaces the contents of path with the reports as JSON.
+func writeWatchReports(path string, reports []*lib.WatchReport) error {
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write reports: %w", err)
+	}
+	return nil
+}
+
+// printWatchReports writes the new books of each watch in the given format.
+func printWatchReports(w io.Writer, reports []*lib.WatchReport, format string) error {
+	if format == ui.FormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+
+	for _, r := range reports {
+		switch {
+		case r.Baseline:
+			fmt.Fprintf(w, "Watch %d %q: recorded %d current results, new ones will be reported from the next run\n", r.WatchID, r.Query, r.Results)
+		case len(r.New) == 0:
+			fmt.Fprintf(w, "Watch %d %q: nothing new\n", r.WatchID, r.Query)
+		default:
+			fmt.Fprintf(w, "Watch %d %q: %d new\n", r.WatchID, r.Query, len(r.New))
+			if err := ui.PrintBooks(w, r.New, ui.FormatText); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printWatches lists the saved watches in the given format.
+func printWatches(w io.Writer, watches []lib.Watch, format string) error {
+	switch format {
+	case ui.FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if watches == nil {
+			watches = []lib.Watch{}
+		}
+		return enc.Encode(watches)
+	case ui.FormatText:
+		if len(watches) == 0 {
+			_, err := fmt.Fprintln(w, "No watches.")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tQUERY\tOPTIONS\tLAST RUN")
+		for _, watch := range watches {
+			lastRun := "never"
+			if !watch.LastRun.IsZero() {
+				lastRun = watch.LastRun.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", watch.ID, watch.Query, flagSummary(watch.Args), lastRun)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+func TestParseWatchRunFlags(t *testing.T) {
+	opts, err := parseWatchRunFlags([]string{"--interval", "6h", "--output", "new.json", "--exec", "notify-send toshi"})
+	if err != nil {
+		t.Fatalf("parseWatchRunFlags error = %v", err)
+	}
+	if opts.interval != 6*time.Hour || opts.output != "new.json" || opts.exec != "notify-send toshi" || opts.format != "text" {
+		t.Fatalf("unexpected options: %#v", opts)
+	}
+
+	for _, args := range [][]string{{"--interval", "-1h"}, {"--format", "xml"}, {"extra"}} {
+		if _, err := parseWatchRunFlags(args); err == nil {
+			t.Errorf("parseWatchRunFlags(%q) succeeded, want error", args)
+		}
+	}
+}
+
+func TestWatchReportOutputs(t *testing.T) {
+	reports := []*lib.WatchReport{
+		{WatchID: 1, Query: "iliad", Results: 4, Baseline: true},
+		{WatchID: 2, Query: "odyssey", Results: 2, New: []lib.Book{{ID: "9", Title: "The Odyssey", Extension: "pdf"}}},
+	}
+
+	var text bytes.Buffer
+	if err := printWatchReports(&text, reports, "text"); err != nil {
+		t.Fatalf("printWatchReports error = %v", err)
+	}
+	for _, want := range []string{`Watch 1 "iliad": recorded 4 current results`, `Watch 2 "odyssey": 1 new`, "The Odyssey"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "new.json")
+	if err := writeWatchReports(path, reports); err != nil {
+		t.Fatalf("writeWatchReports error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []lib.WatchReport
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded) != 2 || decoded[1].New[0].ID != "9" {
+		t.Fatalf("decoded = %#v, %v", decoded, err)
+	}
+}
+
+func TestExecWatchHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook")
+	report := &lib.WatchReport{WatchID: 2, Query: "odyssey", New: []lib.Book{{ID: "9"}}}
+
+	if err := execWatchHook(`{ echo "$TOSHI_WATCH_ID $TOSHI_WATCH_NEW"; cat; } > `+out, report); err != nil {
+		t.Fatalf("execWatchHook error = %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, body, _ := strings.Cut(string(data), "\n")
+	if env != "2 1" || !strings.Contains(body, `"watch_id":2`) {
+		t.Fatalf("hook received %q", data)
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/ui"
+)
+
+const wishUsage = `Usage: toshi wish add "<query>" [options]
+       toshi wish list [--format text|json]
+       toshi wish remove <id>
+       toshi wish sync [--format text|json]`
+
+// runWish manages the wishlist of books to download once they turn up.
+func runWish(s lib.Catalog, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, wishUsage)
+		os.Exit(1)
+	}
+
+	opts, err := parseFlags(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.verbose {
+		logger.Configure(logger.LevelDebug, nil)
+	}
+	format := opts.format
+	if format == "" {
+		format = ui.FormatText
+	}
+
+	wishlist, err := lib.LoadWishlist()
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		err = addWish(wishlist, opts)
+	case "list":
+		err = printWishes(os.Stdout, wishlist.Items, format)
+	case "remove":
+		err = removeWish(wishlist, opts.term)
+	case "sync":
+		err = syncWishes(s, wishlist, format)
+	default:
+		fmt.Fprintln(os.Stderr, wishUsage)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func addWish(wishlist *lib.Wishlist, opts options) error {
+	if opts.term == "" {
+		return fmt.Errorf("no query given\n%s", wishUsage)
+	}
+	// Reject filters that would fail on every sync.
+	if _, err := searchOptions(opts); err != nil {
+		return err
+	}
+
+	wish := wishlist.Add(opts.term, optionArgs(opts))
+	if err := wishlist.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Added wish %d: %s\n", wish.ID, opts.term)
+	return nil
+}
+
+func removeWish(wishlist *lib.Wishlist, arg string) error {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("expected a wish ID, got %q", arg)
+	}
+	if err := wishlist.Remove(id); err != nil {
+		return err
+	}
+	return wishlist.Save()
+}
+
+// syncWishes searches for every pending wish and downloads confident
+// matches, saving the wishlist after each one, then reports the outcome of
+// each wish.
+func syncWishes(s lib.Catalog, wishlist *lib.Wishlist, format string) error {
+	var progress io.Writer = os.Stdout
+	if format == ui.FormatJSON {
+		// Keep stdout for the report.
+		progress = os.Stderr
+	}
+
+	synced := []lib.Wish{}
+	for i := range wishlist.Items {
+		wish := &wishlist.Items[i]
+		if wish.Status != lib.WishPending {
+			continue
+		}
+
+		syncWish(s, wish, progress)
+		if err := wishlist.Save(); err != nil {
+			return err
+		}
+		synced = append(synced, *wish)
+	}
+
+	return printWishes(os.Stdout, synced, format)
+}
+
+// syncWish searches for wish with its stored options and downloads the best
+// result if it is a confident match, writing progress to progress. Otherwise
+// the wish stays pending with the reason recorded. The search is neither
+// recorded in the history nor saved as the last results.
+func syncWish(s lib.Catalog, wish *lib.Wish, progress io.Writer) {
+	wish.LastTried = time.Now()
+	wish.Reason = ""
+
+	opts, err := parseFlags(wish.Args)
+	if err != nil {
+		wish.Reason = fmt.Sprintf("invalid stored options: %v", err)
+		return
+	}
+	searchOpts, err := searchOptions(opts)
+	if err != nil {
+		wish.Reason = fmt.Sprintf("invalid stored options: %v", err)
+		return
+	}
+
+	books, err := lib.SearchWithoutHistory(s, opts.term, searchOpts)
+	if err != nil {
+		wish.Reason = fmt.Sprintf("search failed: %v", err)
+		return
+	}
+	if len(books) == 0 {
+		wish.Reason = "no results match the filters"
+		return
+	}
+
+	best, score, ok := lib.ConfidentMatch(books, opts.term, searchOpts.Preferences)
+	if !ok {
+		wish.Reason = fmt.Sprintf("no confident match among %d results, best was %q (relevance %.2f)", len(books), best.Title, score.Relevance)
+		return
+	}
+
+	fmt.Fprintf(progress, "Selected Book: %s\n", best.Title)
+	name, err := lib.DownloadBook(s, best, progress)
+	if err != nil {
+		wish.Reason = fmt.Sprintf("download of %q failed: %v", best.Title, err)
+		return
+	}
+
+	wish.Status = lib.WishDone
+	wish.Book = &best
+	wish.File = name
+}
+
+// printWishes writes wishes with their status in the given format.
+func printWishes(w io.Writer, wishes []lib.Wish, format string) error {
+	switch format {
+	case ui.FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if wishes == nil {
+			wishes = []lib.Wish{}
+		}
+		return enc.Encode(wishes)
+	case ui.FormatText:
+		if len(wishes) == 0 {
+			_, err := fmt.Fprintln(w, "No wishes.")
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tQUERY\tSTATUS\tDETAILS")
+		for _, wish := range wishes {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", wish.ID, wish.Query, wish.Status, wishDetails(wish))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// wishDetails describes the options, download or pending reason of a wish.
+func wishDetails(wish lib.Wish) string {
+	if wish.Status == lib.WishDone && wish.Book != nil {
+		return fmt.Sprintf("downloaded %q as %s", wish.Book.Title, wish.File)
+	}
+	if wish.Reason != "" {
+		return wish.Reason
+	}
+	if flags := flagSummary(wish.Args); flags != "" {
+		return "not synced yet, " + flags
+	}
+	return "not synced yet"
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+// newBookServer serves a one-result search page for The Iliad with a
+// working mirror and download.
+func newBookServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search.php":
+			fmt.Fprintf(w, `<p>1 files found</p><table><tr valign="top"><td>1</td><td>Homer</td>
+				<td><a href="#">The Iliad</a></td><td>Penguin</td><td>1998</td><td>704</td><td>English</td>
+				<td>1 Mb</td><td>epub</td><td><a href="%s/mirror">m1</a></td><td></td></tr></table>`, srv.URL)
+		case "/mirror":
+			fmt.Fprintf(w, `<div id="download"><ul><li><a href="%s/iliad.epub">GET</a></li></ul></div>`, srv.URL)
+		case "/iliad.epub":
+			fmt.Fprint(w, "book")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSyncWish(t *testing.T) {
+	t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+	t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+	t.Chdir(t.TempDir())
+
+	srv := newBookServer(t)
+	scr := scraper.NewScraper(srv.URL + "/search.php")
+	scr.RequestDelay = 0
+	s := newSite(scr)
+
+	found := lib.Wish{Query: "the iliad", Args: []string{"the", "iliad"}, Status: lib.WishPending}
+	syncWish(s, &found, io.Discard)
+	if found.Status != lib.WishDone || found.Book == nil || found.File == "" {
+		t.Fatalf("unexpected wish after sync: %#v", found)
+	}
+	if _, err := os.Stat(filepath.Join("output", found.File)); err != nil {
+		t.Fatalf("downloaded file missing: %v", err)
+	}
+
+	// Syncing leaves the last results and the search history alone.
+	if session, err := lib.LoadSession(); err == nil && session != nil {
+		t.Fatalf("sync saved its results as the last session: %#v", session)
+	}
+	entries, err := lib.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Kind == lib.HistorySearch {
+			t.Fatalf("sync recorded a search in the history: %#v", e)
+		}
+	}
+
+	filtered := lib.Wish{Query: "the iliad", Args: []string{"the", "iliad", "--lang", "de"}, Status: lib.WishPending}
+	syncWish(s, &filtered, io.Discard)
+	if filtered.Status != lib.WishPending || !strings.Contains(filtered.Reason, "no results") {
+		t.Fatalf("unexpected wish after sync: %#v", filtered)
+	}
+
+	unrelated := lib.Wish{Query: "war and peace", Args: []string{"war", "and", "peace"}, Status: lib.WishPending}
+	syncWish(s, &unrelated, io.Discard)
+	if unrelated.Status != lib.WishPending || !strings.Contains(unrelated.Reason, "no confident match") {
+		t.Fatalf("unexpected wish after sync: %#v", unrelated)
+	}
+}
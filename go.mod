@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/PuerkitoBio/goquery v1.12.0
 	golang.org/x/term v0.45.0
+	golang.org/x/text v0.37.0
 )
 
 require (
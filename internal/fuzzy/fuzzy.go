@@ -0,0 +1,131 @@
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MatchThreshold is the Similarity above which two words are considered the
+// same word with a typo or transliteration difference.
+const MatchThreshold = 0.8
+
+// foldReplacer maps letters that Unicode decomposition leaves intact to
+// their usual ASCII spelling.
+var foldReplacer = strings.NewReplacer(
+	"ß", "ss",
+	"æ", "ae",
+	"œ", "oe",
+	"ø", "o",
+	"đ", "d",
+	"ð", "d",
+	"ł", "l",
+	"þ", "th",
+	"ı", "i",
+)
+
+// Fold normalizes s for comparison: NFKD decomposition with combining marks
+// removed, lower case, and special letters such as ß spelled out.
+func Fold(s string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return foldReplacer.Replace(strings.ToLower(folded))
+}
+
+// Words splits the folded form of s into words of letters and digits.
+func Words(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Similarity returns 1 minus the edit distance between the folded forms of a
+// and b, relative to the longer one. Transpositions count as one edit.
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(Fold(a)), []rune(Fold(b))
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(distance(ra, rb))/float64(longest)
+}
+
+// Contains reports whether needle occurs in haystack ignoring case and
+// diacritics, or whether every word of needle approximately matches a word
+// of haystack.
+func Contains(haystack, needle string) bool {
+	if strings.Contains(Fold(haystack), Fold(needle)) {
+		return true
+	}
+
+	needleWords := Words(needle)
+	if len(needleWords) == 0 {
+		return false
+	}
+	words := Words(haystack)
+	for _, n := range needleWords {
+		if BestMatch(n, words) < MatchThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsWords reports whether every word of needle occurs in haystack
+// ignoring case and diacritics, or approximately matches a word of it. Unlike
+// Contains, the words may occur in any order and as parts of longer words.
+// An empty needle matches anything.
+func ContainsWords(haystack, needle string) bool {
+	folded := Fold(haystack)
+	words := Words(haystack)
+	for _, n := range Words(needle) {
+		if !strings.Contains(folded, n) && BestMatch(n, words) < MatchThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+// BestMatch returns the highest Similarity between word and any of words.
+func BestMatch(word string, words []string) float64 {
+	best := 0.0
+	for _, w := range words {
+		if s := Similarity(word, w); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// distance is the optimal string alignment distance between a and b.
+func distance(a, b []rune) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(b)]
+}
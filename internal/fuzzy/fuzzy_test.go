@@ -0,0 +1,64 @@
+package fuzzy
+
+import "testing"
+
+func TestFold(t *testing.T) {
+    cases := map[string]string{
+        "Prozeß":            "prozess",
+        "Dostoïevski":       "dostoievski",
+        "Brontë":            "bronte",
+        "Łódź":              "lodz",
+        "ＡＢＣ":               "abc",
+        "Søren Kierkegaard": "soren kierkegaard",
+    }
+    for in, want := range cases {
+        if got := Fold(in); got != want {
+            t.Fatalf("Fold(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestSimilarity(t *testing.T) {
+    if s := Similarity("Dostoevsky", "Dostoyevsky"); s < MatchThreshold {
+        t.Fatalf("Similarity(Dostoevsky, Dostoyevsky) = %f, want >= %f", s, MatchThreshold)
+    }
+    if s := Similarity("Prozess", "Prozeß"); s != 1 {
+        t.Fatalf("Similarity(Prozess, Prozeß) = %f, want 1", s)
+    }
+    if s := Similarity("homer", "hmoer"); s != 0.8 {
+        t.Fatalf("transposition similarity = %f, want 0.8", s)
+    }
+    if s := Similarity("Kafka", "Tolstoy"); s >= MatchThreshold {
+        t.Fatalf("Similarity(Kafka, Tolstoy) = %f, want < %f", s, MatchThreshold)
+    }
+    if s := Similarity("", ""); s != 1 {
+        t.Fatalf("Similarity of empty strings = %f, want 1", s)
+    }
+}
+
+func TestContains(t *testing.T) {
+    if !Contains("Der Prozeß - Franz Kafka", "prozess") {
+        t.Fatal("expected diacritic-insensitive match")
+    }
+    if !Contains("Fyodor Dostoyevsky", "dostoevsky fyodor") {
+        t.Fatal("expected typo-tolerant word match")
+    }
+    if Contains("Leo Tolstoy", "dostoevsky") {
+        t.Fatal("unexpected match")
+    }
+}
+
+func TestContainsWords(t *testing.T) {
+    haystack := "Der Proceß Franz Kafka"
+    for needle, want := range map[string]bool{
+        "":                 true,
+        "kafka prozess":    true,
+        "proc kaf":         true,
+        "Kafka Dostoevsky": false,
+        "castle":           false,
+    } {
+        if got := ContainsWords(haystack, needle); got != want {
+            t.Fatalf("ContainsWords(%q, %q) = %v, want %v", haystack, needle, got, want)
+        }
+    }
+}
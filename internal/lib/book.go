@@ -3,24 +3,36 @@ package lib
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
-// TODO: Enhance filtering by ordering books by most complete metadata
-
 type Book struct {
-	ID        string
-	Authors   string
-	Title     string
-	ISBN      []string
-	Publisher string
-	Year      string
-	Pages     string
-	Language  string
-	Size      string
-	Extension string
-	Mirrors   []string
-	Edit      string
+	ID        string   `json:"id"`
+	Authors   string   `json:"authors"`
+	Title     string   `json:"title"`
+	ISBN      []string `json:"isbn"`
+	Publisher string   `json:"publisher"`
+	Year      string   `json:"year"`
+	Pages     string   `json:"pages"`
+	Language  string   `json:"language"`
+	Size      string   `json:"size"`
+	Extension string   `json:"extension"`
+	Mirrors   []string `json:"mirrors"`
+	Edit      string   `json:"edit"`
+	MD5       string   `json:"md5,omitempty"`
+	// Source names the source that found the book when several are
+	// searched. Empty means the default site.
+	Source string `json:"source,omitempty"`
+	// InLibrary is set for books in a local library, and for results of
+	// other sources that the library already holds.
+	InLibrary bool `json:"in_library,omitempty"`
+	// Position is the book's place in the results as its sources returned
+	// them, from 1, so that sorting by SortNone can restore that order.
+	Position int `json:"-"`
+
+	// Meta holds the typed values parsed from the raw fields above.
+	Meta Metadata `json:"meta"`
 }
 
 // Extract title and ISBN numbers from a string
@@ -62,12 +74,17 @@ func getFirstItem(input string) string {
 	return sanitizeComponent(parts[0])
 }
 
-// fileName generates a filename from book details.
+// fileName generates a filename from book details, preferring the parsed
+// metadata and falling back to the fields as the source lists them.
 func fileName(b Book) string {
 	var parts []string
 
-	// Add author if available.
-	if author := getFirstItem(b.Authors); author != "" {
+	// Add author if available, preferring the normalized name.
+	author := getFirstItem(b.Authors)
+	if len(b.Meta.Authors) > 0 {
+		author = sanitizeComponent(b.Meta.Authors[0])
+	}
+	if author != "" {
 		parts = append(parts, author)
 	}
 
@@ -81,7 +98,11 @@ func fileName(b Book) string {
 	if publisher := getFirstItem(b.Publisher); publisher != "" {
 		pubYear = publisher
 	}
-	if year := strings.TrimSpace(b.Year); year != "" {
+	year := strings.TrimSpace(b.Year)
+	if b.Meta.Year != 0 {
+		year = strconv.Itoa(b.Meta.Year)
+	}
+	if year != "" {
 		if pubYear != "" {
 			pubYear = fmt.Sprintf("%s (%s)", pubYear, year)
 		} else {
@@ -98,15 +119,3 @@ func fileName(b Book) string {
 
 	return fmt.Sprintf("%s.%s", filename, strings.TrimSpace(b.Extension))
 }
-
-// Filter books to only include those with the "epub" extension
-// TODO: filterEPUB could use a more generic filter function with a predicate, making it reusable for other extensions
-func filterEPUB(books []Book) []Book {
-	var filteredBooks []Book
-	for _, b := range books {
-		if b.Extension == "epub" {
-			filteredBooks = append(filteredBooks, b)
-		}
-	}
-	return filteredBooks
-}
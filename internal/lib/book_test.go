@@ -45,16 +45,3 @@ func TestFileName(t *testing.T) {
         t.Fatalf("fileName = %q, want %q", got, want)
     }
 }
-
-func TestFilterEPUB(t *testing.T) {
-    books := []Book{
-        {Title: "A", Extension: "pdf"},
-        {Title: "B", Extension: "epub"},
-        {Title: "C", Extension: "mobi"},
-        {Title: "D", Extension: "epub"},
-    }
-    got := filterEPUB(books)
-    if len(got) != 2 || got[0].Title != "B" || got[1].Title != "D" {
-        t.Fatalf("filterEPUB unexpected result: %#v", got)
-    }
-}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mfkd/toshi/internal/logger"
+)
+
+// queryVariant is a broadened form of a search that returned nothing.
+type queryVariant struct {
+	Description string
+	Query       searchQuery
+}
+
+// leadingArticles are stripped from the start of a title when broadening.
+var leadingArticles = []string{
+	"the", "a", "an",
+	"der", "die", "das", "ein", "eine",
+	"le", "la", "les", "l'", "un", "une",
+	"el", "los", "las", "il", "lo", "gli",
+}
+
+var (
+	isbnRegex         = regexp.MustCompile(`^(?:97[89])?\d{9}[\dXx]$`)
+	subtitleSeparator = regexp.MustCompile(`\s*[:|]\s*|\s+[-–—]\s+`)
+	authorSeparator   = regexp.MustCompile(`(?i)\s+by\s+|\s+[-–—]\s+`)
+)
+
+// broadenQuery returns progressively looser variants of term to try when the
+// original search finds nothing, most specific first. Variants identical to
+// the original search or an earlier variant are left out.
+func broadenQuery(term string) []queryVariant {
+	term = strings.Join(strings.Fields(term), " ")
+
+	var variants []queryVariant
+	seen := map[searchQuery]bool{defaultQuery(term): true}
+	add := func(description, t string, column string) {
+		t = strings.Join(strings.Fields(t), " ")
+		q := searchQuery{Term: t, Column: column}
+		if t == "" || seen[q] {
+			return
+		}
+		seen[q] = true
+		variants = append(variants, queryVariant{Description: description, Query: q})
+	}
+
+	if isbn := looksLikeISBN(term); isbn != "" {
+		add("ISBN search", isbn, columnIdentifier)
+	}
+
+	add("without exact phrase matching", term, columnDefault)
+
+	title := term
+	if parts := subtitleSeparator.Split(term, 2); len(parts) == 2 {
+		title = parts[0]
+		add("without subtitle", title, columnDefault)
+	}
+
+	if stripped := stripLeadingArticle(title); stripped != title {
+		add("without leading article", stripped, columnDefault)
+	}
+
+	if t, author, ok := splitTitleAuthor(term); ok {
+		add("title only", stripLeadingArticle(t), columnDefault)
+		add("author only", author, columnDefault)
+	}
+
+	return variants
+}
+
+// looksLikeISBN returns term without separators if it is an ISBN-10 or
+// ISBN-13, or an empty string otherwise.
+func looksLikeISBN(term string) string {
+	compact := strings.NewReplacer("-", "", " ", "").Replace(strings.TrimPrefix(strings.ToUpper(term), "ISBN"))
+	compact = strings.TrimLeft(compact, ":")
+	if isbnRegex.MatchString(compact) {
+		return compact
+	}
+	return ""
+}
+
+// stripLeadingArticle removes a leading article such as "The" from title.
+func stripLeadingArticle(title string) string {
+	lower := strings.ToLower(title)
+	for _, article := range leadingArticles {
+		if strings.HasSuffix(article, "'") && strings.HasPrefix(lower, article) {
+			return strings.TrimSpace(title[len(article):])
+		}
+		if strings.HasPrefix(lower, article+" ") {
+			return strings.TrimSpace(title[len(article)+1:])
+		}
+	}
+	return title
+}
+
+// splitTitleAuthor splits "Title by Author" or "Title - Author" at the last
+// separator. Commas are not separators, as they are common in titles such
+// as "War and Peace, Volume 1".
+func splitTitleAuthor(term string) (string, string, bool) {
+	matches := authorSeparator.FindAllStringIndex(term, -1)
+	if len(matches) == 0 {
+		return "", "", false
+	}
+
+	last := matches[len(matches)-1]
+	title := strings.TrimSpace(term[:last[0]])
+	author := strings.TrimSpace(term[last[1]:])
+	if title == "" || author == "" {
+		return "", "", false
+	}
+	return title, author, true
+}
+
+// exactKey marks a context whose searches must not be broadened.
+type exactKey struct{}
+
+// exactSearch returns a context under which sources search for the term
+// as given, without broadening it when nothing is found.
+func exactSearch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exactKey{}, true)
+}
+
+func isExactSearch(ctx context.Context) bool {
+	exact, _ := ctx.Value(exactKey{}).(bool)
+	return exact
+}
+
+// searchBroadened tries each broadened variant of term in turn and returns
+// the results of the first one that finds anything. A variant that fails is
+// skipped; an error is returned only if every variant failed. Each variant
+// gets an equal share of the time left, and broadening stops once ctx is
+// done.
+func searchBroadened(ctx context.Context, s *Site, term string) ([]Book, error) {
+	variants := broadenQuery(term)
+	failed := 0
+	var lastErr error
+	for i, v := range variants {
+		if err := ctx.Err(); err != nil {
+			logger.Debugf("Stopped broadening %q: %v\n", term, err)
+			return nil, err
+		}
+
+		vctx, cancel := context.WithTimeout(ctx, variantTimeout(ctx, len(variants)-i))
+		books, err := fetchQueryBooks(vctx, s, v.Query)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Debugf("Broadened search %q (%s) failed: %v\n", v.Query.Term, v.Description, err)
+			failed++
+			lastErr = err
+			continue
+		}
+
+		logger.Debugf("Broadened search %q (%s) found %d results\n", v.Query.Term, v.Description, len(books))
+		if len(books) > 0 {
+			// On stderr, so the notice is never mixed with the results.
+			fmt.Fprintf(os.Stderr, "No results for %q; found %d results searching %q (%s)\n", term, len(books), v.Query.Term, v.Description)
+			return books, nil
+		}
+	}
+
+	if failed > 0 && failed == len(variants) {
+		return nil, lastErr
+	}
+	return nil, nil
+}
+
+// variantTimeout shares the time left before ctx's deadline between the
+// remaining variants, so that a slow variant leaves time for the others.
+func variantTimeout(ctx context.Context, remaining int) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeout
+	}
+	return time.Until(deadline) / time.Duration(remaining)
+}
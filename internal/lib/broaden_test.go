@@ -0,0 +1,186 @@
+package lib
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBroadenQuery(t *testing.T) {
+    var got []string
+    for _, v := range broadenQuery("The Iliad: A New Translation by Robert Fagles") {
+        got = append(got, fmt.Sprintf("%s=%s", v.Description, v.Query.Term))
+    }
+    want := []string{
+        "without exact phrase matching=The Iliad: A New Translation by Robert Fagles",
+        "without subtitle=The Iliad",
+        "without leading article=Iliad",
+        "title only=Iliad: A New Translation",
+        "author only=Robert Fagles",
+    }
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Fatalf("broadenQuery =\n%v\nwant\n%v", got, want)
+    }
+}
+
+func TestSplitTitleAuthor(t *testing.T) {
+    cases := map[string][2]string{
+        "The Iliad by Homer":          {"The Iliad", "Homer"},
+        "Stand by Me by Ben E. King":  {"Stand by Me", "Ben E. King"},
+        "Anna Karenina - Leo Tolstoy": {"Anna Karenina", "Leo Tolstoy"},
+        "War and Peace, Volume 1":     {},
+        "Tolstoy, Leo":                {},
+    }
+    for in, want := range cases {
+        title, author, ok := splitTitleAuthor(in)
+        if ok != (want != [2]string{}) || title != want[0] || author != want[1] {
+            t.Fatalf("splitTitleAuthor(%q) = %q, %q, %v; want %q", in, title, author, ok, want)
+        }
+    }
+}
+
+func TestVariantTimeout(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 9*time.Second)
+    defer cancel()
+    if got := variantTimeout(ctx, 3); got > 3*time.Second || got < 2*time.Second {
+        t.Fatalf("variantTimeout = %v, want a third of the time left", got)
+    }
+    if got := variantTimeout(context.Background(), 3); got != defaultTimeout {
+        t.Fatalf("variantTimeout without deadline = %v, want %v", got, defaultTimeout)
+    }
+}
+
+func TestBroadenQuery_ISBN(t *testing.T) {
+    variants := broadenQuery("978-0-14-027536-0")
+    if len(variants) == 0 || variants[0].Query.Column != columnIdentifier || variants[0].Query.Term != "9780140275360" {
+        t.Fatalf("expected ISBN search first, got %#v", variants)
+    }
+    if looksLikeISBN("The Iliad") != "" || looksLikeISBN("014027536X") == "" {
+        t.Fatal("unexpected ISBN detection")
+    }
+}
+
+func TestStripLeadingArticle(t *testing.T) {
+    cases := map[string]string{"The Iliad": "Iliad", "Der Prozess": "Prozess", "L'Étranger": "Étranger", "Anathem": "Anathem"}
+    for in, want := range cases {
+        if got := stripLeadingArticle(in); got != want {
+            t.Fatalf("stripLeadingArticle(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestSearch_BroadensEmptyResults(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+    row := `<p>1 files found</p><table><tr valign="top"><td>1</td><td>Homer</td><td><a>The Iliad</a></td><td></td><td></td><td></td><td></td><td></td><td>epub</td><td><a href="/m">m</a></td><td></td></tr></table>`
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Query().Get("req") == "The Iliad" {
+            fmt.Fprint(w, row)
+            return
+        }
+        fmt.Fprint(w, `<p>0 files found</p><table><tr valign="top"><td>ID</td></tr></table>`)
+    }))
+    t.Cleanup(srv.Close)
+
+    s := newTestSite(srv.URL)
+    books, err := Search(s, "The Iliad: The Fagles Translation", SearchOptions{})
+    if err != nil {
+        t.Fatalf("Search error = %v", err)
+    }
+    if len(books) != 1 || books[0].Title != "The Iliad" {
+        t.Fatalf("unexpected books: %#v", books)
+    }
+}
+
+func TestSearchBroadened_SkipsFailedVariants(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    row := `<p>1 files found</p><table><tr valign="top"><td>1</td><td>Homer</td><td><a>The Iliad</a></td><td></td><td></td><td></td><td></td><td></td><td>epub</td><td><a href="/m">m</a></td><td></td></tr></table>`
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch {
+        case r.URL.Query().Get("req") == "The Iliad":
+            fmt.Fprint(w, row)
+        case r.URL.Query().Get("phrase") == "0":
+            http.Error(w, "unavailable", http.StatusServiceUnavailable)
+        default:
+            fmt.Fprint(w, `<p>0 files found</p><table><tr valign="top"><td>ID</td></tr></table>`)
+        }
+    }))
+    t.Cleanup(srv.Close)
+
+    s := newTestSite(srv.URL)
+    books, err := searchBroadened(context.Background(), s, "The Iliad: The Fagles Translation")
+    if err != nil || len(books) != 1 {
+        t.Fatalf("searchBroadened = %#v, %v; want the book found after a failed variant", books, err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if _, err := searchBroadened(ctx, s, "The Odyssey: A New Translation"); !errors.Is(err, context.Canceled) {
+        t.Fatalf("searchBroadened with a cancelled context error = %v, want context.Canceled", err)
+    }
+}
+
+// captureFile replaces *f with a pipe while fn runs and returns what was
+// written to it.
+func captureFile(t *testing.T, f **os.File, fn func()) string {
+    t.Helper()
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    saved := *f
+    *f = w
+    defer func() { *f = saved }()
+
+    done := make(chan string)
+    go func() {
+        var sb strings.Builder
+        buf := make([]byte, 4096)
+        for {
+            n, err := r.Read(buf)
+            sb.Write(buf[:n])
+            if err != nil {
+                break
+            }
+        }
+        done <- sb.String()
+    }()
+    fn()
+    w.Close()
+    return <-done
+}
+
+func TestSearchBroadened_NoticeOnStderr(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    row := `<p>1 files found</p><table><tr valign="top"><td>1</td><td>Homer</td><td><a>The Iliad</a></td><td></td><td></td><td></td><td></td><td></td><td>epub</td><td><a href="/m">m</a></td><td></td></tr></table>`
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Query().Get("req") == "The Iliad" {
+            fmt.Fprint(w, row)
+            return
+        }
+        fmt.Fprint(w, `<p>0 files found</p><table><tr valign="top"><td>ID</td></tr></table>`)
+    }))
+    t.Cleanup(srv.Close)
+    s := newTestSite(srv.URL)
+
+    var stderr string
+    stdout := captureFile(t, &os.Stdout, func() {
+        stderr = captureFile(t, &os.Stderr, func() {
+            if books, err := searchBroadened(context.Background(), s, "The Iliad: The Fagles Translation"); err != nil || len(books) != 1 {
+                t.Errorf("searchBroadened = %#v, %v", books, err)
+            }
+        })
+    })
+    if stdout != "" {
+        t.Fatalf("broadening wrote to stdout: %q", stdout)
+    }
+    if !strings.Contains(stderr, "No results for") {
+        t.Fatalf("stderr = %q, want the broadening notice", stderr)
+    }
+}
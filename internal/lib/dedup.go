@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var md5Regex = regexp.MustCompile(`(?i)\b[0-9a-f]{32}\b`)
+
+// md5FromMirrors extracts the file's MD5 from the first mirror link that
+// contains one, as mirror links are keyed by it.
+func md5FromMirrors(mirrors []string) string {
+	for _, m := range mirrors {
+		if match := md5Regex.FindString(m); match != "" {
+			return strings.ToLower(match)
+		}
+	}
+	return ""
+}
+
+// Dedupe merges books that refer to the same file. Books are matched by
+// MD5, then by ID, then by normalized title, author, format and size; books with
+// different known MD5s are never merged. The first occurrence is kept in
+// place and receives the mirrors of its duplicates.
+func Dedupe(books []Book) []Book {
+	var unique []Book
+	byMD5 := make(map[string]int)
+	byID := make(map[string]int)
+	byTuple := make(map[string]int)
+
+	for _, b := range books {
+		id := strings.TrimSpace(b.ID)
+		tuple := dedupeTuple(b)
+
+		i, found := -1, false
+		if b.MD5 != "" {
+			i, found = byMD5[b.MD5]
+		}
+		if !found && id != "" {
+			i, found = byID[id]
+		}
+		if !found && tuple != "" {
+			i, found = byTuple[tuple]
+		}
+		if found && unique[i].MD5 != "" && b.MD5 != "" && unique[i].MD5 != b.MD5 {
+			found = false
+		}
+
+		if !found {
+			i = len(unique)
+			unique = append(unique, b)
+			unique[i].Mirrors = mergeMirrors(nil, b.Mirrors)
+		} else {
+			unique[i].Mirrors = mergeMirrors(unique[i].Mirrors, b.Mirrors)
+			if unique[i].MD5 == "" {
+				unique[i].MD5 = b.MD5
+			}
+		}
+
+		if md5 := unique[i].MD5; md5 != "" {
+			byMD5[md5] = i
+		}
+		if id != "" {
+			byID[id] = i
+		}
+		if tuple != "" {
+			byTuple[tuple] = i
+		}
+	}
+
+	return unique
+}
+
+// dedupeTuple identifies a file by normalized title, primary author, format
+// and size. Sizes are compared as displayed unless given in bytes, as sizes
+// such as "1.5 Mb" are too coarse to tell files apart once parsed. It is
+// empty when the title or size is unknown.
+func dedupeTuple(b Book) string {
+	title := normalizeTitle(b.Title)
+	size := strings.ToLower(strings.Join(strings.Fields(b.Size), ""))
+	if b.Meta.SizeBytes > 0 && preciseSize(b.Size) {
+		size = fmt.Sprint(b.Meta.SizeBytes)
+	}
+	if title == "" || size == "" {
+		return ""
+	}
+	ext := strings.ToLower(strings.TrimSpace(b.Extension))
+	return title + "|" + normalizeName(primaryAuthor(b)) + "|" + ext + "|" + size
+}
+
+// preciseSize reports whether s is a size in bytes, e.g. "1048576" or
+// "1048576 bytes".
+func preciseSize(s string) bool {
+	match := sizeRegex.FindStringSubmatch(s)
+	if match == nil {
+		return false
+	}
+	unit := strings.ToLower(match[2])
+	return unit == "" || unit == "b" || strings.HasPrefix(unit, "byte")
+}
+
+// mergeMirrors appends the mirrors in add missing from dst, skipping empty
+// links.
+func mergeMirrors(dst, add []string) []string {
+	merged := make([]string, 0, len(dst)+len(add))
+	seen := make(map[string]bool)
+	for _, m := range append(append([]string(nil), dst...), add...) {
+		if m == "" || seen[m] {
+			continue
+		}
+		seen[m] = true
+		merged = append(merged, m)
+	}
+	return merged
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestMD5FromMirrors(t *testing.T) {
+    mirrors := []string{"", "http://library.lol/main/0123456789ABCDEF0123456789ABCDEF"}
+    if got := md5FromMirrors(mirrors); got != "0123456789abcdef0123456789abcdef" {
+        t.Fatalf("md5FromMirrors = %q", got)
+    }
+    if got := md5FromMirrors([]string{"http://x/ads.php?id=1"}); got != "" {
+        t.Fatalf("md5FromMirrors without md5 = %q", got)
+    }
+}
+
+func TestDedupe(t *testing.T) {
+    const md5a = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+    const md5b = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+    books := []Book{
+        {ID: "1", Title: "Iliad", MD5: md5a, Size: "1 Mb", Mirrors: []string{"https://m1/a", ""}},
+        {ID: "2", Title: "Odyssey", Size: "2 Mb", Mirrors: []string{"https://m1/o"}},
+        {ID: "9", Title: "Iliad", MD5: md5a, Size: "1 Mb", Mirrors: []string{"https://m2/a"}},
+        {ID: "2", Title: "Odyssey", Size: "2 Mb", Mirrors: []string{"https://m1/o", "https://m3/o"}},
+        {ID: "5", Title: "The Odyssey", Size: "2  MB", Mirrors: []string{"https://m4/o"}},
+        {ID: "6", Title: "Iliad", MD5: md5b, Size: "1 Mb", Mirrors: []string{"https://m5/b"}},
+    }
+
+    got := Dedupe(books)
+    if len(got) != 3 {
+        t.Fatalf("expected 3 unique books, got %d: %#v", len(got), got)
+    }
+    if !reflect.DeepEqual(got[0].Mirrors, []string{"https://m1/a", "https://m2/a"}) {
+        t.Fatalf("md5 duplicates not merged: %#v", got[0].Mirrors)
+    }
+    if !reflect.DeepEqual(got[1].Mirrors, []string{"https://m1/o", "https://m3/o", "https://m4/o"}) {
+        t.Fatalf("id/tuple duplicates not merged: %#v", got[1].Mirrors)
+    }
+    if got[2].MD5 != md5b {
+        t.Fatalf("book with a different md5 was merged: %#v", got[2])
+    }
+}
+
+func TestDedupe_KeepsFormatsAndEditionsApart(t *testing.T) {
+    books := []Book{
+        {ID: "1", Title: "War and Peace", Authors: "Tolstoy, Leo", Extension: "epub", Size: "1 Mb", Mirrors: []string{"https://m1/epub"}},
+        {ID: "2", Title: "War and Peace", Authors: "Tolstoy, Leo", Extension: "pdf", Size: "1 Mb", Mirrors: []string{"https://m1/pdf"}},
+        {ID: "3", Title: "War and Peace", Authors: "Tolstoy, Leo", Extension: "epub", Size: "1048576", Mirrors: []string{"https://m2/a"}},
+        {ID: "4", Title: "War and Peace", Authors: "Tolstoy, Leo", Extension: "epub", Size: "1048577", Mirrors: []string{"https://m2/b"}},
+        {ID: "5", Title: "War and Peace", Authors: "Tolstoy, Leo", Extension: "EPUB", Size: "1 MB", Mirrors: []string{"https://m3/epub"}},
+    }
+    for i := range books {
+        books[i].Meta = ParseMetadata(books[i])
+    }
+
+    got := Dedupe(books)
+    if len(got) != 4 {
+        t.Fatalf("expected 4 unique books, got %d: %#v", len(got), got)
+    }
+    if got[0].Extension != "epub" || !reflect.DeepEqual(got[0].Mirrors, []string{"https://m1/epub", "https://m3/epub"}) {
+        t.Fatalf("epub merged wrongly: %#v", got[0])
+    }
+    if got[1].Extension != "pdf" || !reflect.DeepEqual(got[1].Mirrors, []string{"https://m1/pdf"}) {
+        t.Fatalf("pdf merged with the epub: %#v", got[1])
+    }
+}
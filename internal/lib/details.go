@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+// columnMD5 searches by file MD5 and columnID by the site's book ID.
+const (
+	columnMD5 = "md5"
+	columnID  = "id"
+)
+
+// Details is the metadata of a book's description page, beyond what the
+// search results show.
+type Details struct {
+	Book        Book              `json:"book"`
+	Description string            `json:"description,omitempty"`
+	Series      string            `json:"series,omitempty"`
+	Edition     string            `json:"edition,omitempty"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	MD5         string            `json:"md5,omitempty"`
+	CoverURL    string            `json:"cover_url,omitempty"`
+	// URL is the page the details were read from.
+	URL string `json:"url"`
+}
+
+// identifierLabels maps the labels of identifiers on description pages to
+// the keys used in Details.Identifiers.
+var identifierLabels = map[string]string{
+	"isbn":          "isbn",
+	"isbns":         "isbn",
+	"asin":          "asin",
+	"doi":           "doi",
+	"issn":          "issn",
+	"oclc":          "oclc",
+	"oclc/worldcat": "oclc",
+	"openlibrary":   "openlibrary",
+	"google books":  "google_books",
+	"goodreads":     "goodreads",
+	"udc":           "udc",
+	"lbc":           "lbc",
+	"lcc":           "lcc",
+	"ddc":           "ddc",
+}
+
+var detailLabelRegex = regexp.MustCompile(`^[\p{L}\d() /-]{2,30}$`)
+
+// BookDetails returns the extended metadata of b from its source. For the
+// site, it is read from the description page on b's mirrors.
+func BookDetails(src Source, b Book) (*Details, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	return src.Details(ctx, b)
+}
+
+// fetchDetails tries each mirror of b in turn and parses the first page that
+// loads.
+func fetchDetails(ctx context.Context, s *Site, b Book) (*Details, error) {
+	err := errors.New("book has no description page")
+	for _, mirror := range b.Mirrors {
+		if mirror == "" {
+			continue
+		}
+
+		var doc *goquery.Document
+		doc, err = s.ScrapeWithContext(ctx, mirror)
+		if err != nil {
+			logger.Debugf("Failed to load description page %s: %v\n", mirror, err)
+			continue
+		}
+		return parseDetails(doc, b, mirror), nil
+	}
+	return nil, fmt.Errorf("failed to load book details: %w", err)
+}
+
+// parseDetails reads the labelled fields of a description page. Fields the
+// page does not have are left empty.
+func parseDetails(doc *goquery.Document, b Book, pageURL string) *Details {
+	fields := detailFields(doc)
+	d := &Details{
+		Book:        b,
+		Description: fields["description"],
+		Series:      fields["series"],
+		Edition:     fields["edition"],
+		MD5:         b.MD5,
+		URL:         pageURL,
+	}
+
+	for label, value := range fields {
+		if key, ok := identifierLabels[label]; ok && value != "" {
+			if d.Identifiers == nil {
+				d.Identifiers = make(map[string]string)
+			}
+			d.Identifiers[key] = value
+		}
+	}
+
+	if md5 := md5Regex.FindString(fields["md5"]); md5 != "" {
+		d.MD5 = strings.ToLower(md5)
+	} else if d.MD5 == "" {
+		d.MD5 = md5FromMirrors([]string{pageURL})
+	}
+
+	d.CoverURL = coverURL(doc, pageURL)
+	return d
+}
+
+// detailFields collects "Label: value" pairs from the leaf blocks of doc,
+// keyed by the lower case label. The value is the rest of the block's text,
+// or the text of the next cell when the label has a table cell of its own.
+// The first occurrence of a label wins.
+func detailFields(doc *goquery.Document) map[string]string {
+	fields := make(map[string]string)
+
+	doc.Find("td, th, p, div, li, dt").Each(func(i int, sel *goquery.Selection) {
+		if sel.Children().Filter("td, th, p, div, li, table, ul, dl").Length() > 0 {
+			return
+		}
+
+		label, value, ok := strings.Cut(strings.TrimSpace(sel.Text()), ":")
+		label = strings.ToLower(strings.TrimSpace(label))
+		if !ok || !detailLabelRegex.MatchString(label) {
+			return
+		}
+
+		value = collapseSpace(value)
+		if value == "" {
+			value = collapseSpace(sel.Next().Text())
+		}
+		if _, seen := fields[label]; !seen && value != "" {
+			fields[label] = value
+		}
+	})
+
+	return fields
+}
+
+// coverURL returns the absolute URL of the cover image on a description
+// page, or an empty string if there is none.
+func coverURL(doc *goquery.Document, pageURL string) string {
+	src := ""
+	doc.Find("img[src]").EachWithBreak(func(i int, img *goquery.Selection) bool {
+		candidate := img.AttrOr("src", "")
+		if strings.Contains(strings.ToLower(candidate), "cover") {
+			src = candidate
+			return false
+		}
+		return true
+	})
+	if src == "" {
+		return ""
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return src
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// collapseSpace trims s and replaces runs of whitespace with single spaces.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// FindBook looks up a single book by its site ID or MD5.
+func FindBook(s *Site, key string) (Book, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	key = strings.TrimSpace(key)
+	q := searchQuery{Term: key, Column: columnID}
+	isMD5 := md5Regex.MatchString(key) && len(key) == 32
+	if isMD5 {
+		key = strings.ToLower(key)
+		q.Column = columnMD5
+	}
+
+	books, err := fetchBooks(scraper.AsSearch(ctx), s, queryURL(s.URL, q, 1))
+	if err != nil {
+		return Book{}, err
+	}
+
+	// The site may ignore the column and search everything, so only an
+	// exact match is accepted.
+	for _, b := range books {
+		if isMD5 && b.MD5 == key || !isMD5 && strings.TrimSpace(b.ID) == key {
+			return b, nil
+		}
+	}
+	return Book{}, fmt.Errorf("no book with ID or MD5 %q found", key)
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+const descriptionPage = `<!doctype html><table><tr>
+    <td><img src="/covers/123/0123456789abcdef0123456789abcdef-d.jpg"></td>
+    <td id="info"><h1>The Iliad</h1>
+        <p>Author(s): Homer</p>
+        <p>Series: Penguin Classics</p>
+        <p>Edition: Revised</p>
+        <p>ISBN: 9780140275360, 0140275363</p>
+        <div>Description:<br>The   greatest war story
+            of all time.</div>
+    </td></tr></table>
+    <table><tr><td>ASIN:</td><td>B000FC1JAI</td></tr>
+    <tr><td>MD5:</td><td>0123456789ABCDEF0123456789ABCDEF</td></tr></table>`
+
+func TestParseDetails(t *testing.T) {
+    b := Book{Title: "The Iliad"}
+    d := parseDetails(mustDoc(t, descriptionPage), b, "http://mirror.example/main/page")
+
+    if d.Series != "Penguin Classics" || d.Edition != "Revised" {
+        t.Fatalf("series = %q, edition = %q", d.Series, d.Edition)
+    }
+    if d.Description != "The greatest war story of all time." {
+        t.Fatalf("description = %q", d.Description)
+    }
+    if d.Identifiers["isbn"] != "9780140275360, 0140275363" || d.Identifiers["asin"] != "B000FC1JAI" {
+        t.Fatalf("identifiers = %#v", d.Identifiers)
+    }
+    if d.MD5 != "0123456789abcdef0123456789abcdef" {
+        t.Fatalf("md5 = %q", d.MD5)
+    }
+    if d.CoverURL != "http://mirror.example/covers/123/0123456789abcdef0123456789abcdef-d.jpg" {
+        t.Fatalf("cover = %q", d.CoverURL)
+    }
+}
+
+func TestParseDetails_MissingFields(t *testing.T) {
+    d := parseDetails(mustDoc(t, `<p>Nothing to see</p>`), Book{MD5: "abc"}, "http://mirror.example/")
+    if d.Description != "" || d.Series != "" || d.Identifiers != nil || d.CoverURL != "" {
+        t.Fatalf("unexpected details: %#v", d)
+    }
+    if d.MD5 != "abc" {
+        t.Fatalf("md5 = %q, want the book's", d.MD5)
+    }
+}
+
+func TestFindBookAndDetails(t *testing.T) {
+    srv := newDoctorServer(t, doctorRow, descriptionPage)
+    s := newTestSite(srv.URL + "/search.php")
+
+    b, err := FindBook(s, "1")
+    if err != nil {
+        t.Fatalf("FindBook error = %v", err)
+    }
+    if b.Title != "The Iliad" {
+        t.Fatalf("title = %q", b.Title)
+    }
+
+    d, err := fetchDetails(context.Background(), s, b)
+    if err != nil {
+        t.Fatalf("fetchDetails error = %v", err)
+    }
+    if d.Series != "Penguin Classics" || !strings.HasSuffix(d.URL, "/mirror") {
+        t.Fatalf("unexpected details: %#v", d)
+    }
+
+    if _, err := FindBook(s, "2"); err == nil {
+        t.Fatal("expected error for an ID that is not in the results")
+    }
+}
@@ -0,0 +1,226 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/mfkd/toshi/internal/paths"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+const snapshotDirName = "snapshots"
+
+// Check is the outcome of validating one part of the site layout.
+type Check struct {
+	Name     string
+	Passed   bool
+	Skipped  bool
+	Message  string
+	Hint     string
+	Snapshot string
+}
+
+// Report collects the checks run against the site for a search term.
+type Report struct {
+	URL    string
+	Term   string
+	Time   time.Time
+	Checks []Check
+}
+
+// OK reports whether no check failed.
+func (r *Report) OK() bool {
+	for _, c := range r.Checks {
+		if !c.Passed && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Write prints a human readable version of the report.
+func (r *Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "toshi doctor report (%s)\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(w, "Site: %s\n", r.URL)
+	fmt.Fprintf(w, "Term: %q\n\n", r.Term)
+
+	for _, c := range r.Checks {
+		status := "FAIL"
+		if c.Skipped {
+			status = "SKIP"
+		} else if c.Passed {
+			status = " OK "
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, c.Name, c.Message)
+		if !c.Passed && !c.Skipped && c.Hint != "" {
+			fmt.Fprintf(w, "       hint: %s\n", c.Hint)
+		}
+		if c.Snapshot != "" {
+			fmt.Fprintf(w, "       snapshot: %s\n", c.Snapshot)
+		}
+	}
+
+	if !r.OK() {
+		fmt.Fprintln(w, "\nThe site layout appears to have changed. Please open an issue including this report and the snapshot files above.")
+	}
+}
+
+// Diagnose validates the search page, results table, pagination script and
+// mirror page against the structure toshi expects. Pages failing a check are
+// saved as HTML snapshots in the cache directory. Pages are always fetched
+// from the site rather than the cache.
+func Diagnose(ctx context.Context, s *Site, term string) *Report {
+	ctx = scraper.WithoutCache(ctx)
+	r := &Report{URL: s.URL, Term: term, Time: time.Now()}
+
+	searchURL := pageURL(s.URL, term, 1)
+	doc, err := s.ScrapeWithContext(ctx, searchURL)
+	if err != nil {
+		r.Checks = append(r.Checks,
+			Check{Name: "search page", Message: err.Error(), Hint: "check the configured domain and your network connection"},
+			Check{Name: "results table", Skipped: true, Message: "search page unavailable"},
+			Check{Name: "pagination", Skipped: true, Message: "search page unavailable"},
+			Check{Name: "mirror page", Skipped: true, Message: "search page unavailable"},
+		)
+		return r
+	}
+	r.Checks = append(r.Checks, Check{Name: "search page", Passed: true, Message: "fetched " + searchURL})
+
+	table := checkResultsTable(doc)
+	pagination := checkPagination(doc)
+	if !table.Passed || !pagination.Passed {
+		snapshot := saveSnapshot(doc, "search")
+		if !table.Passed {
+			table.Snapshot = snapshot
+		}
+		if !pagination.Passed {
+			pagination.Snapshot = snapshot
+		}
+	}
+	r.Checks = append(r.Checks, table, pagination)
+
+	books := parseBooks(doc)
+	if len(books) == 0 || books[0].Mirrors[0] == "" {
+		r.Checks = append(r.Checks, Check{Name: "mirror page", Skipped: true, Message: "no result with a mirror link to check"})
+		return r
+	}
+	r.Checks = append(r.Checks, checkMirrorPage(ctx, s, books[0]))
+
+	return r
+}
+
+func checkResultsTable(doc *goquery.Document) Check {
+	c := Check{
+		Name: "results table",
+		Hint: fmt.Sprintf("result rows are expected to match %q with %d cells; update the selectors in internal/lib/fetch.go", resultRowSelector, resultColumns),
+	}
+
+	rows := doc.Find(resultRowSelector)
+	if rows.Length() == 0 {
+		c.Message = fmt.Sprintf("no rows matching %q", resultRowSelector)
+		return c
+	}
+
+	results := 0
+	var bad []int
+	rows.Each(func(i int, row *goquery.Selection) {
+		if _, err := strconv.Atoi(row.Find("td:nth-child(1)").Text()); err != nil {
+			return
+		}
+		results++
+		if row.Find("td").Length() < resultColumns {
+			bad = append(bad, i)
+		}
+	})
+
+	if len(bad) > 0 {
+		c.Message = fmt.Sprintf("%d of %d result rows have fewer than %d cells", len(bad), results, resultColumns)
+		return c
+	}
+
+	c.Passed = true
+	if results == 0 {
+		c.Message = "table found, no results for this term"
+	} else {
+		c.Message = fmt.Sprintf("%d result rows parsed", results)
+	}
+	return c
+}
+
+func checkPagination(doc *goquery.Document) Check {
+	c := Check{
+		Name: "pagination",
+		Hint: `expected a "N files found" header or a paginator script; update pageCount in internal/lib/fetch.go`,
+	}
+
+	if pages, source, err := pageCount(doc); err == nil {
+		c.Passed = true
+		c.Message = fmt.Sprintf("%d pages (from %s)", pages, source)
+		return c
+	}
+
+	if next := nextPageLink(doc, ""); next != "" {
+		c.Passed = true
+		c.Message = "no page count, following next links"
+		return c
+	}
+
+	c.Message = errNoPageInfo.Error()
+	return c
+}
+
+func checkMirrorPage(ctx context.Context, s *Site, b Book) Check {
+	c := Check{
+		Name: "mirror page",
+		Hint: fmt.Sprintf("download links are expected to match %q; update the selector in internal/lib/fetch.go", downloadLinkSelector),
+	}
+
+	doc, err := s.ScrapeWithContext(ctx, b.Mirrors[0])
+	if err != nil {
+		c.Message = err.Error()
+		c.Hint = "the first mirror may be down; try again later before reporting"
+		return c
+	}
+
+	if n := doc.Find(downloadLinkSelector).Length(); n > 0 {
+		c.Passed = true
+		c.Message = fmt.Sprintf("%d download links on %s", n, b.Mirrors[0])
+		return c
+	}
+
+	c.Message = "no download links on " + b.Mirrors[0]
+	c.Snapshot = saveSnapshot(doc, "mirror")
+	return c
+}
+
+var unsafeSnapshotChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// saveSnapshot writes the document's HTML to the snapshot directory and
+// returns its path, or an empty string if it could not be saved.
+func saveSnapshot(doc *goquery.Document, name string) string {
+	dir, err := paths.CacheSubdir(snapshotDirName)
+	if err != nil {
+		return ""
+	}
+
+	html, err := doc.Html()
+	if err != nil {
+		return ""
+	}
+
+	name = unsafeSnapshotChars.ReplaceAllString(name, "_")
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.html", time.Now().Format("20060102-150405"), name))
+	if err := os.WriteFile(path, []byte(html), 0o644); err != nil {
+		return ""
+	}
+
+	return path
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+)
+
+const doctorRow = `<tr valign="top"><td>1</td><td>Homer</td><td><a href="#">The Iliad</a></td>
+    <td>Penguin</td><td>1998</td><td>704</td><td>English</td><td>1 Mb</td><td>epub</td>
+    <td><a href="BASE/mirror">m1</a></td><td><a href="/m2">m2</a></td></tr>`
+
+func newDoctorServer(t *testing.T, row, mirror string) *httptest.Server {
+    t.Helper()
+    var srv *httptest.Server
+    srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/search.php":
+            fmt.Fprint(w, `<p>1 files found</p><table><tr valign="top"><td>ID</td></tr>`+strings.ReplaceAll(row, "BASE", srv.URL)+`</table>`)
+        case "/mirror":
+            fmt.Fprint(w, mirror)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestDiagnose_Healthy(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    srv := newDoctorServer(t, doctorRow, `<div id="download"><ul><li><a href="/get/file.epub">GET</a></li></ul></div>`)
+
+    r := Diagnose(context.Background(), newTestSite(srv.URL+"/search.php"), "iliad")
+    if !r.OK() {
+        var sb strings.Builder
+        r.Write(&sb)
+        t.Fatalf("expected healthy report, got:\n%s", sb.String())
+    }
+    if len(r.Checks) != 4 {
+        t.Fatalf("expected 4 checks, got %d", len(r.Checks))
+    }
+}
+
+func TestDiagnose_BrokenLayoutSavesSnapshot(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    brokenRow := `<tr valign="top"><td>1</td><td>Homer</td></tr>`
+    srv := newDoctorServer(t, brokenRow, "")
+
+    r := Diagnose(context.Background(), newTestSite(srv.URL+"/search.php"), "iliad")
+    if r.OK() {
+        t.Fatal("expected failing report for truncated rows")
+    }
+    table := r.Checks[1]
+    if table.Passed || table.Snapshot == "" {
+        t.Fatalf("unexpected results table check: %#v", table)
+    }
+    if _, err := os.Stat(table.Snapshot); err != nil {
+        t.Fatalf("snapshot not written: %v", err)
+    }
+}
+
+func TestDiagnose_MissingDownloadLinks(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    srv := newDoctorServer(t, doctorRow, `<div id="links"></div>`)
+
+    r := Diagnose(context.Background(), newTestSite(srv.URL+"/search.php"), "iliad")
+    mirror := r.Checks[3]
+    if mirror.Passed || mirror.Snapshot == "" {
+        t.Fatalf("unexpected mirror check: %#v", mirror)
+    }
+}
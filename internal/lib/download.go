@@ -2,6 +2,8 @@ package lib
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -11,8 +13,10 @@ import (
 
 const downloadDir = "output"
 
-func tryDownloadLinks(ctx context.Context, s *scraper.Scraper, downloadLinks []string, filename string) error {
-	var err error
+var errNoDownloadLinks = errors.New("no download links available")
+
+func tryDownloadLinks(ctx context.Context, s scraper.FileDownloader, downloadLinks []string, filename string) error {
+	err := errNoDownloadLinks
 	for _, link := range downloadLinks {
 		if err = s.DownloadFile(ctx, filename, link, downloadDir); err == nil {
 			// TODO: Check if there is a way to handle this better.
@@ -24,27 +28,82 @@ func tryDownloadLinks(ctx context.Context, s *scraper.Scraper, downloadLinks []s
 	return err
 }
 
-func fetchDownloadLinks(ctx context.Context, s *scraper.Scraper, b Book) ([]string, error) {
-	var downloadLinks []string
+// downloadMirrors downloads b from c to filename one mirror at a time: the
+// links of a mirror are resolved and tried before the next mirror is loaded,
+// each mirror with its own timeout. It returns the last error if no mirror
+// works.
+func downloadMirrors(c Catalog, files scraper.FileDownloader, b Book, filename string) error {
+	if len(b.Mirrors) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
+		return resolveAndDownload(ctx, c, files, b, filename)
+	}
 
-	// TODO: Handle multiple mirrors
-	doc, err := s.ScrapeWithContext(ctx, b.Mirrors[0])
+	err := errNoDownloadLinks
+	for _, mirror := range b.Mirrors {
+		if mirror == "" {
+			continue
+		}
+		one := b
+		one.Mirrors = []string{mirror}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		err = resolveAndDownload(ctx, c, files, one, filename)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		logger.Debugf("Failed to download from mirror %s: %v\n", mirror, err)
+	}
+	return err
+}
+
+func resolveAndDownload(ctx context.Context, c Catalog, files scraper.FileDownloader, b Book, filename string) error {
+	downloadLinks, err := c.ResolveDownloads(ctx, b)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to fetch download links: %w", err)
 	}
+	return tryDownloadLinks(ctx, files, downloadLinks, filename)
+}
 
-	doc.Find("div#download ul li a[href]").Each(func(i int, s *goquery.Selection) {
-		href, exists := s.Attr("href")
-		if exists {
-			// TODO: Make this more robust.
-			if strings.Contains(href, "."+strings.TrimSpace(b.Extension)) {
-				downloadLinks = append(downloadLinks, href)
-			}
+// fetchDownloadLinks collects the download links of every mirror of b, in
+// mirror order. Mirrors that fail to load are skipped; an error is returned
+// only if none of them could be loaded.
+func fetchDownloadLinks(ctx context.Context, s *Site, b Book) ([]string, error) {
+	var downloadLinks []string
+	var lastErr error
+	loaded := 0
+
+	for _, mirror := range b.Mirrors {
+		if mirror == "" {
+			continue
+		}
+
+		doc, err := s.ScrapeWithContext(ctx, mirror)
+		if err != nil {
+			logger.Debugf("Failed to load mirror %s: %v\n", mirror, err)
+			lastErr = err
+			continue
 		}
-	})
+		loaded++
+
+		doc.Find(downloadLinkSelector).Each(func(i int, s *goquery.Selection) {
+			href, exists := s.Attr("href")
+			if exists {
+				// TODO: Make this more robust.
+				if strings.Contains(href, "."+strings.TrimSpace(b.Extension)) {
+					downloadLinks = append(downloadLinks, href)
+				}
+			}
+		})
+	}
+
+	if loaded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
 
 	if len(downloadLinks) == 0 {
-		logger.Errorf("No download links found for book: %s", b.Title)
+		logger.Debugf("No download links found for book: %s\n", b.Title)
 	}
 
 	return downloadLinks, nil
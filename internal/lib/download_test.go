@@ -8,8 +8,6 @@ import (
     "os"
     "strings"
     "testing"
-
-    "github.com/mfkd/toshi/internal/scraper"
 )
 
 func TestFetchDownloadLinks_FiltersByExtension(t *testing.T) {
@@ -30,7 +28,7 @@ func TestFetchDownloadLinks_FiltersByExtension(t *testing.T) {
     serverURL = srv.URL
     t.Cleanup(srv.Close)
 
-    s := scraper.NewScraper(serverURL)
+    s := newTestSite(serverURL)
     b := Book{Extension: "epub", Mirrors: []string{serverURL + "/mirror"}}
     links, err := fetchDownloadLinks(context.Background(), s, b)
     if err != nil {
@@ -55,7 +53,7 @@ func TestTryDownloadLinks_TriesUntilSuccess(t *testing.T) {
     }))
     t.Cleanup(srv.Close)
 
-    s := scraper.NewScraper(srv.URL)
+    s := newTestSite(srv.URL)
 
     // Isolate writes in a temp working directory so we don't touch the repo
     prevWD, err := os.Getwd()
@@ -72,3 +70,73 @@ func TestTryDownloadLinks_TriesUntilSuccess(t *testing.T) {
         t.Fatalf("expected to try both links, hits=%d", hits)
     }
 }
+
+func TestFetchDownloadLinks_TriesEveryMirror(t *testing.T) {
+    var serverURL string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/mirror2":
+            fmt.Fprintf(w, `<div id="download"><ul><li><a href="%s/file.epub">GET</a></li></ul></div>`, serverURL)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    serverURL = srv.URL
+    t.Cleanup(srv.Close)
+
+    s := newTestSite(serverURL)
+    b := Book{Extension: "epub", Mirrors: []string{serverURL + "/down", "", serverURL + "/mirror2"}}
+    links, err := fetchDownloadLinks(context.Background(), s, b)
+    if err != nil {
+        t.Fatalf("fetchDownloadLinks error = %v", err)
+    }
+    if len(links) != 1 {
+        t.Fatalf("unexpected links: %#v", links)
+    }
+
+    b.Mirrors = []string{serverURL + "/down"}
+    if _, err := fetchDownloadLinks(context.Background(), s, b); err == nil {
+        t.Fatal("expected error when no mirror loads")
+    }
+}
+
+func TestTryDownloadLinks_NoLinks(t *testing.T) {
+    if err := tryDownloadLinks(context.Background(), newTestSite(""), nil, "x.epub"); err != errNoDownloadLinks {
+        t.Fatalf("tryDownloadLinks error = %v, want errNoDownloadLinks", err)
+    }
+}
+
+func TestDownloadMirrors_StopsAtFirstWorkingMirror(t *testing.T) {
+    var serverURL string
+    var requested []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requested = append(requested, r.URL.Path)
+        switch r.URL.Path {
+        case "/mirror1":
+            fmt.Fprintf(w, `<div id="download"><ul><li><a href="%s/broken.epub">GET</a></li></ul></div>`, serverURL)
+        case "/mirror2":
+            fmt.Fprintf(w, `<div id="download"><ul><li><a href="%s/file.epub">GET</a></li></ul></div>`, serverURL)
+        case "/file.epub":
+            w.Write([]byte("ok"))
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    serverURL = srv.URL
+    t.Cleanup(srv.Close)
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    t.Chdir(t.TempDir())
+
+    s := newTestSite(serverURL)
+    b := Book{Extension: "epub", Mirrors: []string{serverURL + "/mirror1", serverURL + "/mirror2", serverURL + "/mirror3"}}
+    if err := downloadMirrors(s, s, b, "test.epub"); err != nil {
+        t.Fatalf("downloadMirrors error = %v", err)
+    }
+
+    // The broken link of the first mirror is tried before the second mirror
+    // is loaded, and the third mirror is never loaded.
+    want := []string{"/mirror1", "/broken.epub", "/mirror2", "/file.epub"}
+    if strings.Join(requested, " ") != strings.Join(want, " ") {
+        t.Fatalf("requested %v, want %v", requested, want)
+    }
+}
@@ -2,25 +2,49 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"regexp"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 
+	"github.com/mfkd/toshi/internal/logger"
 	"github.com/mfkd/toshi/internal/scraper"
 )
 
-func fetchBooks(ctx context.Context, s *scraper.Scraper, url string) ([]Book, error) {
+// Selectors describing the layout of the search and mirror pages.
+const (
+	resultRowSelector    = "tr[valign=top]"
+	downloadLinkSelector = "div#download ul li a[href]"
+	resultColumns        = 11
+)
+
+const (
+	// resultsPerPage is the number of rows the site shows per search page.
+	resultsPerPage = 25
+	// maxFollowedPages bounds pagination when only "next" links are available.
+	maxFollowedPages = 100
+)
+
+var errNoPageInfo = errors.New("no result count or paginator found")
+
+func fetchBooks(ctx context.Context, s *Site, url string) ([]Book, error) {
 	doc, err := s.ScrapeWithContext(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("error scraping lib: %w", err)
 	}
 
+	return parseBooks(doc), nil
+}
+
+// parseBooks extracts the result rows of a search page.
+func parseBooks(doc *goquery.Document) []Book {
 	var books []Book
 
-	doc.Find("tr[valign=top]").Each(func(i int, s *goquery.Selection) {
+	doc.Find(resultRowSelector).Each(func(i int, s *goquery.Selection) {
 		id := s.Find("td:nth-child(1)").Text()
 		if _, err := strconv.Atoi(id); err != nil {
 			// Skip rows where ID is not numeric (likely header)
@@ -46,84 +70,222 @@ func fetchBooks(ctx context.Context, s *scraper.Scraper, url string) ([]Book, er
 			},
 			Edit: s.Find("td:nth-child(11) a").AttrOr("href", ""),
 		}
+		book.MD5 = md5FromMirrors(book.Mirrors)
+		book.Meta = ParseMetadata(book)
 		books = append(books, book)
 	})
 
-	return books, nil
+	return books
+}
+
+func buildPageURLs(url string, q searchQuery, totalPages int) []string {
+	var urls []string
+	for i := 1; i <= totalPages; i++ {
+		urls = append(urls, queryURL(url, q, i))
+	}
+	return urls
 }
 
-func fetchPagesURLs(ctx context.Context, s *scraper.Scraper, term string) ([]string, error) {
-	var pages []string
+func totalPages(content string) (int, error) {
+	// Regex to match numbers followed by a comma
+	re := regexp.MustCompile(`\b(\d+),`)
+	matches := re.FindAllStringSubmatch(content, -1)
 
-	firstPage := pageURL(s.URL, term, 1)
+	if len(matches) != 3 {
+		return 0, fmt.Errorf("unexpected number of page info matches: %d", len(matches))
+	}
 
-	doc, err := s.ScrapeWithContext(ctx, firstPage)
+	totalPages, err := strconv.Atoi(matches[0][1])
 	if err != nil {
-		return nil, fmt.Errorf("error scraping lib: %w", err)
+		return 0, fmt.Errorf("error converting total pages to integer: %w", err)
+	}
+
+	return totalPages, nil
+}
+
+// pageCount determines the number of result pages of a search. The result
+// count in the "N files found" header is preferred and cross-checked against
+// the paginator script; if neither is present errNoPageInfo is returned.
+func pageCount(doc *goquery.Document) (int, string, error) {
+	found, hasFound := filesFound(doc)
+	paginated, hasPaginator := paginatorPages(doc)
+
+	switch {
+	case hasFound && hasPaginator:
+		fromHeader := pagesFor(found)
+		if fromHeader != paginated {
+			// The paginator reflects the page size the site actually used.
+			logger.Warnf("Page count mismatch: %d files found implies %d pages, paginator reports %d\n", found, fromHeader, paginated)
+			return paginated, "paginator", nil
+		}
+		return fromHeader, "header", nil
+	case hasFound:
+		return pagesFor(found), "header", nil
+	case hasPaginator:
+		return paginated, "paginator", nil
+	}
+
+	return 0, "", errNoPageInfo
+}
+
+// pagesFor returns the number of pages needed to show n results.
+func pagesFor(n int) int {
+	if n <= resultsPerPage {
+		return 1
+	}
+	return (n + resultsPerPage - 1) / resultsPerPage
+}
+
+var filesFoundRegex = regexp.MustCompile(`(?i)(\d[\d,.]*)\s*files\s+found`)
+
+// filesFound extracts the total result count from the "N files found" header.
+func filesFound(doc *goquery.Document) (int, bool) {
+	match := filesFoundRegex.FindStringSubmatch(doc.Text())
+	if match == nil {
+		return 0, false
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, match[1])
+
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, false
 	}
+	return n, true
+}
+
+var paginatorRegex = regexp.MustCompile(`Paginator\(\s*["'][^"']*["']\s*,\s*(\d+)\s*,`)
 
-	// Extract the <script> tag content
-	var scriptContent string
+// paginatorPages extracts the total page count from the paginator script.
+// Scripts constructing a Paginator are preferred over other scripts, which
+// are only accepted if they match the strict format of totalPages.
+func paginatorPages(doc *goquery.Document) (int, bool) {
+	var scripts []string
 	doc.Find("script").Each(func(i int, s *goquery.Selection) {
-		if scriptContent == "" {
-			scriptContent = s.Text()
+		if text := s.Text(); strings.TrimSpace(text) != "" {
+			scripts = append(scripts, text)
 		}
 	})
 
-	// Only one page found
-	if scriptContent == "" {
-		pages = append(pages, firstPage)
-		return pages, nil
+	for _, script := range scripts {
+		if match := paginatorRegex.FindStringSubmatch(script); match != nil {
+			if n, err := strconv.Atoi(match[1]); err == nil {
+				return n, true
+			}
+		}
 	}
 
-	totalPages, err := totalPages(scriptContent)
-	if err != nil {
-		return nil, fmt.Errorf("error extracting total pages: %w", err)
+	for _, script := range scripts {
+		if n, err := totalPages(script); err == nil {
+			return n, true
+		}
 	}
 
-	return buildPageURLs(s.URL, term, totalPages), nil
+	return 0, false
 }
 
-func buildPageURLs(url, term string, totalPages int) []string {
-	var urls []string
-	for i := 1; i <= totalPages; i++ {
-		urls = append(urls, pageURL(url, term, i))
-	}
-	return urls
+var nextLinkTexts = map[string]bool{
+	"next": true, "next page": true, ">": true, ">>": true, "»": true, "►": true, "▶": true,
 }
 
-func totalPages(content string) (int, error) {
-	// Regex to match numbers followed by a comma
-	re := regexp.MustCompile(`\b(\d+),`)
-	matches := re.FindAllStringSubmatch(content, -1)
+// nextPageLink returns the absolute URL of the page's "next" link, if any.
+func nextPageLink(doc *goquery.Document, current string) string {
+	var href string
+	doc.Find("a[href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := strings.ToLower(strings.TrimSpace(s.Text()))
+		if s.AttrOr("rel", "") == "next" || nextLinkTexts[text] {
+			href = s.AttrOr("href", "")
+			return false
+		}
+		return true
+	})
 
-	if len(matches) != 3 {
-		return 0, fmt.Errorf("unexpected number of page info matches: %d", len(matches))
+	if href == "" {
+		return ""
 	}
 
-	totalPages, err := strconv.Atoi(matches[0][1])
+	base, err := url.Parse(current)
 	if err != nil {
-		return 0, fmt.Errorf("error converting total pages to integer: %w", err)
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
 	}
+	return base.ResolveReference(ref).String()
+}
 
-	return totalPages, nil
+func fetchAllBooks(ctx context.Context, s *Site, term string) ([]Book, error) {
+	return fetchQueryBooks(ctx, s, defaultQuery(term))
 }
 
-func fetchAllBooks(ctx context.Context, s *scraper.Scraper, term string) ([]Book, error) {
-	var books []Book
+// fetchQueryBooks fetches and deduplicates the results of every page of q.
+// The pages are cached as search results.
+func fetchQueryBooks(ctx context.Context, s *Site, q searchQuery) ([]Book, error) {
+	books, _, err := searchPages(ctx, s, q)
+	return books, err
+}
+
+// searchPages is fetchQueryBooks that also reports whether the pages showed
+// a symptom of a layout change: a first page without any result rows, not
+// even the header, or a later page that could not be fetched.
+func searchPages(ctx context.Context, s *Site, q searchQuery) ([]Book, bool, error) {
+	ctx = scraper.AsSearch(ctx)
+	firstPage := queryURL(s.URL, q, 1)
 
-	pages, err := fetchPagesURLs(ctx, s, term)
+	doc, err := s.ScrapeWithContext(ctx, firstPage)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching page URLS: %w", err)
+		return nil, false, fmt.Errorf("error scraping lib: %w", err)
+	}
+	noTable := doc.Find(resultRowSelector).Length() == 0
+	books := parseBooks(doc)
+
+	total, source, err := pageCount(doc)
+	if err != nil {
+		logger.Debugf("No page count found, following next links\n")
+		books, err = followNextLinks(ctx, s, doc, firstPage, books)
+		if err != nil {
+			return nil, true, err
+		}
+		return Dedupe(books), noTable, nil
 	}
+	logger.Debugf("Found %d pages of results (from %s)\n", total, source)
 
-	for _, page := range pages {
+	for _, page := range buildPageURLs(s.URL, q, total)[1:] {
 		booksOnPage, err := fetchBooks(ctx, s, page)
 		if err != nil {
-			return nil, fmt.Errorf("error fetching books from page: %w", err)
+			return nil, true, fmt.Errorf("error fetching books from page: %w", err)
 		}
 		books = append(books, booksOnPage...)
-		time.Sleep(s.RequestDelay)
+	}
+
+	return Dedupe(books), noTable, nil
+}
+
+// followNextLinks collects results by following "next" links from doc until
+// there are none left or maxFollowedPages is reached.
+func followNextLinks(ctx context.Context, s *Site, doc *goquery.Document, current string, books []Book) ([]Book, error) {
+	visited := map[string]bool{current: true}
+
+	for next := nextPageLink(doc, current); next != "" && !visited[next]; next = nextPageLink(doc, current) {
+		if len(visited) >= maxFollowedPages {
+			logger.Warnf("Stopped following next links after %d pages\n", maxFollowedPages)
+			break
+		}
+		visited[next] = true
+		current = next
+
+		var err error
+		doc, err = s.ScrapeWithContext(ctx, current)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching books from page: %w", err)
+		}
+		books = append(books, parseBooks(doc)...)
 	}
 
 	return books, nil
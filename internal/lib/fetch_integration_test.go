@@ -6,16 +6,16 @@ import (
     "net/http"
     "net/http/httptest"
     "testing"
-
-    "github.com/mfkd/toshi/internal/scraper"
 )
 
-func TestFetchPagesURLs_ParsesPagination(t *testing.T) {
+func TestFetchAllBooks_ParsesPagination(t *testing.T) {
     var base string
+    requested := map[string]bool{}
     // First page returns a <script> with three numbers ending in commas, first is total pages
     srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         switch r.URL.Path {
         case "/search.php":
+            requested[r.URL.Query().Get("page")] = true
             fmt.Fprint(w, `<!doctype html><html><head></head><body><script>var total=3, other=2, x=1,</script></body></html>`)
         default:
             http.NotFound(w, r)
@@ -24,17 +24,36 @@ func TestFetchPagesURLs_ParsesPagination(t *testing.T) {
     base = srv.URL
     t.Cleanup(srv.Close)
 
-    s := scraper.NewScraper(base + "/search.php")
-    urls, err := fetchPagesURLs(context.Background(), s, "foo bar")
-    if err != nil {
-        t.Fatalf("fetchPagesURLs error = %v", err)
+    s := newTestSite(base + "/search.php")
+    if _, err := fetchAllBooks(context.Background(), s, "foo bar"); err != nil {
+        t.Fatalf("fetchAllBooks error = %v", err)
     }
-    if len(urls) != 3 {
-        t.Fatalf("expected 3 urls, got %d", len(urls))
+    if len(requested) != 3 || !requested["1"] || !requested["3"] {
+        t.Fatalf("unexpected pages requested: %#v", requested)
+    }
+}
+
+func TestFetchAllBooks_FollowsNextLinks(t *testing.T) {
+    row := `<tr valign="top"><td>%d</td><td>A</td><td><a>T</a></td><td></td><td></td><td></td><td></td><td></td><td>epub</td><td><a href="/m">m</a></td><td></td></tr>`
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Query().Get("page") {
+        case "1":
+            fmt.Fprintf(w, `<table>`+row+`</table><a href="/search.php?page=2">next</a>`, 1)
+        case "2":
+            fmt.Fprintf(w, `<table>`+row+`</table><a href="/search.php?page=1">prev</a>`, 2)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+
+    s := newTestSite(srv.URL + "/search.php")
+    books, err := fetchAllBooks(context.Background(), s, "foo")
+    if err != nil {
+        t.Fatalf("fetchAllBooks error = %v", err)
     }
-    // spot check page=1 and page=3 exist
-    if urls[0] == urls[2] || urls[0] == "" || urls[2] == "" {
-        t.Fatalf("unexpected urls: %#v", urls)
+    if len(books) != 2 || books[0].ID != "1" || books[1].ID != "2" {
+        t.Fatalf("unexpected books: %#v", books)
     }
 }
 
@@ -60,7 +79,7 @@ func TestFetchBooks_ParsesTable(t *testing.T) {
     }))
     t.Cleanup(srv.Close)
 
-    s := scraper.NewScraper(srv.URL)
+    s := newTestSite(srv.URL)
     books, err := fetchBooks(context.Background(), s, srv.URL)
     if err != nil {
         t.Fatalf("fetchBooks error = %v", err)
@@ -72,5 +91,8 @@ func TestFetchBooks_ParsesTable(t *testing.T) {
     if b.ID != "123" || b.Extension != "epub" || len(b.ISBN) != 1 {
         t.Fatalf("unexpected book parsed: %#v", b)
     }
+    if b.Meta.Year != 2024 || b.Meta.Pages != 333 || b.Meta.SizeBytes != 1<<20 || b.Meta.Language != "en" || len(b.Meta.Authors) != 2 {
+        t.Fatalf("unexpected metadata parsed: %#v", b.Meta)
+    }
 }
 
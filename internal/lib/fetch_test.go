@@ -3,7 +3,7 @@ package lib
 import "testing"
 
 func TestBuildPageURLs(t *testing.T) {
-    urls := buildPageURLs("https://books.xyz/search.php", "foo", 3)
+    urls := buildPageURLs("https://books.xyz/search.php", defaultQuery("foo"), 3)
     if len(urls) != 3 {
         t.Fatalf("expected 3 urls, got %d", len(urls))
     }
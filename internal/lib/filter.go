@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+)
+
+// Filter reports whether a book should be kept in the results.
+type Filter func(Book) bool
+
+// ApplyFilters returns the books accepted by every filter, preserving order.
+func ApplyFilters(books []Book, filters ...Filter) []Book {
+	var filtered []Book
+	for _, b := range books {
+		if matchesAll(b, filters) {
+			filtered = append(filtered, b)
+		}
+	}
+	return filtered
+}
+
+func matchesAll(b Book, filters []Filter) bool {
+	for _, f := range filters {
+		if !f(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// ByExtension keeps books in one of the given formats, e.g. "epub".
+func ByExtension(exts ...string) Filter {
+	set := lowerSet(exts)
+	return func(b Book) bool {
+		return set[strings.ToLower(strings.TrimSpace(b.Extension))]
+	}
+}
+
+// ByLanguage keeps books in one of the given languages, named by ISO 639
+// code or by name, e.g. "en" or "English".
+func ByLanguage(languages ...string) Filter {
+	set := make(map[string]bool)
+	for _, l := range languages {
+		if code := languageCode(l); code != "" {
+			set[code] = true
+		}
+	}
+	return func(b Book) bool {
+		return set[b.Meta.Language]
+	}
+}
+
+// ByYearRange keeps books published between min and max inclusive. A zero
+// bound is open. Books without a known year are dropped.
+func ByYearRange(min, max int) Filter {
+	return func(b Book) bool {
+		year := b.Meta.Year
+		return year != 0 && (min == 0 || year >= min) && (max == 0 || year <= max)
+	}
+}
+
+// ByMaxSize keeps books no larger than size bytes. Like ByMinPages, it
+// keeps books of unknown size, as the site often leaves it out.
+func ByMaxSize(size int64) Filter {
+	return func(b Book) bool {
+		return b.Meta.SizeBytes <= size
+	}
+}
+
+// ByMinPages keeps books with at least pages pages. Like ByMaxSize, it
+// keeps books with an unknown page count, as the site often leaves it out.
+func ByMinPages(pages int) Filter {
+	return func(b Book) bool {
+		return b.Meta.Pages == 0 || b.Meta.Pages >= pages
+	}
+}
+
+// ExcludeAuthors drops books with an author matching one of names, ignoring
+// case, diacritics and small typos.
+func ExcludeAuthors(names ...string) Filter {
+	return func(b Book) bool {
+		return !containsAny(b.Authors, names)
+	}
+}
+
+// ByPublisher keeps books whose publisher matches one of names, ignoring
+// case, diacritics and small typos.
+func ByPublisher(names ...string) Filter {
+	return func(b Book) bool {
+		return containsAny(b.Publisher, names)
+	}
+}
+
+// ParseYearRange parses "1990..2010", "1990..", "..2010" or "2001" into
+// inclusive bounds, using zero for an open bound. A range needs at least
+// one bound.
+func ParseYearRange(s string) (int, int, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "..")
+	if !isRange {
+		hi = lo
+	}
+
+	min, err := parseYearBound(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year range %q: %w", s, err)
+	}
+	max, err := parseYearBound(hi)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year range %q: %w", s, err)
+	}
+	if min == 0 && max == 0 {
+		return 0, 0, fmt.Errorf("invalid year range %q: needs a start or an end year", s)
+	}
+	if min != 0 && max != 0 && min > max {
+		return 0, 0, fmt.Errorf("invalid year range %q: start is after end", s)
+	}
+
+	return min, max, nil
+}
+
+// ParseLanguages maps language names and codes, e.g. "English" or "en", to
+// ISO 639 codes. It fails on a language it does not know.
+func ParseLanguages(languages []string) ([]string, error) {
+	codes := make([]string, 0, len(languages))
+	for _, l := range languages {
+		code := languageCode(l)
+		if code == "" {
+			return nil, fmt.Errorf("unknown language %q, expected an ISO 639 code such as en or a name such as English", l)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func parseYearBound(s string) (int, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func containsAny(s string, needles []string) bool {
+	for _, n := range needles {
+		if n = strings.TrimSpace(n); n != "" && fuzzy.Contains(s, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(strings.TrimSpace(v))] = true
+	}
+	return set
+}
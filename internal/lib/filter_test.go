@@ -0,0 +1,96 @@
+package lib
+
+import "testing"
+
+func titles(books []Book) []string {
+    var out []string
+    for _, b := range books {
+        out = append(out, b.Title)
+    }
+    return out
+}
+
+func TestByExtension(t *testing.T) {
+    books := []Book{
+        {Title: "A", Extension: "pdf"},
+        {Title: "B", Extension: "epub"},
+        {Title: "C", Extension: "mobi"},
+        {Title: "D", Extension: "EPUB"},
+    }
+    got := ApplyFilters(books, ByExtension("epub"))
+    if len(got) != 2 || got[0].Title != "B" || got[1].Title != "D" {
+        t.Fatalf("ByExtension unexpected result: %#v", got)
+    }
+}
+
+func TestApplyFilters_Composes(t *testing.T) {
+    books := []Book{
+        {Title: "A", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Language: "en", Year: 1998, Pages: 700, SizeBytes: 2 << 20}},
+        {Title: "B", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Language: "de", Year: 1998, Pages: 700, SizeBytes: 2 << 20}},
+        {Title: "C", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Language: "en", Year: 1985, Pages: 700, SizeBytes: 2 << 20}},
+        {Title: "D", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Language: "en", Year: 2000, Pages: 50, SizeBytes: 2 << 20}},
+        {Title: "E", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Language: "en", Year: 2000, Pages: 700, SizeBytes: 80 << 20}},
+        {Title: "F", Authors: "Homer; Pope, Alexander", Publisher: "Penguin", Meta: Metadata{Language: "en", Year: 2000, Pages: 700}},
+        {Title: "G", Authors: "Homer", Publisher: "Oxford", Meta: Metadata{Language: "en", Year: 2000, Pages: 700}},
+        {Title: "H", Authors: "Homer", Publisher: "Penguin Classics", Meta: Metadata{Language: "en", Year: 2010, Pages: 700}},
+    }
+    got := ApplyFilters(books,
+        ByLanguage("en", "fr"),
+        ByYearRange(1990, 2010),
+        ByMaxSize(50<<20),
+        ByMinPages(100),
+        ExcludeAuthors("pope"),
+        ByPublisher("penguin"),
+    )
+    if names := titles(got); len(names) != 2 || names[0] != "A" || names[1] != "H" {
+        t.Fatalf("ApplyFilters = %v, want [A H]", names)
+    }
+}
+
+func TestApplyFilters_KeepsUnknownSizeAndPages(t *testing.T) {
+    books := []Book{
+        {Title: "A", Meta: Metadata{Pages: 700, SizeBytes: 2 << 20}},
+        {Title: "B", Meta: Metadata{}},
+        {Title: "C", Meta: Metadata{Pages: 50}},
+        {Title: "D", Meta: Metadata{SizeBytes: 80 << 20}},
+    }
+    got := ApplyFilters(books, ByMaxSize(50<<20), ByMinPages(100))
+    if names := titles(got); len(names) != 2 || names[0] != "A" || names[1] != "B" {
+        t.Fatalf("ApplyFilters = %v, want [A B]", names)
+    }
+}
+
+func TestParseYearRange(t *testing.T) {
+    cases := []struct {
+        in       string
+        min, max int
+    }{
+        {"1990..2010", 1990, 2010},
+        {"1990..", 1990, 0},
+        {"..2010", 0, 2010},
+        {"2001", 2001, 2001},
+    }
+    for _, tc := range cases {
+        min, max, err := ParseYearRange(tc.in)
+        if err != nil || min != tc.min || max != tc.max {
+            t.Fatalf("ParseYearRange(%q) = %d, %d, %v", tc.in, min, max, err)
+        }
+    }
+    for _, in := range []string{"2010..1990", "abc", "1990..x", "..", ""} {
+        if _, _, err := ParseYearRange(in); err == nil {
+            t.Fatalf("ParseYearRange(%q): expected error", in)
+        }
+    }
+}
+
+func TestExcludeAuthors_Fuzzy(t *testing.T) {
+    books := []Book{
+        {Title: "A", Authors: "Fyodor Dostoyevsky"},
+        {Title: "B", Authors: "Émile Zola"},
+        {Title: "C", Authors: "Leo Tolstoy"},
+    }
+    got := ApplyFilters(books, ExcludeAuthors("dostoevsky", "emile zola"))
+    if names := titles(got); len(names) != 1 || names[0] != "C" {
+        t.Fatalf("ExcludeAuthors = %v, want [C]", names)
+    }
+}
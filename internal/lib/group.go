@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+)
+
+// Work is a cluster of books that are editions or formats of the same work.
+type Work struct {
+	Title  string
+	Author string
+	Books  []Book
+	// Numbers holds the position of each of Books in the list given to
+	// GroupWorks, counting from 1, so that a grouped view can number books
+	// like the flat list saved as the session.
+	Numbers []int
+}
+
+// Formats returns the distinct formats of the work's books in order of
+// appearance.
+func (w Work) Formats() []string {
+	var formats []string
+	seen := make(map[string]bool)
+	for _, b := range w.Books {
+		ext := strings.ToLower(strings.TrimSpace(b.Extension))
+		if ext != "" && !seen[ext] {
+			seen[ext] = true
+			formats = append(formats, ext)
+		}
+	}
+	return formats
+}
+
+// YearRange returns the earliest and latest known publication years, or
+// zeros if none is known.
+func (w Work) YearRange() (int, int) {
+	var min, max int
+	for _, b := range w.Books {
+		year := b.Meta.Year
+		if year == 0 {
+			continue
+		}
+		if min == 0 || year < min {
+			min = year
+		}
+		if year > max {
+			max = year
+		}
+	}
+	return min, max
+}
+
+// GroupWorks clusters books into works. Books belong to the same work when
+// their normalized title and primary author match or when they share an
+// ISBN. Works are ordered by their first book, so a ranked result list
+// stays ranked, and books keep their relative order within a work.
+func GroupWorks(books []Book) []Work {
+	parent := make([]int, len(books))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(a, b int) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// Keep the earliest book as root so works stay in result order.
+		if rb < ra {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+	}
+
+	byKey := make(map[string]int)
+	byISBN := make(map[string]int)
+	for i, b := range books {
+		if key := workKey(b); key != "" {
+			if first, ok := byKey[key]; ok {
+				union(first, i)
+			} else {
+				byKey[key] = i
+			}
+		}
+		for _, isbn := range b.ISBN {
+			if first, ok := byISBN[isbn]; ok {
+				union(first, i)
+			} else {
+				byISBN[isbn] = i
+			}
+		}
+	}
+
+	index := make(map[int]int)
+	var works []Work
+	for i, b := range books {
+		root := find(i)
+		w, ok := index[root]
+		if !ok {
+			w = len(works)
+			index[root] = w
+			works = append(works, Work{Title: strings.TrimSpace(b.Title), Author: primaryAuthor(b)})
+		}
+		works[w].Books = append(works[w].Books, b)
+		works[w].Numbers = append(works[w].Numbers, i+1)
+	}
+
+	return works
+}
+
+// workKey identifies a work by normalized title and primary author. It is
+// empty for a book with neither, which cannot be matched to others.
+func workKey(b Book) string {
+	title, author := normalizeTitle(b.Title), normalizeName(primaryAuthor(b))
+	if title == "" && author == "" {
+		return ""
+	}
+	return title + "|" + author
+}
+
+// primaryAuthor returns the first author, preferring the normalized name.
+func primaryAuthor(b Book) string {
+	if len(b.Meta.Authors) > 0 {
+		return b.Meta.Authors[0]
+	}
+	return strings.TrimSpace(strings.Split(b.Authors, ";")[0])
+}
+
+var (
+	bracketedRegex = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+	nonWordRegex   = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+	leadingArticle = regexp.MustCompile(`^(the|a|an) `)
+)
+
+// normalizeTitle reduces a title to a comparable key: folded case and
+// diacritics, without subtitle, bracketed notes, punctuation or a leading
+// article.
+func normalizeTitle(title string) string {
+	title = fuzzy.Fold(title)
+	if i := strings.IndexAny(title, ":;"); i > 0 {
+		title = title[:i]
+	}
+	title = bracketedRegex.ReplaceAllString(title, " ")
+	title = strings.TrimSpace(nonWordRegex.ReplaceAllString(title, " "))
+	return leadingArticle.ReplaceAllString(title, "")
+}
+
+// normalizeName reduces a person's name to a comparable key.
+func normalizeName(name string) string {
+	return strings.TrimSpace(nonWordRegex.ReplaceAllString(fuzzy.Fold(name), " "))
+}
@@ -0,0 +1,72 @@
+package lib
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+    cases := map[string]string{
+        "The Iliad":                              "iliad",
+        "The Iliad: A New Translation":           "iliad",
+        "Iliad (Penguin Classics)":               "iliad",
+        "  War and Peace [Illustrated], Vol. 1 ": "war and peace vol 1",
+        "Der Prozeß":                             "der prozess",
+    }
+    for in, want := range cases {
+        if got := normalizeTitle(in); got != want {
+            t.Fatalf("normalizeTitle(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestGroupWorks(t *testing.T) {
+    books := []Book{
+        {ID: "1", Title: "The Iliad", Authors: "Homer; Fagles, Robert", Extension: "epub", Meta: Metadata{Year: 1998}},
+        {ID: "2", Title: "Dubliners", Authors: "Joyce, James", Extension: "epub"},
+        {ID: "3", Title: "Iliad (Penguin Classics)", Authors: "Homer", Extension: "pdf", Meta: Metadata{Year: 1990}},
+        {ID: "4", Title: "Ilias", Authors: "Homeros", Extension: "mobi", ISBN: []string{"9780140275360"}},
+        {ID: "5", Title: "The Iliad: Fagles translation", Authors: "Homer", ISBN: []string{"9780140275360"}, Extension: "epub"},
+    }
+    for i := range books {
+        books[i].Meta.Authors = parseAuthors(books[i].Authors)
+    }
+
+    works := GroupWorks(books)
+    if len(works) != 2 {
+        t.Fatalf("expected 2 works, got %d: %#v", len(works), works)
+    }
+
+    iliad := works[0]
+    if iliad.Title != "The Iliad" || iliad.Author != "Homer" || len(iliad.Books) != 4 {
+        t.Fatalf("unexpected first work: %#v", iliad)
+    }
+    var ids string
+    for _, b := range iliad.Books {
+        ids += b.ID
+    }
+    if ids != "1345" {
+        t.Fatalf("editions out of order: %s", ids)
+    }
+    if n := iliad.Numbers; len(n) != 4 || n[0] != 1 || n[1] != 3 || n[2] != 4 || n[3] != 5 {
+        t.Fatalf("Numbers = %v, want [1 3 4 5]", n)
+    }
+    if formats := iliad.Formats(); len(formats) != 3 || formats[0] != "epub" {
+        t.Fatalf("Formats = %v", formats)
+    }
+    if min, max := iliad.YearRange(); min != 1990 || max != 1998 {
+        t.Fatalf("YearRange = %d..%d", min, max)
+    }
+    if works[1].Title != "Dubliners" || works[1].Author != "James Joyce" || works[1].Numbers[0] != 2 {
+        t.Fatalf("unexpected second work: %#v", works[1])
+    }
+}
+
+func TestGroupWorks_KeepsUntitledBooksApart(t *testing.T) {
+    books := []Book{
+        {ID: "1", Extension: "epub"},
+        {ID: "2", Extension: "pdf"},
+        {ID: "3", Title: " ", Authors: "; ", Extension: "mobi"},
+    }
+
+    if works := GroupWorks(books); len(works) != 3 {
+        t.Fatalf("expected 3 works, got %d: %#v", len(works), works)
+    }
+}
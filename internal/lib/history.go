@@ -0,0 +1,131 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// historyFile is the append-only log of searches and downloads, one JSON
+// entry per line, in the data directory.
+const historyFile = "history.jsonl"
+
+// Kinds of history entries.
+const (
+	HistorySearch   = "search"
+	HistoryDownload = "download"
+)
+
+// Outcomes recorded in the history.
+const (
+	OutcomeOK        = "ok"
+	OutcomeNoResults = "no results"
+	OutcomeFailed    = "failed"
+)
+
+// HistoryEntry records one search or download.
+type HistoryEntry struct {
+	Kind     string    `json:"kind"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+
+	// Query and Args describe a search: the search term and the command
+	// line it was run with. Results is the number of books found.
+	Query   string   `json:"query,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Results int      `json:"results,omitempty"`
+
+	// Book and File describe a download: the exact edition chosen and
+	// where it was saved.
+	Book *Book  `json:"book,omitempty"`
+	File string `json:"file,omitempty"`
+}
+
+// Label returns the query of a search or the title of a downloaded book.
+func (e HistoryEntry) Label() string {
+	if e.Book != nil {
+		return e.Book.Title
+	}
+	return e.Query
+}
+
+// AppendHistory adds e to the end of the history log.
+func AppendHistory(e HistoryEntry) error {
+	path, err := paths.DataFile(historyFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// LoadHistory returns every entry of the history log, oldest first. Lines
+// that cannot be parsed are skipped.
+func LoadHistory() ([]HistoryEntry, error) {
+	path, err := paths.DataFile(historyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	// Entries hold a whole book, which can exceed the default line limit.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			logger.Debugf("Skipping unreadable history entry: %v\n", err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// recordHistory appends e, logging rather than failing if it cannot.
+func recordHistory(e HistoryEntry) {
+	e.Finished = time.Now()
+	if err := AppendHistory(e); err != nil {
+		logger.Debugf("Failed to record history: %v\n", err)
+	}
+}
+
+// outcome returns the outcome and error message of an operation.
+func outcome(err error, found bool) (string, string) {
+	switch {
+	case err != nil:
+		return OutcomeFailed, err.Error()
+	case !found:
+		return OutcomeNoResults, ""
+	}
+	return OutcomeOK, ""
+}
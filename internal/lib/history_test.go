@@ -0,0 +1,70 @@
+package lib
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestHistory_AppendAndLoad(t *testing.T) {
+    dir := t.TempDir()
+    t.Setenv("TOSHI_DATA_DIR", dir)
+
+    if entries, err := LoadHistory(); err != nil || len(entries) != 0 {
+        t.Fatalf("LoadHistory = %v, %v, want empty", entries, err)
+    }
+
+    book := Book{ID: "7", Title: "The Iliad", MD5: "0123456789abcdef0123456789abcdef"}
+    if err := AppendHistory(HistoryEntry{Kind: HistorySearch, Query: "iliad", Args: []string{"iliad", "--lang", "en"}, Results: 3, Outcome: OutcomeOK}); err != nil {
+        t.Fatalf("AppendHistory error = %v", err)
+    }
+    if err := AppendHistory(HistoryEntry{Kind: HistoryDownload, Book: &book, File: "/tmp/iliad.epub", Outcome: OutcomeOK}); err != nil {
+        t.Fatalf("AppendHistory error = %v", err)
+    }
+
+    // A corrupt line must not hide the rest of the history.
+    f, err := os.OpenFile(filepath.Join(dir, historyFile), os.O_APPEND|os.O_WRONLY, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f.WriteString("{not json\n")
+    f.Close()
+
+    entries, err := LoadHistory()
+    if err != nil {
+        t.Fatalf("LoadHistory error = %v", err)
+    }
+    if len(entries) != 2 {
+        t.Fatalf("got %d entries, want 2", len(entries))
+    }
+    if entries[0].Label() != "iliad" || entries[0].Args[2] != "en" {
+        t.Fatalf("unexpected search entry: %#v", entries[0])
+    }
+    if entries[1].Label() != "The Iliad" || entries[1].Book.MD5 != book.MD5 {
+        t.Fatalf("unexpected download entry: %#v", entries[1])
+    }
+}
+
+func TestSearch_RecordsHistory(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+    srv := newDoctorServer(t, doctorRow, "")
+
+    before := time.Now()
+    if _, err := Search(newTestSite(srv.URL+"/search.php"), "iliad", SearchOptions{Args: []string{"iliad"}}); err != nil {
+        t.Fatalf("Search error = %v", err)
+    }
+
+    entries, err := LoadHistory()
+    if err != nil || len(entries) != 1 {
+        t.Fatalf("LoadHistory = %#v, %v, want one entry", entries, err)
+    }
+    e := entries[0]
+    if e.Kind != HistorySearch || e.Query != "iliad" || e.Results != 1 || e.Outcome != OutcomeOK {
+        t.Fatalf("unexpected entry: %#v", e)
+    }
+    if e.Started.Before(before) || e.Finished.Before(e.Started) {
+        t.Fatalf("timestamps out of order: %v, %v", e.Started, e.Finished)
+    }
+}
@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// jsonList is a list of items numbered by increasing IDs that are never
+// reused, such as the wishlist and the watchlist.
+type jsonList[T any] struct {
+	NextID int
+	Items  []T
+}
+
+// listFile describes how a jsonList is stored: as {"next_id": n, key: [...]}
+// in the data directory file name.
+type listFile struct {
+	name string
+	key  string
+	what string // the list in error messages
+}
+
+// loadJSONList reads the list stored in f, returning an empty one if none is
+// saved.
+func loadJSONList[T any](f listFile) (jsonList[T], error) {
+	l := jsonList[T]{NextID: 1}
+	path, err := paths.DataFile(f.name)
+	if err != nil {
+		return l, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, fmt.Errorf("failed to load %s: %w", f.what, err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return l, fmt.Errorf("failed to load %s: %w", f.what, err)
+	}
+	if raw, ok := fields["next_id"]; ok {
+		if err := json.Unmarshal(raw, &l.NextID); err != nil {
+			return l, fmt.Errorf("failed to load %s: %w", f.what, err)
+		}
+	}
+	if raw, ok := fields[f.key]; ok {
+		if err := json.Unmarshal(raw, &l.Items); err != nil {
+			return l, fmt.Errorf("failed to load %s: %w", f.what, err)
+		}
+	}
+	return l, nil
+}
+
+// save writes the list to f.
+func (l *jsonList[T]) save(f listFile) error {
+	path, err := paths.DataFile(f.name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"next_id": l.NextID, f.key: l.Items}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := paths.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save %s: %w", f.what, err)
+	}
+	return nil
+}
+
+// add appends the item newItem returns for the next ID, and returns it.
+func (l *jsonList[T]) add(newItem func(id int) T) T {
+	if l.NextID < 1 {
+		l.NextID = 1
+	}
+	item := newItem(l.NextID)
+	l.NextID++
+	l.Items = append(l.Items, item)
+	return item
+}
+
+// remove deletes the item whose ID, as returned by idOf, is id. It reports
+// whether there was one.
+func (l *jsonList[T]) remove(id int, idOf func(T) int) bool {
+	for i, item := range l.Items {
+		if idOf(item) == id {
+			l.Items = append(l.Items[:i], l.Items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
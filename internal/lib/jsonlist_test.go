@@ -0,0 +1,37 @@
+package lib
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestJSONList_KeepsFileFormat(t *testing.T) {
+    dir := t.TempDir()
+    t.Setenv("TOSHI_DATA_DIR", dir)
+    path := filepath.Join(dir, watchlistFile)
+    saved := `{"next_id": 4, "watches": [{"id": 3, "query": "the iliad", "args": null, "added": "2024-01-02T00:00:00Z"}]}`
+    if err := os.WriteFile(path, []byte(saved), 0o644); err != nil {
+        t.Fatal(err)
+    }
+
+    w, err := LoadWatchlist()
+    if err != nil || len(w.Items) != 1 || w.Items[0].ID != 3 || w.NextID != 4 {
+        t.Fatalf("LoadWatchlist = %#v, %v", w, err)
+    }
+    if watch := w.Add("the odyssey", nil); watch.ID != 4 {
+        t.Fatalf("new watch ID = %d, want 4", watch.ID)
+    }
+    if err := w.Save(); err != nil {
+        t.Fatalf("Save error = %v", err)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), `"next_id": 5`) || !strings.Contains(string(data), `"watches": [`) {
+        t.Fatalf("saved watchlist = %s", data)
+    }
+}
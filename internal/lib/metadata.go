@@ -0,0 +1,224 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Metadata holds the typed, normalized form of a Book's scraped fields.
+// Zero values mean the field was missing or could not be parsed.
+type Metadata struct {
+	Authors   []string `json:"authors,omitempty"` // "First Last" order
+	Year      int      `json:"year,omitempty"`
+	Pages     int      `json:"pages,omitempty"`
+	SizeBytes int64    `json:"size_bytes,omitempty"`
+	Language  string   `json:"language,omitempty"` // ISO 639-1 code, ISO 639-3 when there is no two-letter code
+}
+
+// ParseMetadata derives the typed metadata from the raw fields of b. Sources
+// call it for the books they create.
+func ParseMetadata(b Book) Metadata {
+	size, _ := ParseSize(b.Size)
+	return Metadata{
+		Authors:   parseAuthors(b.Authors),
+		Year:      parseYear(b.Year),
+		Pages:     parsePages(b.Pages),
+		SizeBytes: size,
+		Language:  languageCode(b.Language),
+	}
+}
+
+var yearRegex = regexp.MustCompile(`\b(1[0-9]{3}|20[0-9]{2})\b`)
+
+// parseYear returns the first plausible year in s, e.g. 2004 for "2004; 2010".
+func parseYear(s string) int {
+	match := yearRegex.FindString(s)
+	if match == "" {
+		return 0
+	}
+	year, _ := strconv.Atoi(match)
+	return year
+}
+
+var numberRegex = regexp.MustCompile(`\d+`)
+
+// parsePages returns the first page count in s, e.g. 333 for "333[340]".
+func parsePages(s string) int {
+	match := numberRegex.FindString(s)
+	if match == "" {
+		return 0
+	}
+	pages, _ := strconv.Atoi(match)
+	return pages
+}
+
+var sizeRegex = regexp.MustCompile(`(?i)^\s*(\d+(?:[.,]\d+)?)\s*([kmgt]?i?b?|bytes?)\s*$`)
+
+var sizeUnits = map[byte]int64{
+	'k': 1 << 10,
+	'm': 1 << 20,
+	'g': 1 << 30,
+	't': 1 << 40,
+}
+
+// ParseSize converts a human readable size such as "1 Mb", "512 kB" or
+// "50MB" to bytes. Units are binary, as displayed by the site.
+func ParseSize(s string) (int64, error) {
+	match := sizeRegex.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	unit := strings.ToLower(match[2])
+	multiplier := int64(1)
+	if unit != "" {
+		if m, ok := sizeUnits[unit[0]]; ok {
+			multiplier = m
+		}
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// FormatSize formats a size in bytes like the site does, e.g. "1.5 Mb" or
+// "340 Kb". It returns "" for an unknown size.
+func FormatSize(size int64) string {
+	switch {
+	case size <= 0:
+		return ""
+	case size < 1<<20:
+		return fmt.Sprintf("%d Kb", (size+1<<9)>>10)
+	default:
+		return fmt.Sprintf("%.1f Mb", float64(size)/(1<<20))
+	}
+}
+
+// parseAuthors splits the semicolon separated author list and normalizes
+// "Last, First" names to "First Last". A part containing several commas is
+// treated as a comma separated list of names.
+func parseAuthors(s string) []string {
+	var authors []string
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		names := strings.Split(part, ",")
+		switch {
+		case len(names) == 2 && isSurnameFirst(names[0], names[1]):
+			authors = append(authors, joinName(names[1], names[0]))
+		case len(names) > 1:
+			for _, name := range names {
+				if name = strings.Join(strings.Fields(name), " "); name != "" {
+					authors = append(authors, name)
+				}
+			}
+		default:
+			authors = append(authors, strings.Join(strings.Fields(part), " "))
+		}
+	}
+	return authors
+}
+
+// isSurnameFirst reports whether "last, first" looks like a single inverted
+// name rather than two separate authors: a one-word surname followed by
+// given names of at most one word and initials, such as "Leo" or "J. R. R.".
+// A full name after the comma, as in "Homer, Robert Fagles", a role in
+// parentheses or a further separator make it a list.
+func isSurnameFirst(last, first string) bool {
+	if len(strings.Fields(last)) != 1 || strings.ContainsAny(first, "()&") {
+		return false
+	}
+	given := strings.Fields(first)
+	if len(given) == 0 || len(given) > 3 {
+		return false
+	}
+	words := 0
+	for _, name := range given {
+		if !isInitial(name) {
+			words++
+		}
+	}
+	return words <= 1
+}
+
+// isInitial reports whether name is an initial or run of initials such as
+// "J." or "J.R.R.".
+func isInitial(name string) bool {
+	letters := 0
+	for _, part := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if utf8.RuneCountInString(part) != 1 {
+			return false
+		}
+		letters++
+	}
+	return letters > 0 && (letters > 1 || strings.HasSuffix(name, "."))
+}
+
+func joinName(first, last string) string {
+	return strings.Join(append(strings.Fields(first), strings.Fields(last)...), " ")
+}
+
+// languageCodes maps language names used by the site to ISO 639 codes.
+var languageCodes = map[string]string{
+	"arabic":        "ar",
+	"bulgarian":     "bg",
+	"chinese":       "zh",
+	"czech":         "cs",
+	"danish":        "da",
+	"dutch":         "nl",
+	"english":       "en",
+	"finnish":       "fi",
+	"french":        "fr",
+	"german":        "de",
+	"greek":         "el",
+	"hebrew":        "he",
+	"hindi":         "hi",
+	"hungarian":     "hu",
+	"indonesian":    "id",
+	"italian":       "it",
+	"japanese":      "ja",
+	"korean":        "ko",
+	"latin":         "la",
+	"norwegian":     "no",
+	"persian":       "fa",
+	"polish":        "pl",
+	"portuguese":    "pt",
+	"romanian":      "ro",
+	"russian":       "ru",
+	"serbian":       "sr",
+	"spanish":       "es",
+	"swedish":       "sv",
+	"turkish":       "tr",
+	"ukrainian":     "uk",
+	"vietnamese":    "vi",
+	"ancient greek": "grc",
+	"old english":   "ang",
+}
+
+// languageCode returns the ISO 639 code of the first language in s. Values
+// that already are two or three letter codes are returned lowercased.
+func languageCode(s string) string {
+	first := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' })
+	if len(first) == 0 {
+		return ""
+	}
+
+	name := strings.ToLower(strings.TrimSpace(first[0]))
+	if code, ok := languageCodes[name]; ok {
+		return code
+	}
+	if len(name) == 2 || len(name) == 3 {
+		return name
+	}
+	return ""
+}
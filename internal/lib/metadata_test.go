@@ -0,0 +1,78 @@
+package lib
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestParseYear(t *testing.T) {
+    cases := map[string]int{"2004; 2010": 2004, "1998": 1998, "": 0, "n/a": 0, "12345": 0}
+    for in, want := range cases {
+        if got := parseYear(in); got != want {
+            t.Fatalf("parseYear(%q) = %d, want %d", in, got, want)
+        }
+    }
+}
+
+func TestParsePages(t *testing.T) {
+    cases := map[string]int{"333[340]": 333, "704": 704, "": 0, "xii": 0}
+    for in, want := range cases {
+        if got := parsePages(in); got != want {
+            t.Fatalf("parsePages(%q) = %d, want %d", in, got, want)
+        }
+    }
+}
+
+func TestParseSize(t *testing.T) {
+    cases := map[string]int64{
+        "1 Mb":   1 << 20,
+        "512 kB": 512 << 10,
+        "50MB":   50 << 20,
+        "1.5 Gb": 3 << 29,
+        "100":    100,
+        "2 bytes": 2,
+    }
+    for in, want := range cases {
+        got, err := ParseSize(in)
+        if err != nil || got != want {
+            t.Fatalf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+        }
+    }
+    if _, err := ParseSize("big"); err == nil {
+        t.Fatal("expected error for invalid size")
+    }
+}
+
+func TestParseAuthors(t *testing.T) {
+    cases := map[string][]string{
+        "Homer; Fagles, Robert":       {"Homer", "Robert Fagles"},
+        "Tolstoy, Leo":                {"Leo Tolstoy"},
+        "Tolkien, J. R. R.":           {"J. R. R. Tolkien"},
+        "Homer, Robert Fagles":        {"Homer", "Robert Fagles"},
+        "Fagles, Robert (translator)": {"Fagles", "Robert (translator)"},
+        "Jane Doe, John Roe, Ann Poe": {"Jane Doe", "John Roe", "Ann Poe"},
+        "  ":                          nil,
+    }
+    for in, want := range cases {
+        if got := parseAuthors(in); !reflect.DeepEqual(got, want) {
+            t.Fatalf("parseAuthors(%q) = %#v, want %#v", in, got, want)
+        }
+    }
+}
+
+func TestLanguageCode(t *testing.T) {
+    cases := map[string]string{"English": "en", "German, English": "de", "RU": "ru", "Klingon": "", "": ""}
+    for in, want := range cases {
+        if got := languageCode(in); got != want {
+            t.Fatalf("languageCode(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestFileName_UsesMetadata(t *testing.T) {
+    b := Book{Authors: "Fagles, Robert", Title: "The Iliad", Year: "1990; 1998", Extension: "epub"}
+    b.Meta = ParseMetadata(b)
+    if got, want := fileName(b), "Robert Fagles - The Iliad - 1990.epub"; got != want {
+        t.Fatalf("fileName = %q, want %q", got, want)
+    }
+}
@@ -3,6 +3,9 @@ package lib
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/mfkd/toshi/internal/logger"
@@ -15,46 +18,142 @@ type UI interface {
 	SelectBook(books []Book) *Book
 }
 
-// ProcessBooks handles the user selection, fetches download links, and attempts to download the selected book.
-func ProcessBooks(s *scraper.Scraper, searchTerm string, ui UI) error {
+// MultiUI is implemented by interfaces that can select several books at
+// once. ProcessBooks downloads each of them.
+type MultiUI interface {
+	SelectBooks(books []Book) []Book
+}
+
+// SearchOptions controls how search results are filtered and ordered.
+type SearchOptions struct {
+	Filters     []Filter
+	Sort        string
+	Preferences Preferences
+
+	// Args is the command line of the search, kept in the history so the
+	// search can be run again.
+	Args []string
+}
+
+// Search searches src for searchTerm and returns the books accepted by all
+// filters, ordered by opts.Sort. The search is recorded in the history.
+// Callers showing the results to the user save them with SaveSession.
+func Search(src Source, searchTerm string, opts SearchOptions) ([]Book, error) {
+	entry := HistoryEntry{Kind: HistorySearch, Started: time.Now(), Query: searchTerm, Args: opts.Args}
+	books, err := SearchWithoutHistory(src, searchTerm, opts)
+	entry.Results = len(books)
+	entry.Outcome, entry.Error = outcome(err, len(books) > 0)
+	recordHistory(entry)
+	return books, err
+}
+
+// SearchWithoutHistory is Search for searches the user did not type, such
+// as those of the wishlist, which are not recorded in the history.
+func SearchWithoutHistory(src Source, searchTerm string, opts SearchOptions) ([]Book, error) {
 	// Create a context with a timeout for fetching books
 	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
 	defer cancel()
 
-	books, err := fetchAllBooks(ctx, s, searchTerm)
+	books, err := src.Search(ctx, searchTerm)
 	if err != nil {
-		return fmt.Errorf("error fetching books from pages: %w", err)
+		return nil, err
+	}
+	for i := range books {
+		books[i].Position = i + 1
 	}
 
-	// Allow the user to select a book from the filtered list (e.g., EPUB books)
-	// TODO: Make user select extension type as an argument
-	selectedBook := ui.SelectBook(filterEPUB(books))
-	if selectedBook == nil {
-		fmt.Println("No book selected.")
-		return nil
+	books = ApplyFilters(books, opts.Filters...)
+	if err := SortBooks(books, opts.Sort, searchTerm, opts.Preferences); err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("Selected Book: %s\n", selectedBook.Title)
+	if opts.Sort == SortRelevance || opts.Sort == "" {
+		for i, b := range books {
+			logger.Debugf("#%d %s: %s\n", i+1, b.Title, ScoreBook(b, searchTerm, opts.Preferences))
+		}
+	}
 
-	// Create a new context for download link operations
-	ctx, cancel = context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+	return books, nil
+}
 
-	// Fetch download links for the selected book
-	downloadLinks, err := fetchDownloadLinks(ctx, s, *selectedBook)
+// ProcessBooks handles the user selection, fetches download links, and attempts to download the selected book.
+// The results are saved as the last session so 'toshi get' can pick from them.
+func ProcessBooks(c Catalog, searchTerm string, ui UI, opts SearchOptions) error {
+	books, err := Search(c, searchTerm, opts)
 	if err != nil {
-		return fmt.Errorf("failed to fetch download links: %w", err)
+		return err
+	}
+	if err := SaveSession(searchTerm, books); err != nil {
+		logger.Debugf("Failed to save results: %v\n", err)
+	}
+
+	// Allow the user to select a book from the filtered list
+	var selected []Book
+	if multi, ok := ui.(MultiUI); ok {
+		selected = multi.SelectBooks(books)
+	} else if b := ui.SelectBook(books); b != nil {
+		selected = []Book{*b}
 	}
+	if len(selected) == 0 {
+		fmt.Println("No book selected.")
+		return nil
+	}
+
+	var failed int
+	for _, b := range selected {
+		fmt.Printf("Selected Book: %s\n", b.Title)
+		if _, err := DownloadBook(c, b, os.Stdout); err != nil {
+			if len(selected) == 1 {
+				return err
+			}
+			logger.Errorf("Skipping %s: %v", b.Title, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(selected))
+	}
+	return nil
+}
 
-	fileName := fileName(*selectedBook)
+// DownloadBook resolves the download links for b with its source and
+// downloads it to the output directory, returning the file name used.
+// Progress is written to progress. The download is recorded in the history.
+func DownloadBook(c Catalog, b Book, progress io.Writer) (string, error) {
+	entry := HistoryEntry{Kind: HistoryDownload, Started: time.Now(), Book: &b}
+	name, err := downloadBook(c, b, progress)
+	if name != "" {
+		entry.File = filepath.Join(downloadDir, name)
+		if abs, err := filepath.Abs(entry.File); err == nil {
+			entry.File = abs
+		}
+	}
+	entry.Outcome, entry.Error = outcome(err, true)
+	recordHistory(entry)
+	return name, err
+}
+
+func downloadBook(c Catalog, b Book, progress io.Writer) (string, error) {
+	fileName := fileName(b)
 	logger.Debugf("Attempting to download book to: %s\n", fileName)
 
 	// Attempt to download the file
-	if err := tryDownloadLinks(ctx, s, downloadLinks, fileName); err != nil {
-		logger.Errorf("Failed to download file for book %s: %v", selectedBook.Title, err)
-		return fmt.Errorf("failed to download book: %w", err)
+	var files scraper.FileDownloader = c
+	if m, ok := c.(*MultiSource); ok {
+		files = m.DownloaderFor(b)
+	}
+	if err := downloadMirrors(c, files, b, fileName); err != nil {
+		logger.Errorf("Failed to download file for book %s: %v", b.Title, err)
+		return "", fmt.Errorf("failed to download book: %w", err)
 	}
 
-	fmt.Printf("Book downloaded successfully as %s\n", fileName)
-	return nil
+	fmt.Fprintf(progress, "Book downloaded successfully as %s\n", fileName)
+	return fileName, nil
+}
+
+// reportLayoutProblems runs Diagnose and prints the report if a check failed.
+func reportLayoutProblems(ctx context.Context, s *Site, searchTerm string) {
+	if report := Diagnose(ctx, s, searchTerm); !report.OK() {
+		report.Write(os.Stderr)
+	}
 }
@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+)
+
+// Sort keys accepted by SortBooks.
+const (
+	SortRelevance = "relevance"
+	SortYear      = "year"
+	SortTitle     = "title"
+	SortSize      = "size"
+	SortPages     = "pages"
+	SortNone      = "none"
+)
+
+// SortKeys lists the valid sort keys, default first.
+var SortKeys = []string{SortRelevance, SortYear, SortTitle, SortSize, SortPages, SortNone}
+
+// Weights of the score components. They add up to one.
+const (
+	weightRelevance    = 0.45
+	weightCompleteness = 0.20
+	weightPreference   = 0.15
+	weightSize         = 0.10
+	weightRecency      = 0.10
+)
+
+// Preferences describe the formats and languages a user would rather get,
+// most preferred first.
+type Preferences struct {
+	Formats   []string
+	Languages []string
+}
+
+// Score is the breakdown of a book's ranking. Every component is in [0, 1].
+type Score struct {
+	Relevance    float64
+	Completeness float64
+	Preference   float64
+	Size         float64
+	Recency      float64
+	Total        float64
+}
+
+// String formats the score breakdown for debug output.
+func (s Score) String() string {
+	return fmt.Sprintf("total %.3f = relevance %.2f, completeness %.2f, preference %.2f, size %.2f, recency %.2f",
+		s.Total, s.Relevance, s.Completeness, s.Preference, s.Size, s.Recency)
+}
+
+type scoredBook struct {
+	book  Book
+	score float64
+}
+
+// ScoreBook rates how well b answers query given the user's preferences.
+func ScoreBook(b Book, query string, prefs Preferences) Score {
+	s := Score{
+		Relevance:    relevance(b, query),
+		Completeness: completeness(b),
+		Preference:   preference(b, prefs),
+		Size:         sizeScore(b.Meta.SizeBytes),
+		Recency:      recency(b.Meta.Year),
+	}
+	s.Total = weightRelevance*s.Relevance +
+		weightCompleteness*s.Completeness +
+		weightPreference*s.Preference +
+		weightSize*s.Size +
+		weightRecency*s.Recency
+	return s
+}
+
+// SortBooks orders books in place by key. Relevance sorts by descending
+// score against query, the other keys ignore query and prefs. SortNone
+// restores the order the sources returned the books in.
+func SortBooks(books []Book, key, query string, prefs Preferences) error {
+	var less func(a, b Book) bool
+
+	switch key {
+	case SortRelevance, "":
+		scored := make([]scoredBook, len(books))
+		for i, b := range books {
+			scored[i] = scoredBook{book: b, score: ScoreBook(b, query, prefs).Total}
+		}
+		sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+		for i := range scored {
+			books[i] = scored[i].book
+		}
+		return nil
+	case SortYear:
+		less = func(a, b Book) bool { return a.Meta.Year > b.Meta.Year }
+	case SortTitle:
+		less = func(a, b Book) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case SortSize:
+		less = func(a, b Book) bool { return a.Meta.SizeBytes < b.Meta.SizeBytes }
+	case SortPages:
+		less = func(a, b Book) bool { return a.Meta.Pages > b.Meta.Pages }
+	case SortNone:
+		less = func(a, b Book) bool { return a.Position < b.Position }
+	default:
+		return fmt.Errorf("unknown sort key %q, expected one of %s", key, strings.Join(SortKeys, ", "))
+	}
+
+	sort.SliceStable(books, func(i, j int) bool { return less(books[i], books[j]) })
+	return nil
+}
+
+// minPrefixLen is the shortest word that counts as a prefix of another, so
+// that a query word such as "a" does not match every word starting with it.
+const minPrefixLen = 3
+
+// relevance is the share of query words found in the title or authors,
+// ignoring case and diacritics. Words that only match as a prefix count
+// half, words matching with a typo count by their similarity.
+func relevance(b Book, query string) float64 {
+	terms := fuzzy.Words(query)
+	if len(terms) == 0 {
+		return 0
+	}
+
+	words := fuzzy.Words(b.Title + " " + b.Authors)
+
+	var matched float64
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range words {
+			if w == term {
+				best = 1
+				break
+			}
+			if (len(term) >= minPrefixLen && strings.HasPrefix(w, term)) ||
+				(len(w) >= minPrefixLen && strings.HasPrefix(term, w)) {
+				best = max(best, 0.5)
+			}
+		}
+		if best < 1 {
+			if sim := fuzzy.BestMatch(term, words); sim >= fuzzy.MatchThreshold {
+				best = max(best, sim)
+			}
+		}
+		matched += best
+	}
+
+	return matched / float64(len(terms))
+}
+
+// completeness is the share of ISBN, publisher, year and pages present.
+func completeness(b Book) float64 {
+	present := 0
+	if len(b.ISBN) > 0 {
+		present++
+	}
+	if strings.TrimSpace(b.Publisher) != "" {
+		present++
+	}
+	if b.Meta.Year > 0 {
+		present++
+	}
+	if b.Meta.Pages > 0 {
+		present++
+	}
+	return float64(present) / 4
+}
+
+// preference averages how early the book's format and language appear in
+// the preference lists. A list that is not set does not count.
+func preference(b Book, prefs Preferences) float64 {
+	var total float64
+	var n int
+	if len(prefs.Formats) > 0 {
+		total += rankIn(strings.ToLower(strings.TrimSpace(b.Extension)), prefs.Formats)
+		n++
+	}
+	if len(prefs.Languages) > 0 {
+		total += rankIn(b.Meta.Language, prefs.Languages)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// rankIn scores value by its position in list: 1 for the first entry
+// decreasing towards 0, and 0 when absent.
+func rankIn(value string, list []string) float64 {
+	for i, v := range list {
+		if strings.EqualFold(v, value) {
+			return 1 - float64(i)/float64(len(list))
+		}
+	}
+	return 0
+}
+
+// sizeScore favours files of a plausible size for a book. Tiny files are
+// often broken and huge ones are usually scans.
+func sizeScore(size int64) float64 {
+	switch {
+	case size <= 0:
+		return 0.5
+	case size < 20<<10:
+		return 0.1
+	case size < 100<<10:
+		return 0.6
+	case size <= 50<<20:
+		return 1
+	case size <= 200<<20:
+		return 0.6
+	default:
+		return 0.3
+	}
+}
+
+// recency maps the publication year linearly from 1900 to the current year.
+func recency(year int) float64 {
+	if year <= 0 {
+		return 0
+	}
+	const start = 1900
+	now := time.Now().Year()
+	switch {
+	case year <= start:
+		return 0
+	case year >= now:
+		return 1
+	}
+	return float64(year-start) / float64(now-start)
+}
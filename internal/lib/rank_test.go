@@ -0,0 +1,93 @@
+package lib
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestScoreBook_Breakdown(t *testing.T) {
+    b := Book{
+        Title:     "The Iliad",
+        Authors:   "Homer",
+        ISBN:      []string{"9780140275360"},
+        Publisher: "Penguin",
+        Extension: "epub",
+        Meta:      Metadata{Year: 1998, Pages: 704, SizeBytes: 2 << 20, Language: "en"},
+    }
+    s := ScoreBook(b, "iliad homer", Preferences{Formats: []string{"epub", "pdf"}, Languages: []string{"en"}})
+    if s.Relevance != 1 || s.Completeness != 1 || s.Preference != 1 || s.Size != 1 {
+        t.Fatalf("unexpected score: %s", s)
+    }
+    if s.Total <= 0.9 || s.Total > 1 {
+        t.Fatalf("total = %f, want in (0.9, 1]", s.Total)
+    }
+    if !strings.Contains(s.String(), "relevance 1.00") {
+        t.Fatalf("String() = %q", s.String())
+    }
+}
+
+func TestRelevance_PartialMatch(t *testing.T) {
+    b := Book{Title: "Iliad", Authors: "Homer"}
+    if got := relevance(b, "iliad odyssey"); got != 0.5 {
+        t.Fatalf("relevance = %f, want 0.5", got)
+    }
+    if got := relevance(b, "hom"); got != 0.5 {
+        t.Fatalf("prefix relevance = %f, want 0.5", got)
+    }
+}
+
+func TestRelevance_ShortTermsAreNotPrefixes(t *testing.T) {
+    b := Book{Title: "Anna Karenina", Authors: "Tolstoy"}
+    if got := relevance(b, "a"); got != 0 {
+        t.Fatalf("relevance of a one-letter term = %f, want 0", got)
+    }
+    if got := relevance(Book{Title: "An"}, "anthology"); got != 0 {
+        t.Fatalf("relevance of a short title word = %f, want 0", got)
+    }
+}
+
+func TestSortBooks_Relevance(t *testing.T) {
+    books := []Book{
+        {Title: "Commentary on Something"},
+        {Title: "The Iliad", Authors: "Homer", Publisher: "Penguin", Meta: Metadata{Year: 1998, Pages: 704}},
+        {Title: "The Iliad", Authors: "Homer"},
+    }
+    if err := SortBooks(books, SortRelevance, "iliad homer", Preferences{}); err != nil {
+        t.Fatalf("SortBooks error = %v", err)
+    }
+    if books[0].Publisher != "Penguin" || books[2].Title != "Commentary on Something" {
+        t.Fatalf("unexpected order: %v", titles(books))
+    }
+}
+
+func TestSortBooks_Keys(t *testing.T) {
+    books := []Book{
+        {Title: "b", Meta: Metadata{Year: 2001, SizeBytes: 3}},
+        {Title: "a", Meta: Metadata{Year: 2010, SizeBytes: 1}},
+        {Title: "c", Meta: Metadata{Year: 1990, SizeBytes: 2}},
+    }
+    cases := map[string]string{SortYear: "a b c", SortTitle: "a b c", SortSize: "a c b"}
+    for key, want := range cases {
+        sorted := append([]Book(nil), books...)
+        if err := SortBooks(sorted, key, "", Preferences{}); err != nil {
+            t.Fatalf("SortBooks(%s) error = %v", key, err)
+        }
+        if got := strings.Join(titles(sorted), " "); got != want {
+            t.Fatalf("SortBooks(%s) = %s, want %s", key, got, want)
+        }
+    }
+    if err := SortBooks(books, "color", "", Preferences{}); err == nil {
+        t.Fatal("expected error for unknown sort key")
+    }
+}
+
+func TestRelevance_FuzzyAndDiacritics(t *testing.T) {
+    b := Book{Title: "Der Prozeß", Authors: "Kafka, Franz"}
+    if got := relevance(b, "Kafka Prozess"); got != 1 {
+        t.Fatalf("relevance = %f, want 1", got)
+    }
+    b = Book{Title: "Crime and Punishment", Authors: "Dostoyevsky, Fyodor"}
+    if got := relevance(b, "dostoevsky"); got < 0.8 {
+        t.Fatalf("typo relevance = %f, want >= 0.8", got)
+    }
+}
@@ -5,20 +5,48 @@ import (
 	"net/url"
 )
 
+// Search columns understood by the site.
+const (
+	columnDefault    = "def"
+	columnIdentifier = "identifier"
+)
+
+// searchQuery describes one search request to the site.
+type searchQuery struct {
+	Term   string
+	Phrase bool
+	Column string
+}
+
+// defaultQuery returns the query toshi sends for a user's search term.
+func defaultQuery(term string) searchQuery {
+	return searchQuery{Term: term, Phrase: true, Column: columnDefault}
+}
+
 // pageURL returns the URL for the given search term and page number.
 func pageURL(searchBaseURL, term string, page int) string {
+	return queryURL(searchBaseURL, defaultQuery(term), page)
+}
+
+// queryURL returns the URL for the given query and page number.
+func queryURL(searchBaseURL string, q searchQuery, page int) string {
 	// Parse the base URL
 	baseURL, err := url.Parse(searchBaseURL)
 	if err != nil {
 		panic(fmt.Sprintf("invalid base URL: %s", searchBaseURL))
 	}
 
+	phrase := "0"
+	if q.Phrase {
+		phrase = "1"
+	}
+
 	// Add query parameters
 	params := url.Values{}
-	params.Add("req", term)
-	params.Add("phrase", "1")
+	params.Add("req", q.Term)
+	params.Add("phrase", phrase)
 	params.Add("view", "simple")
-	params.Add("column", "def")
+	params.Add("column", q.Column)
 	params.Add("sort", "def")
 	params.Add("sortmode", "ASC")
 	params.Add("page", fmt.Sprintf("%d", page)) // Add the page number
@@ -1,6 +1,11 @@
 package lib
 
-import "testing"
+import (
+    "strings"
+    "testing"
+
+    "github.com/PuerkitoBio/goquery"
+)
 
 func TestPageURL_PanicsOnInvalidBase(t *testing.T) {
     defer func() {
@@ -20,3 +25,53 @@ func TestPageURL(t *testing.T) {
         t.Fatalf("pageURL = %q, want %q", got, want)
     }
 }
+
+func mustDoc(t *testing.T, html string) *goquery.Document {
+    t.Helper()
+    doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+    if err != nil {
+        t.Fatalf("parse html: %v", err)
+    }
+    return doc
+}
+
+func TestPageCount(t *testing.T) {
+    cases := []struct {
+        name   string
+        html   string
+        pages  int
+        source string
+    }{
+        {"header", `<font>1,234 files found</font>`, 50, "header"},
+        {"header-single-page", `<font>7 files found</font>`, 1, "header"},
+        {"paginator", `<script>var x = 1, y = 2;</script><script>new Paginator("p", 12, 25, 1, "search.php?page=");</script>`, 12, "paginator"},
+        {"paginator-wins-mismatch", `<p>100 files found</p><script>new Paginator("p", 10, 25, 1, "s");</script>`, 10, "paginator"},
+        {"header-and-paginator-agree", `<p>100 files found</p><script>new Paginator("p", 4, 25, 1, "s");</script>`, 4, "header"},
+    }
+    for _, tc := range cases {
+        pages, source, err := pageCount(mustDoc(t, tc.html))
+        if err != nil {
+            t.Fatalf("%s: pageCount error: %v", tc.name, err)
+        }
+        if pages != tc.pages || source != tc.source {
+            t.Fatalf("%s: pageCount = %d (%s), want %d (%s)", tc.name, pages, source, tc.pages, tc.source)
+        }
+    }
+}
+
+func TestPageCount_NoInfo(t *testing.T) {
+    if _, _, err := pageCount(mustDoc(t, `<script>var unrelated = 1;</script>`)); err != errNoPageInfo {
+        t.Fatalf("pageCount error = %v, want errNoPageInfo", err)
+    }
+}
+
+func TestNextPageLink(t *testing.T) {
+    doc := mustDoc(t, `<a href="/a">prev</a><a href="search.php?page=3"> Next </a>`)
+    got := nextPageLink(doc, "https://books.xyz/search.php?page=2")
+    if got != "https://books.xyz/search.php?page=3" {
+        t.Fatalf("nextPageLink = %q", got)
+    }
+    if got := nextPageLink(mustDoc(t, `<a href="/a">prev</a>`), "https://books.xyz/"); got != "" {
+        t.Fatalf("nextPageLink without next = %q, want empty", got)
+    }
+}
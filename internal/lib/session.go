@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// sessionFile is where the last result set is kept, below the cache dir.
+const sessionFile = "last_results.json"
+
+// ErrNoSession is returned by LoadSession when no search has been saved.
+var ErrNoSession = errors.New("no saved search results, run a search first")
+
+// Session is the result set of the last search, kept so that its books can
+// be shown or downloaded by number without searching again.
+type Session struct {
+	Query string    `json:"query"`
+	Time  time.Time `json:"time"`
+	Books []Book    `json:"books"`
+}
+
+// SaveSession stores books, numbered in the order given, as the last
+// results for query.
+func SaveSession(query string, books []Book) error {
+	dir, err := paths.CacheSubdir("session")
+	if err != nil {
+		return err
+	}
+
+	if books == nil {
+		books = []Book{}
+	}
+	data, err := json.Marshal(Session{Query: query, Time: time.Now(), Books: books})
+	if err != nil {
+		return err
+	}
+
+	if err := paths.WriteFileAtomic(filepath.Join(dir, sessionFile), data); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// LoadSession returns the last saved results.
+func LoadSession() (*Session, error) {
+	dir, err := paths.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "session", sessionFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	return &session, nil
+}
+
+// Book returns the book numbered n, counting from 1.
+func (s *Session) Book(n int) (Book, error) {
+	if n < 1 || n > len(s.Books) {
+		return Book{}, fmt.Errorf("no result numbered %d in the last search for %q (%d results)", n, s.Query, len(s.Books))
+	}
+	return s.Books[n-1], nil
+}
@@ -0,0 +1,35 @@
+package lib
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestSession_SaveAndLoad(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+
+    if _, err := LoadSession(); !errors.Is(err, ErrNoSession) {
+        t.Fatalf("LoadSession error = %v, want ErrNoSession", err)
+    }
+
+    books := []Book{{ID: "1", Title: "The Iliad"}, {ID: "2", Title: "The Odyssey"}}
+    if err := SaveSession("homer", books); err != nil {
+        t.Fatalf("SaveSession error = %v", err)
+    }
+
+    session, err := LoadSession()
+    if err != nil {
+        t.Fatalf("LoadSession error = %v", err)
+    }
+    if session.Query != "homer" || session.Time.IsZero() || len(session.Books) != 2 {
+        t.Fatalf("unexpected session: %#v", session)
+    }
+
+    b, err := session.Book(2)
+    if err != nil || b.Title != "The Odyssey" {
+        t.Fatalf("Book(2) = %#v, %v", b, err)
+    }
+    if _, err := session.Book(3); err == nil {
+        t.Fatal("expected error for a number past the results")
+    }
+}
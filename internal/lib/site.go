@@ -0,0 +1,64 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+// Site is a catalog site with the search.php layout and the default Source:
+// the URL of its search page, how pages are fetched and how files are
+// downloaded. A *scraper.Scraper can serve as both, usually with middleware
+// around its pages, and tests can substitute fakes.
+type Site struct {
+	URL string
+	scraper.DocumentFetcher
+	scraper.FileDownloader
+}
+
+// Fetcher is anything that both fetches pages and downloads files, such as
+// a *scraper.Scraper.
+type Fetcher interface {
+	scraper.DocumentFetcher
+	scraper.FileDownloader
+}
+
+// NewSite returns a Site for the search page at url that fetches pages
+// through f wrapped in middleware and downloads files with f.
+func NewSite(url string, f Fetcher, middleware ...scraper.Middleware) *Site {
+	return &Site{
+		URL:             url,
+		DocumentFetcher: scraper.Chain(f, middleware...),
+		FileDownloader:  f,
+	}
+}
+
+func (s *Site) Name() string { return SiteSource }
+
+// Search fetches every result page for term. When nothing is found it
+// broadens the query, unless ctx is marked with exactSearch. When the pages
+// show a symptom of a layout change it checks the site layout.
+func (s *Site) Search(ctx context.Context, term string) ([]Book, error) {
+	books, broken, err := searchPages(ctx, s, defaultQuery(term))
+	if broken && ctx.Err() == nil {
+		// A missing results table or a pagination error are the usual
+		// symptoms of a layout change, so check the site before giving up.
+		reportLayoutProblems(ctx, s, term)
+	}
+	if err == nil && !broken && len(books) == 0 && !isExactSearch(ctx) {
+		books, err = searchBroadened(ctx, s, term)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching books from pages: %w", err)
+	}
+	return books, nil
+}
+
+func (s *Site) Details(ctx context.Context, b Book) (*Details, error) {
+	return fetchDetails(ctx, s, b)
+}
+
+func (s *Site) ResolveDownloads(ctx context.Context, b Book) ([]string, error) {
+	return fetchDownloadLinks(ctx, s, b)
+}
@@ -0,0 +1,111 @@
+package lib
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/PuerkitoBio/goquery"
+    "github.com/mfkd/toshi/internal/scraper"
+)
+
+// newTestSite returns a Site that reaches url with a plain scraper, without
+// the delay between pages.
+func newTestSite(url string) *Site {
+    return NewSite(url, scraper.NewScraper(url))
+}
+
+func TestNewSite_FakeFetcher(t *testing.T) {
+    page := `<table><tr valign="top"><td>7</td><td>Homer</td><td><a>The Iliad</a></td><td></td><td>1998</td><td></td><td>English</td><td></td><td>epub</td><td><a href="https://mirror.example/main/ABC">m</a></td><td></td></tr></table>`
+    var requested []string
+    fake := struct {
+        scraper.DocumentFetcherFunc
+        scraper.FileDownloaderFunc
+    }{
+        func(ctx context.Context, url string) (*goquery.Document, error) {
+            requested = append(requested, url)
+            return goquery.NewDocumentFromReader(strings.NewReader(page))
+        },
+        func(ctx context.Context, filename, url, dir string) error {
+            return errors.New("not implemented")
+        },
+    }
+
+    var counted int
+    count := func(next scraper.DocumentFetcher) scraper.DocumentFetcher {
+        return scraper.DocumentFetcherFunc(func(ctx context.Context, url string) (*goquery.Document, error) {
+            counted++
+            return next.ScrapeWithContext(ctx, url)
+        })
+    }
+    s := NewSite("https://books.example/search.php", fake, count)
+    books, err := fetchAllBooks(context.Background(), s, "iliad")
+    if err != nil {
+        t.Fatalf("fetchAllBooks error = %v", err)
+    }
+    if len(books) != 1 || books[0].Title != "The Iliad" {
+        t.Fatalf("unexpected books: %#v", books)
+    }
+    if counted != len(requested) || counted == 0 {
+        t.Fatalf("middleware counted %d requests, fetcher saw %d", counted, len(requested))
+    }
+}
+
+func TestSite_CachesSearchPagesAsSearches(t *testing.T) {
+    var searches int
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        searches++
+        fmt.Fprint(w, `<p>0 files found</p><table></table>`)
+    }))
+    t.Cleanup(srv.Close)
+
+    // The site of a source with its own URL, not the scraper's.
+    scr := scraper.NewScraper("https://default.example/search.php")
+    scr.Cache = &scraper.Cache{Dir: t.TempDir(), SearchTTL: 0, PageTTL: time.Hour, MaxBytes: 1 << 20}
+    s := NewSite(srv.URL+"/search.php", scr)
+
+    for i := 0; i < 2; i++ {
+        if _, err := fetchAllBooks(context.Background(), s, "iliad"); err != nil {
+            t.Fatalf("fetchAllBooks error = %v", err)
+        }
+    }
+    if searches != 2 {
+        t.Fatalf("search page fetched %d times, want 2 as search pages expire", searches)
+    }
+}
+
+func TestSiteSearch_ChecksLayoutOnlyOnSymptoms(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    for _, tc := range []struct {
+        name, page string
+        check      bool
+    }{
+        {"no results", `<p>0 files found</p><table><tr valign="top"><td>ID</td></tr></table>`, false},
+        {"no results table", `<p>0 files found</p>`, true},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            searches := 0
+            srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if r.URL.Query().Get("req") == "iliad" && r.URL.Query().Get("phrase") == "1" {
+                    searches++
+                }
+                fmt.Fprint(w, tc.page)
+            }))
+            t.Cleanup(srv.Close)
+
+            books, err := newTestSite(srv.URL+"/search.php").Search(context.Background(), "iliad")
+            if err != nil || len(books) != 0 {
+                t.Fatalf("Search() = %#v, %v", books, err)
+            }
+            // The layout check fetches the search page again.
+            if checked := searches > 1; checked != tc.check {
+                t.Fatalf("layout checked = %v, want %v", checked, tc.check)
+            }
+        })
+    }
+}
@@ -0,0 +1,409 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/paths"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+// SiteSource is the name and kind of the site set by DOMAIN or domains.txt.
+const SiteSource = "site"
+
+// sourcesFile lists the configured sources in the config directory.
+const sourcesFile = "sources.json"
+
+// Source is a catalog of books. Search results go through the same filters,
+// ranking and selection whatever their source, and are downloaded from the
+// links the source resolves.
+type Source interface {
+	// Name identifies the source in configuration and in Book.Source.
+	Name() string
+	// Search returns the books matching term, unfiltered.
+	Search(ctx context.Context, term string) ([]Book, error)
+	// Details returns the extended metadata of a book found by Search.
+	Details(ctx context.Context, b Book) (*Details, error)
+	// ResolveDownloads returns the links b can be downloaded from, best
+	// first.
+	ResolveDownloads(ctx context.Context, b Book) ([]string, error)
+}
+
+// Catalog is a source together with the downloader for its links.
+type Catalog interface {
+	Source
+	scraper.FileDownloader
+}
+
+// SourceConfig configures one source in sources.json.
+type SourceConfig struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	URL  string `json:"url,omitempty"`
+	// Path is the directory of local sources.
+	Path string `json:"path,omitempty"`
+	// Options holds settings specific to the kind of source.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// SourceDeps are what a source may share with the rest of toshi: the site
+// it falls back to and the fetchers and downloader, with their cache and
+// middleware.
+type SourceDeps struct {
+	Site   *Site
+	Pages  scraper.DocumentFetcher
+	Bodies scraper.BodyFetcher
+	Files  scraper.FileDownloader
+}
+
+// SourceFactory creates a source of one kind from its configuration.
+type SourceFactory func(cfg SourceConfig, deps SourceDeps) (Source, error)
+
+var sourceKinds = map[string]SourceFactory{
+	SiteSource: newSiteSource,
+}
+
+// RegisterSource makes a kind of source available to sources.json. It is
+// meant to be called from an init function and panics if kind is taken.
+func RegisterSource(kind string, factory SourceFactory) {
+	if _, ok := sourceKinds[kind]; ok {
+		panic("lib: source kind registered twice: " + kind)
+	}
+	sourceKinds[kind] = factory
+}
+
+// SourceKinds returns the registered kinds of source, sorted.
+func SourceKinds() []string {
+	kinds := make([]string, 0, len(sourceKinds))
+	for kind := range sourceKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// NewSource creates the source described by cfg.
+func NewSource(cfg SourceConfig, deps SourceDeps) (Source, error) {
+	factory, ok := sourceKinds[cfg.Kind]
+	if !ok {
+		return nil, fmt.Errorf("source %q has unknown kind %q (known: %s)", cfg.Name, cfg.Kind, strings.Join(SourceKinds(), ", "))
+	}
+	return factory(cfg, deps)
+}
+
+// ErrNoSiteURL is returned when the default site is selected but has no
+// URL, as no domain is configured.
+var ErrNoSiteURL = errors.New("the site has no URL")
+
+// newSiteSource returns the default site, or another site with the same
+// layout when cfg has a URL.
+func newSiteSource(cfg SourceConfig, deps SourceDeps) (Source, error) {
+	if cfg.URL == "" {
+		if deps.Site == nil || deps.Site.URL == "" {
+			return nil, ErrNoSiteURL
+		}
+		return deps.Site, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("source %q: invalid URL %q, want e.g. https://books.example/search.php", cfg.Name, cfg.URL)
+	}
+	return &Site{URL: cfg.URL, DocumentFetcher: deps.Pages, FileDownloader: deps.Files}, nil
+}
+
+// LoadSourceConfigs reads sources.json from the config directory. Without
+// the file, only the default site is configured.
+func LoadSourceConfigs() ([]SourceConfig, error) {
+	defaults := []SourceConfig{{Name: SiteSource, Kind: SiteSource}}
+
+	dir, err := paths.ConfigDir()
+	if err != nil {
+		return defaults, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, sourcesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return defaults, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Sources []SourceConfig `json:"sources"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", sourcesFile, err)
+	}
+	seen := make(map[string]bool)
+	for _, cfg := range file.Sources {
+		if cfg.Name == "" || seen[cfg.Name] {
+			return nil, fmt.Errorf("error reading %s: every source needs a unique name", sourcesFile)
+		}
+		seen[cfg.Name] = true
+	}
+	if len(file.Sources) == 0 {
+		return defaults, nil
+	}
+	return file.Sources, nil
+}
+
+// SelectSources returns the configs named in names, in that order, or all
+// of them if names is empty. The default site can be named even when it is
+// not configured.
+func SelectSources(configs []SourceConfig, names []string) ([]SourceConfig, error) {
+	if len(names) == 0 {
+		return configs, nil
+	}
+
+	var selected []SourceConfig
+	for _, name := range names {
+		i := sourceIndex(configs, name)
+		switch {
+		case i >= 0:
+			selected = append(selected, configs[i])
+		case name == SiteSource:
+			selected = append(selected, SourceConfig{Name: SiteSource, Kind: SiteSource})
+		default:
+			return nil, fmt.Errorf("no source named %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func sourceIndex(configs []SourceConfig, name string) int {
+	for i, cfg := range configs {
+		if cfg.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// namedSource gives a source the name it was configured with.
+type namedSource struct {
+	Source
+	name string
+}
+
+func (n namedSource) Name() string { return n.name }
+
+// OpenCatalog creates the sources in configs. A single source is searched
+// directly; several are combined in a MultiSource.
+func OpenCatalog(configs []SourceConfig, deps SourceDeps) (Catalog, error) {
+	var sources []Source
+	for _, cfg := range configs {
+		src, err := NewSource(cfg, deps)
+		if err != nil {
+			return nil, err
+		}
+		if src.Name() != cfg.Name {
+			src = namedSource{Source: src, name: cfg.Name}
+		}
+		sources = append(sources, src)
+	}
+
+	if len(sources) == 1 {
+		if catalog, ok := sources[0].(Catalog); ok {
+			return catalog, nil
+		}
+	}
+	return &MultiSource{Sources: sources, FileDownloader: deps.Files}, nil
+}
+
+// MultiSource searches several sources as one. Results are tagged with the
+// name of their source, in the order of Sources, so details and downloads
+// go back to the source that found the book. A source with a downloader of
+// its own, such as a local library, downloads its books itself.
+type MultiSource struct {
+	Sources []Source
+	scraper.FileDownloader
+}
+
+func (m *MultiSource) Name() string {
+	names := make([]string, len(m.Sources))
+	for i, src := range m.Sources {
+		names[i] = src.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Search searches every source. A source that fails is skipped unless all
+// of them fail. The same file found by several sources is listed once.
+func (m *MultiSource) Search(ctx context.Context, term string) ([]Book, error) {
+	var books []Book
+	var errs []error
+	for _, src := range m.Sources {
+		found, err := src.Search(ctx, term)
+		if err != nil {
+			logger.Warnf("Search of %s failed: %v\n", src.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			continue
+		}
+		for _, b := range found {
+			if b.Source == "" {
+				b.Source = src.Name()
+			}
+			books = append(books, b)
+		}
+	}
+	if len(errs) == len(m.Sources) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	markInLibrary(books)
+	return m.dedupe(books), nil
+}
+
+// dedupe merges books from different sources that are the same file. They
+// are matched by MD5 only, as IDs are per source. The first occurrence keeps
+// its place and source, and receives the mirrors of duplicates from sources
+// of the same kind, which can resolve each other's links.
+func (m *MultiSource) dedupe(books []Book) []Book {
+	var unique []Book
+	byMD5 := make(map[string]int)
+	for _, b := range books {
+		md5 := strings.ToLower(b.MD5)
+		i, found := byMD5[md5]
+		if md5 == "" || !found {
+			if md5 != "" {
+				byMD5[md5] = len(unique)
+			}
+			unique = append(unique, b)
+			continue
+		}
+		if m.sameKind(unique[i], b) {
+			unique[i].Mirrors = mergeMirrors(unique[i].Mirrors, b.Mirrors)
+		}
+	}
+	return unique
+}
+
+// sameKind reports whether a and b came from sources of the same kind.
+func (m *MultiSource) sameKind(a, b Book) bool {
+	srcA, errA := m.sourceOf(a)
+	srcB, errB := m.sourceOf(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.TypeOf(unnamed(srcA)) == reflect.TypeOf(unnamed(srcB))
+}
+
+// unnamed returns the source a namedSource renames.
+func unnamed(src Source) Source {
+	if n, ok := src.(namedSource); ok {
+		return n.Source
+	}
+	return src
+}
+
+// markInLibrary marks the books that are the same as a book in a library:
+// the same file, a shared ISBN, or the same title and author.
+func markInLibrary(books []Book) {
+	held := make(map[string]bool)
+	for _, b := range books {
+		if b.InLibrary {
+			for _, key := range libraryKeys(b) {
+				held[key] = true
+			}
+		}
+	}
+	if len(held) == 0 {
+		return
+	}
+
+	for i, b := range books {
+		for _, key := range libraryKeys(b) {
+			if held[key] {
+				books[i].InLibrary = true
+				break
+			}
+		}
+	}
+}
+
+func libraryKeys(b Book) []string {
+	var keys []string
+	if b.MD5 != "" {
+		keys = append(keys, "md5:"+strings.ToLower(b.MD5))
+	}
+	for _, isbn := range b.ISBN {
+		if isbn = strings.ReplaceAll(strings.TrimSpace(isbn), "-", ""); isbn != "" {
+			keys = append(keys, "isbn:"+isbn)
+		}
+	}
+	if normalizeTitle(b.Title) != "" {
+		keys = append(keys, "work:"+workKey(b))
+	}
+	return keys
+}
+
+func (m *MultiSource) Details(ctx context.Context, b Book) (*Details, error) {
+	src, err := m.sourceOf(b)
+	if err != nil {
+		return nil, err
+	}
+	return src.Details(ctx, b)
+}
+
+func (m *MultiSource) ResolveDownloads(ctx context.Context, b Book) ([]string, error) {
+	src, err := m.sourceOf(b)
+	if err != nil {
+		return nil, err
+	}
+	return src.ResolveDownloads(ctx, b)
+}
+
+// DownloaderFor returns the downloader for b's links: its source's own if
+// it has one, else m's.
+func (m *MultiSource) DownloaderFor(b Book) scraper.FileDownloader {
+	if src, err := m.sourceOf(b); err == nil {
+		if files, ok := src.(scraper.FileDownloader); ok {
+			return files
+		}
+	}
+	return m.FileDownloader
+}
+
+// sourceOf returns the source b came from. Books without a source, such as
+// those saved before sources existed, came from the default site.
+func (m *MultiSource) sourceOf(b Book) (Source, error) {
+	name := b.Source
+	if name == "" {
+		name = SiteSource
+	}
+	for _, src := range m.Sources {
+		if src.Name() == name {
+			return src, nil
+		}
+	}
+	if b.Source == "" && len(m.Sources) > 0 {
+		return m.Sources[0], nil
+	}
+	return nil, fmt.Errorf("source %q of %s is not enabled", b.Source, b.Title)
+}
+
+// SiteOf returns the site searched by src, if any, for the commands that
+// only work with the site's layout.
+func SiteOf(src Source) (*Site, bool) {
+	switch src := src.(type) {
+	case *Site:
+		return src, true
+	case namedSource:
+		return SiteOf(src.Source)
+	case *MultiSource:
+		for _, s := range src.Sources {
+			if site, ok := SiteOf(s); ok {
+				return site, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,230 @@
+package lib
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// fakeSource returns fixed books, or err.
+type fakeSource struct {
+    name  string
+    books []Book
+    err   error
+}
+
+func (f fakeSource) Name() string { return f.name }
+
+func (f fakeSource) Search(ctx context.Context, term string) ([]Book, error) {
+    return f.books, f.err
+}
+
+func (f fakeSource) Details(ctx context.Context, b Book) (*Details, error) {
+    return &Details{Book: b, Description: "from " + f.name}, nil
+}
+
+func (f fakeSource) ResolveDownloads(ctx context.Context, b Book) ([]string, error) {
+    return []string{"https://" + f.name + ".example/" + b.ID}, nil
+}
+
+func init() {
+    RegisterSource("fake", func(cfg SourceConfig, deps SourceDeps) (Source, error) {
+        return fakeSource{name: "fake", books: []Book{{ID: cfg.URL, Title: cfg.Name}}}, nil
+    })
+}
+
+func TestLoadSourceConfigs(t *testing.T) {
+    dir := t.TempDir()
+    t.Setenv("TOSHI_CONFIG_DIR", dir)
+
+    configs, err := LoadSourceConfigs()
+    if err != nil || len(configs) != 1 || configs[0].Kind != SiteSource {
+        t.Fatalf("LoadSourceConfigs() without a file = %#v, %v; want the site", configs, err)
+    }
+
+    data := `{"sources": [{"name": "calibre", "kind": "fake", "url": "https://calibre.example"}, {"name": "site", "kind": "site"}]}`
+    if err := os.WriteFile(filepath.Join(dir, sourcesFile), []byte(data), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    configs, err = LoadSourceConfigs()
+    if err != nil || len(configs) != 2 || configs[0].Name != "calibre" || configs[0].URL != "https://calibre.example" {
+        t.Fatalf("LoadSourceConfigs() = %#v, %v", configs, err)
+    }
+
+    data = `{"sources": [{"name": "a", "kind": "fake"}, {"name": "a", "kind": "site"}]}`
+    if err := os.WriteFile(filepath.Join(dir, sourcesFile), []byte(data), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := LoadSourceConfigs(); err == nil {
+        t.Fatal("expected error for duplicate source names")
+    }
+}
+
+func TestSelectSources(t *testing.T) {
+    configs := []SourceConfig{{Name: "a", Kind: "fake"}, {Name: "b", Kind: "fake"}}
+
+    selected, err := SelectSources(configs, []string{"b", "site"})
+    if err != nil || len(selected) != 2 || selected[0].Name != "b" || selected[1].Kind != SiteSource {
+        t.Fatalf("SelectSources() = %#v, %v; want b and the site", selected, err)
+    }
+    if all, _ := SelectSources(configs, nil); len(all) != 2 {
+        t.Fatalf("SelectSources() without names = %#v, want every source", all)
+    }
+    if _, err := SelectSources(configs, []string{"c"}); err == nil {
+        t.Fatal("expected error for an unknown source")
+    }
+}
+
+func TestOpenCatalog(t *testing.T) {
+    site := newTestSite("https://books.example/search.php")
+    deps := SourceDeps{Site: site, Pages: site.DocumentFetcher, Files: site.FileDownloader}
+
+    catalog, err := OpenCatalog([]SourceConfig{{Name: SiteSource, Kind: SiteSource}}, deps)
+    if err != nil || catalog != Catalog(site) {
+        t.Fatalf("OpenCatalog() with only the site = %v, %v; want the site itself", catalog, err)
+    }
+
+    catalog, err = OpenCatalog([]SourceConfig{{Name: "calibre", Kind: "fake", URL: "7"}, {Name: SiteSource, Kind: SiteSource}}, deps)
+    if err != nil {
+        t.Fatalf("OpenCatalog() error = %v", err)
+    }
+    if catalog.Name() != "calibre,site" {
+        t.Fatalf("Name() = %q, want calibre,site", catalog.Name())
+    }
+    if got, ok := SiteOf(catalog); !ok || got != site {
+        t.Fatalf("SiteOf() = %v, %v; want the site", got, ok)
+    }
+
+    if _, err := OpenCatalog([]SourceConfig{{Name: "x", Kind: "gopher"}}, deps); err == nil {
+        t.Fatal("expected error for an unknown kind")
+    }
+    for _, bad := range []string{"books.example/search.php", "https://", "http://[::1"} {
+        if _, err := OpenCatalog([]SourceConfig{{Name: "mirror", Kind: SiteSource, URL: bad}}, deps); err == nil {
+            t.Fatalf("expected error for the site URL %q", bad)
+        }
+    }
+    if _, err := OpenCatalog([]SourceConfig{{Name: SiteSource, Kind: SiteSource}}, SourceDeps{Site: &Site{}}); !errors.Is(err, ErrNoSiteURL) {
+        t.Fatalf("OpenCatalog() without a site URL error = %v, want ErrNoSiteURL", err)
+    }
+}
+
+func TestMultiSource_TagsAndRoutes(t *testing.T) {
+    m := &MultiSource{Sources: []Source{
+        fakeSource{name: "local", books: []Book{{ID: "1", Title: "The Iliad"}}},
+        fakeSource{name: "broken", err: errors.New("offline")},
+        fakeSource{name: "remote", books: []Book{{ID: "2", Title: "The Odyssey"}}},
+    }}
+
+    books, err := m.Search(context.Background(), "homer")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 2 || books[0].Source != "local" || books[1].Source != "remote" {
+        t.Fatalf("Search() = %#v, want tagged books from local and remote", books)
+    }
+
+    d, err := m.Details(context.Background(), books[1])
+    if err != nil || d.Description != "from remote" {
+        t.Fatalf("Details() = %#v, %v; want the remote source's details", d, err)
+    }
+    links, err := m.ResolveDownloads(context.Background(), books[0])
+    if err != nil || len(links) != 1 || links[0] != "https://local.example/1" {
+        t.Fatalf("ResolveDownloads() = %v, %v", links, err)
+    }
+    if _, err := m.Details(context.Background(), Book{Source: "gone"}); err == nil {
+        t.Fatal("expected error for a book from a source that is not enabled")
+    }
+
+    failing := &MultiSource{Sources: []Source{fakeSource{name: "broken", err: errors.New("offline")}}}
+    if _, err := failing.Search(context.Background(), "homer"); err == nil {
+        t.Fatal("expected error when every source fails")
+    }
+}
+
+// librarySource is a fakeSource that downloads its own books.
+type librarySource struct {
+    fakeSource
+}
+
+func (librarySource) DownloadFile(ctx context.Context, filename, url, dir string) error {
+    return nil
+}
+
+func TestMultiSource_MarksLibraryBooks(t *testing.T) {
+    library := librarySource{fakeSource{name: "nas", books: []Book{
+        {ID: "iliad.epub", Title: "The Iliad", Authors: "Homer", MD5: "abc", InLibrary: true},
+        {ID: "walden.pdf", Title: "Walden", ISBN: []string{"978-0-14-303974-0"}, InLibrary: true},
+    }}}
+    remote := fakeSource{name: "remote", books: []Book{
+        {ID: "1", Title: "The Iliad", Authors: "Homer"},
+        {ID: "2", Title: "Walden; or, Life in the Woods", ISBN: []string{"9780143039740"}},
+        {ID: "3", Title: "Something", MD5: "ABC"},
+        {ID: "4", Title: "The Odyssey", Authors: "Homer"},
+    }}
+    m := &MultiSource{Sources: []Source{library, remote}}
+
+    books, err := m.Search(context.Background(), "homer")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    // The remote copy of the library's Iliad file is listed once.
+    want := []bool{true, true, true, true, false}
+    if len(books) != len(want) {
+        t.Fatalf("Search() = %d books, want %d", len(books), len(want))
+    }
+    for i, b := range books {
+        if b.InLibrary != want[i] {
+            t.Errorf("books[%d] (%s) InLibrary = %v, want %v", i, b.Title, b.InLibrary, want[i])
+        }
+    }
+
+    if _, ok := m.DownloaderFor(books[0]).(librarySource); !ok {
+        t.Error("DownloaderFor() should return the library's downloader for its books")
+    }
+    if m.DownloaderFor(books[2]) != m.FileDownloader {
+        t.Error("DownloaderFor() should return the shared downloader for other books")
+    }
+}
+
+func TestMultiSource_DedupesAcrossSources(t *testing.T) {
+    library := librarySource{fakeSource{name: "nas", books: []Book{
+        {ID: "1", Title: "The Iliad", MD5: "abc", Mirrors: []string{"file:///books/iliad.epub"}, InLibrary: true},
+    }}}
+    first := fakeSource{name: "first", books: []Book{
+        {ID: "1", Title: "The Odyssey", MD5: "def", Mirrors: []string{"https://first.example/def"}},
+        {ID: "2", Title: "The Iliad", MD5: "ABC", Mirrors: []string{"https://first.example/abc"}},
+    }}
+    second := fakeSource{name: "second", books: []Book{
+        {ID: "1", Title: "Walden"},
+        {ID: "9", Title: "The Odyssey", MD5: "DEF", Mirrors: []string{"https://second.example/def"}},
+    }}
+    m := &MultiSource{Sources: []Source{library, first, second}}
+
+    books, err := m.Search(context.Background(), "")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    var titles []string
+    for _, b := range books {
+        titles = append(titles, b.Source+":"+b.Title)
+    }
+    want := []string{"nas:The Iliad", "first:The Odyssey", "second:Walden"}
+    if len(titles) != len(want) {
+        t.Fatalf("Search() = %v, want %v", titles, want)
+    }
+    for i := range want {
+        if titles[i] != want[i] {
+            t.Fatalf("Search() = %v, want %v", titles, want)
+        }
+    }
+
+    // Mirrors are merged only from sources of the same kind.
+    if len(books[0].Mirrors) != 1 {
+        t.Errorf("library book mirrors = %v, want only its own file", books[0].Mirrors)
+    }
+    if len(books[1].Mirrors) != 2 {
+        t.Errorf("remote book mirrors = %v, want both remote mirrors", books[1].Mirrors)
+    }
+}
@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// watchlistFile holds the saved searches in the data directory, and
+// snapshotDir the results last seen for each of them.
+const (
+	watchlistFile = "watches.json"
+	snapshotDir   = "watch"
+)
+
+// Watch is a saved search that is rerun to find books that were not in its
+// results before.
+type Watch struct {
+	ID      int       `json:"id"`
+	Query   string    `json:"query"`
+	Args    []string  `json:"args"`
+	Added   time.Time `json:"added"`
+	LastRun time.Time `json:"last_run,omitempty"`
+}
+
+// Watchlist is the stored list of watches.
+type Watchlist struct {
+	jsonList[Watch]
+}
+
+var watchlistStore = listFile{name: watchlistFile, key: "watches", what: "watches"}
+
+// WatchReport lists the books a run of a watch found that its previous
+// runs had not seen.
+type WatchReport struct {
+	WatchID int       `json:"watch_id"`
+	Query   string    `json:"query"`
+	Time    time.Time `json:"time"`
+	Results int       `json:"results"`
+	New     []Book    `json:"new"`
+	// Baseline is set on the first run of a watch, which records the
+	// current results without reporting them.
+	Baseline bool `json:"baseline,omitempty"`
+}
+
+// LoadWatchlist reads the watchlist, returning an empty one if none is
+// saved.
+func LoadWatchlist() (*Watchlist, error) {
+	l, err := loadJSONList[Watch](watchlistStore)
+	if err != nil {
+		return nil, err
+	}
+	return &Watchlist{l}, nil
+}
+
+// Save writes the watchlist back to the data directory.
+func (w *Watchlist) Save() error {
+	return w.save(watchlistStore)
+}
+
+// Add appends a watch for query, searched with args, and returns it.
+func (w *Watchlist) Add(query string, args []string) Watch {
+	return w.add(func(id int) Watch {
+		return Watch{ID: id, Query: query, Args: args, Added: time.Now()}
+	})
+}
+
+// Remove deletes the watch with the given ID and its snapshot.
+func (w *Watchlist) Remove(id int) error {
+	if !w.remove(id, func(watch Watch) int { return watch.ID }) {
+		return fmt.Errorf("no watch with ID %d", id)
+	}
+	if path, err := watchSnapshotPath(id); err == nil {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// RunWatch searches for w's query, keeps the results accepted by filters
+// and reports those not seen by earlier runs. Every result is added to the
+// watch's snapshot, so a book is reported only once. The query is not
+// broadened, as the looser matches of a book not out yet are not new
+// matches of the watch.
+func RunWatch(src Source, w Watch, filters []Filter) (*WatchReport, error) {
+	ctx, cancel := context.WithTimeout(exactSearch(context.Background()), defaultTimeout)
+	defer cancel()
+
+	books, err := src.Search(ctx, w.Query)
+	if err != nil {
+		return nil, err
+	}
+	books = ApplyFilters(books, filters...)
+
+	seen, found, err := loadWatchSnapshot(w.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &WatchReport{WatchID: w.ID, Query: w.Query, Time: time.Now(), Results: len(books), Baseline: !found}
+	for _, b := range books {
+		key := watchKey(b)
+		if !seen[key] && found {
+			report.New = append(report.New, b)
+		}
+		seen[key] = true
+	}
+
+	if err := saveWatchSnapshot(w.ID, seen); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// watchKey identifies a book across runs by its MD5, so that a new format
+// or edition counts as a new book. Books without an MD5 are identified by
+// their ID and format, as sources such as OPDS catalogs give every format of
+// a publication the same ID. IDs of other sources than the site are prefixed
+// with the source's name.
+func watchKey(b Book) string {
+	if b.MD5 != "" {
+		return "md5:" + b.MD5
+	}
+	key := "id:" + b.ID
+	if b.Source != "" && b.Source != SiteSource {
+		key = "id:" + b.Source + ":" + b.ID
+	}
+	if ext := strings.ToLower(strings.TrimSpace(b.Extension)); ext != "" {
+		key += ":" + ext
+	}
+	return key
+}
+
+func watchSnapshotPath(id int) (string, error) {
+	dir, err := paths.DataSubdir(snapshotDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(id)+".json"), nil
+}
+
+// loadWatchSnapshot returns the keys of the books seen by earlier runs of the
+// watch with the given ID, and whether it had run before.
+func loadWatchSnapshot(id int) (map[string]bool, bool, error) {
+	path, err := watchSnapshotPath(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	seen := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return seen, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, false, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	return seen, true, nil
+}
+
+func saveWatchSnapshot(id int, seen map[string]bool) error {
+	path, err := watchSnapshotPath(id)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	if err := paths.WriteFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
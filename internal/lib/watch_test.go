@@ -0,0 +1,112 @@
+package lib
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func watchRow(id, md5, ext string) string {
+    return fmt.Sprintf(`<tr valign="top"><td>%s</td><td>Homer</td><td><a href="#">The Iliad</a></td>
+        <td>Penguin</td><td>1998</td><td>704</td><td>English</td><td>1 Mb</td><td>%s</td>
+        <td><a href="/main/%s">m1</a></td><td></td></tr>`, id, ext, md5)
+}
+
+func TestRunWatch_ReportsOnlyNewBooks(t *testing.T) {
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+
+    rows := []string{watchRow("1", strings.Repeat("a", 32), "epub")}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintf(w, `<p>%d files found</p><table>%s</table>`, len(rows), strings.Join(rows, ""))
+    }))
+    t.Cleanup(srv.Close)
+    s := newTestSite(srv.URL + "/search.php")
+
+    watches := &Watchlist{}
+    w := watches.Add("the iliad", nil)
+
+    report, err := RunWatch(s, w, nil)
+    if err != nil {
+        t.Fatalf("RunWatch error = %v", err)
+    }
+    if !report.Baseline || report.Results != 1 || len(report.New) != 0 {
+        t.Fatalf("first run = %#v, want a baseline of 1 result", report)
+    }
+
+    // A new format of the same book appears, and one is filtered out.
+    rows = append(rows, watchRow("2", strings.Repeat("b", 32), "pdf"), watchRow("3", strings.Repeat("c", 32), "mobi"))
+    report, err = RunWatch(s, w, []Filter{ByExtension("epub", "pdf")})
+    if err != nil {
+        t.Fatalf("RunWatch error = %v", err)
+    }
+    if report.Baseline || len(report.New) != 1 || report.New[0].ID != "2" {
+        t.Fatalf("second run = %#v, want book 2 as new", report)
+    }
+
+    report, err = RunWatch(s, w, []Filter{ByExtension("epub", "pdf")})
+    if err != nil {
+        t.Fatalf("RunWatch error = %v", err)
+    }
+    if len(report.New) != 0 {
+        t.Fatalf("third run reported %d new books, want none", len(report.New))
+    }
+
+    // Removing the watch forgets its snapshot.
+    if err := watches.Remove(w.ID); err != nil {
+        t.Fatalf("Remove error = %v", err)
+    }
+    if _, found, _ := loadWatchSnapshot(w.ID); found {
+        t.Fatal("snapshot kept after removing the watch")
+    }
+}
+
+func TestRunWatch_ReportsNewFormatOfSameEntry(t *testing.T) {
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+
+    // Like an OPDS catalog: no MD5, and one ID for every format of an entry.
+    epub := Book{ID: "urn:uuid:iliad", Title: "The Iliad", Authors: "Homer", Extension: "epub", Source: "calibre"}
+    pdf := epub
+    pdf.Extension = "pdf"
+
+    w := (&Watchlist{}).Add("the iliad", nil)
+    if _, err := RunWatch(fakeSource{name: "calibre", books: []Book{epub}}, w, nil); err != nil {
+        t.Fatalf("RunWatch error = %v", err)
+    }
+
+    report, err := RunWatch(fakeSource{name: "calibre", books: []Book{epub, pdf}}, w, nil)
+    if err != nil {
+        t.Fatalf("RunWatch error = %v", err)
+    }
+    if len(report.New) != 1 || report.New[0].Extension != "pdf" {
+        t.Fatalf("second run = %#v, want the pdf as new", report)
+    }
+}
+
+func TestRunWatch_DoesNotBroadenExactQuery(t *testing.T) {
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+
+    // Only the broadened "without subtitle" search finds anything.
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Query().Get("req") == "the iliad" {
+            fmt.Fprintf(w, `<p>1 files found</p><table>%s</table>`, watchRow("1", strings.Repeat("a", 32), "epub"))
+            return
+        }
+        fmt.Fprint(w, `<p>0 files found</p><table><tr valign="top"><td>ID</td></tr></table>`)
+    }))
+    t.Cleanup(srv.Close)
+    s := newTestSite(srv.URL + "/search.php")
+
+    w := (&Watchlist{}).Add("the iliad: a new translation", nil)
+    for run := 0; run < 2; run++ {
+        report, err := RunWatch(s, w, nil)
+        if err != nil {
+            t.Fatalf("RunWatch error = %v", err)
+        }
+        if report.Results != 0 || len(report.New) != 0 {
+            t.Fatalf("run %d = %#v, want no results", run, report)
+        }
+    }
+}
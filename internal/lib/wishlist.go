@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// wishlistFile holds the wanted books in the data directory.
+const wishlistFile = "wishlist.json"
+
+// MinConfidence is the relevance a result needs before a wish downloads it
+// without asking.
+const MinConfidence = 0.8
+
+// Wish states.
+const (
+	WishPending = "pending"
+	WishDone    = "done"
+)
+
+// Wish is a wanted book that is searched for again on every sync until it
+// is downloaded.
+type Wish struct {
+	ID    int       `json:"id"`
+	Query string    `json:"query"`
+	Args  []string  `json:"args"`
+	Added time.Time `json:"added"`
+
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"` // why the last sync left it pending
+	LastTried time.Time `json:"last_tried,omitempty"`
+	Book      *Book     `json:"book,omitempty"` // the edition downloaded
+	File      string    `json:"file,omitempty"`
+}
+
+// Wishlist is the stored list of wishes.
+type Wishlist struct {
+	jsonList[Wish]
+}
+
+var wishlistStore = listFile{name: wishlistFile, key: "wishes", what: "wishlist"}
+
+// LoadWishlist reads the wishlist, returning an empty one if none is saved.
+func LoadWishlist() (*Wishlist, error) {
+	l, err := loadJSONList[Wish](wishlistStore)
+	if err != nil {
+		return nil, err
+	}
+	return &Wishlist{l}, nil
+}
+
+// Save writes the wishlist back to the data directory.
+func (w *Wishlist) Save() error {
+	return w.save(wishlistStore)
+}
+
+// Add appends a pending wish for query, searched with args, and returns it.
+func (w *Wishlist) Add(query string, args []string) Wish {
+	return w.add(func(id int) Wish {
+		return Wish{ID: id, Query: query, Args: args, Added: time.Now(), Status: WishPending}
+	})
+}
+
+// Remove deletes the wish with the given ID.
+func (w *Wishlist) Remove(id int) error {
+	if !w.remove(id, func(wish Wish) int { return wish.ID }) {
+		return fmt.Errorf("no wish with ID %d", id)
+	}
+	return nil
+}
+
+// ConfidentMatch returns the result most relevant to query, and whether it
+// is relevant enough to download without asking. The score of the best
+// result is returned either way so the caller can explain a refusal.
+func ConfidentMatch(books []Book, query string, prefs Preferences) (Book, Score, bool) {
+	var best Book
+	var bestScore Score
+	for i, b := range books {
+		score := ScoreBook(b, query, prefs)
+		if i == 0 || score.Relevance > bestScore.Relevance ||
+			score.Relevance == bestScore.Relevance && score.Total > bestScore.Total {
+			best, bestScore = b, score
+		}
+	}
+	return best, bestScore, len(books) > 0 && bestScore.Relevance >= MinConfidence
+}
@@ -0,0 +1,58 @@
+package lib
+
+import "testing"
+
+func TestWishlist_SaveAndLoad(t *testing.T) {
+    t.Setenv("TOSHI_DATA_DIR", t.TempDir())
+
+    w, err := LoadWishlist()
+    if err != nil || len(w.Items) != 0 {
+        t.Fatalf("LoadWishlist = %#v, %v, want empty", w, err)
+    }
+
+    first := w.Add("the iliad", []string{"the", "iliad", "--lang", "en"})
+    second := w.Add("the odyssey", []string{"the", "odyssey"})
+    if first.ID != 1 || second.ID != 2 || first.Status != WishPending {
+        t.Fatalf("unexpected wishes: %#v, %#v", first, second)
+    }
+    if err := w.Remove(1); err != nil {
+        t.Fatalf("Remove error = %v", err)
+    }
+    if err := w.Remove(1); err == nil {
+        t.Fatal("expected error removing a missing wish")
+    }
+    if err := w.Save(); err != nil {
+        t.Fatalf("Save error = %v", err)
+    }
+
+    w, err = LoadWishlist()
+    if err != nil {
+        t.Fatalf("LoadWishlist error = %v", err)
+    }
+    if len(w.Items) != 1 || w.Items[0].Query != "the odyssey" {
+        t.Fatalf("wishes = %#v", w.Items)
+    }
+    // IDs are not reused after a removal.
+    if third := w.Add("aeneid", nil); third.ID != 3 {
+        t.Fatalf("new wish ID = %d, want 3", third.ID)
+    }
+}
+
+func TestConfidentMatch(t *testing.T) {
+    books := []Book{
+        {Title: "Homer: A Biography", Authors: "Smith"},
+        {Title: "The Iliad", Authors: "Homer"},
+    }
+
+    best, score, ok := ConfidentMatch(books, "the iliad homer", Preferences{})
+    if !ok || best.Title != "The Iliad" {
+        t.Fatalf("ConfidentMatch = %q, %v, %v, want The Iliad", best.Title, score, ok)
+    }
+
+    if best, _, ok := ConfidentMatch(books, "war and peace", Preferences{}); ok {
+        t.Fatalf("ConfidentMatch accepted %q for an unrelated query", best.Title)
+    }
+    if _, _, ok := ConfidentMatch(nil, "the iliad", Preferences{}); ok {
+        t.Fatal("ConfidentMatch accepted an empty result set")
+    }
+}
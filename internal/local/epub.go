@@ -0,0 +1,128 @@
+package local
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// container is META-INF/container.xml, which locates the package document.
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage is the Dublin Core metadata of an EPUB package document.
+type opfPackage struct {
+	Titles       []string `xml:"metadata>title"`
+	Creators     []string `xml:"metadata>creator"`
+	Languages    []string `xml:"metadata>language"`
+	Publishers   []string `xml:"metadata>publisher"`
+	Dates        []string `xml:"metadata>date"`
+	Descriptions []string `xml:"metadata>description"`
+	Identifiers  []struct {
+		Scheme string `xml:"scheme,attr"`
+		Value  string `xml:",chardata"`
+	} `xml:"metadata>identifier"`
+}
+
+// readEPUB sets f's metadata from the package document of the EPUB at path.
+func readEPUB(path string, f *file) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var c container
+	if err := decodeXML(&r.Reader, "META-INF/container.xml", &c); err != nil {
+		return err
+	}
+	if len(c.Rootfiles) == 0 {
+		return errors.New("no package document")
+	}
+	var pkg opfPackage
+	if err := decodeXML(&r.Reader, c.Rootfiles[0].FullPath, &pkg); err != nil {
+		return err
+	}
+
+	f.Title = first(pkg.Titles)
+	for _, creator := range pkg.Creators {
+		if creator = collapseSpace(creator); creator != "" {
+			f.Authors = append(f.Authors, creator)
+		}
+	}
+	f.Language = first(pkg.Languages)
+	f.Publisher = first(pkg.Publishers)
+	f.Date = first(pkg.Dates)
+	f.Description = htmlText(first(pkg.Descriptions))
+	for _, id := range pkg.Identifiers {
+		if isbn, ok := parseISBN(id.Scheme, id.Value); ok {
+			f.ISBN = append(f.ISBN, isbn)
+		}
+	}
+	return nil
+}
+
+func decodeXML(r *zip.Reader, name string, v any) error {
+	in, err := r.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return xml.NewDecoder(io.LimitReader(in, 4<<20)).Decode(v)
+}
+
+// parseISBN returns the ISBN of an identifier marked as one by its scheme
+// or prefix, or made of 10 or 13 ISBN digits.
+func parseISBN(scheme, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"urn:isbn:", "isbn:"} {
+		if strings.HasPrefix(lower, prefix) {
+			value, scheme = value[len(prefix):], "isbn"
+			break
+		}
+	}
+
+	digits := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value))
+	if len(digits) != 10 && len(digits) != 13 {
+		return "", false
+	}
+	for i, r := range digits {
+		if (r < '0' || r > '9') && !(r == 'X' && i == len(digits)-1) {
+			return "", false
+		}
+	}
+	return digits, strings.EqualFold(scheme, "isbn") || len(digits) == 13 && (strings.HasPrefix(digits, "978") || strings.HasPrefix(digits, "979"))
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if v = collapseSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// htmlText returns the text of s, which may be HTML.
+func htmlText(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+	return collapseSpace(doc.Text())
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,216 @@
+package local
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// indexVersion changes when the metadata read from files does, so older
+// indexes are rebuilt.
+const indexVersion = 1
+
+// index is the metadata of the books in a directory, by path relative to it
+// with forward slashes.
+type index struct {
+	Version int             `json:"version"`
+	Files   map[string]file `json:"files"`
+
+	// path is where the index is saved, or "" if it cannot be.
+	path string
+}
+
+// file is the metadata of one book. Files whose size or modification time
+// changed are read again.
+type file struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	MD5         string    `json:"md5"`
+	Title       string    `json:"title,omitempty"`
+	Authors     []string  `json:"authors,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Publisher   string    `json:"publisher,omitempty"`
+	Date        string    `json:"date,omitempty"`
+	ISBN        []string  `json:"isbn,omitempty"`
+	Description string    `json:"description,omitempty"`
+}
+
+// loadIndex returns the saved index of dir, or an empty one.
+func loadIndex(dir string) *index {
+	idx := &index{Version: indexVersion, Files: make(map[string]file)}
+	cache, err := paths.CacheSubdir("local")
+	if err != nil {
+		logger.Debugf("Not saving the index of %s: %v\n", dir, err)
+		return idx
+	}
+	sum := sha256.Sum256([]byte(dir))
+	idx.path = filepath.Join(cache, hex.EncodeToString(sum[:8])+".json")
+
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		return idx
+	}
+	var saved index
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != indexVersion {
+		logger.Debugf("Rebuilding the index of %s\n", dir)
+		return idx
+	}
+	if saved.Files != nil {
+		idx.Files = saved.Files
+	}
+	return idx
+}
+
+// update reads the files of dir that are new or changed, forgets those that
+// were removed and saves the index if anything changed. If ctx ends first,
+// the files read so far are saved, so that the next update continues from
+// there, and ctx's error is returned.
+func (idx *index) update(ctx context.Context, dir string) error {
+	seen := make(map[string]bool)
+	changed := false
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			logger.Debugf("Skipping %s: %v\n", path, err)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !supported(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+
+		if f, ok := idx.Files[rel]; ok && f.Size == info.Size() && f.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		f, err := readFile(ctx, path, info)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Debugf("Skipping %s: %v\n", path, err)
+			return nil
+		}
+		idx.Files[rel] = f
+		changed = true
+		return nil
+	})
+	if err != nil {
+		if changed {
+			idx.save()
+		}
+		return err
+	}
+
+	for path := range idx.Files {
+		if !seen[path] {
+			delete(idx.Files, path)
+			changed = true
+		}
+	}
+	if changed {
+		idx.save()
+	}
+	return nil
+}
+
+func (idx *index) save() {
+	if idx.path == "" {
+		return
+	}
+	data, err := json.Marshal(idx)
+	if err == nil {
+		err = paths.WriteFileAtomic(idx.path, data)
+	}
+	if err != nil {
+		logger.Debugf("Error saving the index: %v\n", err)
+	}
+}
+
+// paths returns the indexed paths in order.
+func (idx *index) paths() []string {
+	paths := make([]string, 0, len(idx.Files))
+	for path := range idx.Files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".epub", ".pdf":
+		return true
+	}
+	return false
+}
+
+// readFile hashes the file at path and reads its metadata. Files whose
+// metadata cannot be read are still indexed by name. It is a variable so
+// tests can interrupt indexing.
+var readFile = func(ctx context.Context, path string, info fs.FileInfo) (file, error) {
+	f := file{Size: info.Size(), ModTime: info.ModTime()}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return f, err
+	}
+	defer in.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, contextReader{ctx, in}); err != nil {
+		return f, err
+	}
+	f.MD5 = hex.EncodeToString(h.Sum(nil))
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".epub":
+		err = readEPUB(path, &f)
+	case ".pdf":
+		err = readPDF(in, &f)
+	}
+	if err != nil {
+		logger.Debugf("No metadata in %s: %v\n", path, err)
+	}
+	return f, nil
+}
+
+// contextReader stops reading once ctx ends, so hashing a large file does
+// not outlive a search.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,232 @@
+// Package local searches a directory of EPUB and PDF files, such as a NAS
+// mount, as a toshi source. Its books are marked as already in the library,
+// and downloading one copies or links the file to the output directory.
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+)
+
+// Kind is the kind of local sources in sources.json.
+const Kind = "local"
+
+// Download modes, set with the "mode" option.
+const (
+	ModeCopy = "copy"
+	ModeLink = "link"
+)
+
+func init() {
+	lib.RegisterSource(Kind, func(cfg lib.SourceConfig, deps lib.SourceDeps) (lib.Source, error) {
+		return New(cfg)
+	})
+}
+
+// Source is a directory tree of books. The metadata embedded in the files is
+// indexed on the first search and kept in the cache directory, so later runs
+// only read files that were added or changed.
+type Source struct {
+	name string
+	dir  string
+	mode string
+
+	mu    sync.Mutex
+	index *index
+}
+
+// New returns the local source configured by cfg, whose Path is the
+// directory to search.
+func New(cfg lib.SourceConfig) (*Source, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("local source %q needs the path of a directory", cfg.Name)
+	}
+	dir, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := cfg.Options["mode"]
+	switch mode {
+	case "":
+		mode = ModeCopy
+	case ModeCopy, ModeLink:
+	default:
+		return nil, fmt.Errorf("local source %q: unknown mode %q, want %s or %s", cfg.Name, mode, ModeCopy, ModeLink)
+	}
+	return &Source{name: cfg.Name, dir: dir, mode: mode}, nil
+}
+
+func (s *Source) Name() string { return s.name }
+
+// Search returns the books whose title, authors or file name contain every
+// word of term, ignoring case and diacritics and allowing for small spelling
+// differences.
+func (s *Source) Search(ctx context.Context, term string) ([]lib.Book, error) {
+	idx, err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var books []lib.Book
+	for _, path := range idx.paths() {
+		f := idx.Files[path]
+		if fuzzy.ContainsWords(f.Title+" "+strings.Join(f.Authors, " ")+" "+path, term) {
+			books = append(books, s.book(path, f))
+		}
+	}
+	return books, nil
+}
+
+// refresh brings the index up to date with the directory. If ctx ends
+// before it is, as it may on the first search of a large library, the files
+// indexed so far are used and the next search continues indexing.
+func (s *Source) refresh(ctx context.Context) (*index, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		s.index = loadIndex(s.dir)
+	}
+	if err := s.index.update(ctx, s.dir); err != nil {
+		if ctx.Err() == nil {
+			return nil, err
+		}
+		logger.Warnf("Indexing %s is not finished, searching the %d files indexed so far; the next search continues\n", s.dir, len(s.index.Files))
+	}
+	return s.index, nil
+}
+
+// Details returns the description and identifiers read from b's file.
+func (s *Source) Details(ctx context.Context, b lib.Book) (*lib.Details, error) {
+	idx, err := s.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := idx.Files[b.ID]
+	if !ok {
+		return nil, fmt.Errorf("%s has no file %s", s.name, b.ID)
+	}
+
+	d := &lib.Details{Book: b, Description: f.Description, MD5: f.MD5, URL: fileURL(filepath.Join(s.dir, filepath.FromSlash(b.ID)))}
+	if len(f.ISBN) > 0 {
+		d.Identifiers = map[string]string{"isbn": f.ISBN[0]}
+	}
+	return d, nil
+}
+
+// ResolveDownloads returns the file:// URL of b's file.
+func (s *Source) ResolveDownloads(ctx context.Context, b lib.Book) ([]string, error) {
+	if len(b.Mirrors) == 0 {
+		return nil, fmt.Errorf("%s has no file for %s", s.name, b.Title)
+	}
+	return b.Mirrors, nil
+}
+
+// DownloadFile copies the file at the file:// URL link to dir, or links it
+// there in link mode.
+func (s *Source) DownloadFile(ctx context.Context, filename, link, dir string) error {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "file" {
+		return fmt.Errorf("not a local file: %s", link)
+	}
+	src := filepath.FromSlash(u.Path)
+	if rel, err := filepath.Rel(s.dir, src); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is outside %s", src, s.dir)
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	dest := filepath.Join(dir, filename)
+
+	// The output directory may be inside the library, and copying or
+	// linking a file onto itself would destroy it.
+	if srcInfo, err := os.Stat(src); err != nil {
+		return err
+	} else if destInfo, err := os.Stat(dest); err == nil && os.SameFile(srcInfo, destInfo) {
+		logger.Debugf("%s is already in the output directory\n", src)
+		return nil
+	}
+
+	if s.mode == ModeLink {
+		if err := os.Remove(dest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		logger.Debugf("Linking %s to %s\n", src, dest)
+		return os.Symlink(src, dest)
+	}
+	logger.Debugf("Copying %s to %s\n", src, dest)
+	return copyFile(src, dest)
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// book returns the book of the file at path, relative to the directory.
+func (s *Source) book(path string, f file) lib.Book {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	b := lib.Book{
+		ID:        path,
+		MD5:       f.MD5,
+		Authors:   strings.Join(f.Authors, "; "),
+		Title:     f.Title,
+		ISBN:      f.ISBN,
+		Publisher: f.Publisher,
+		Year:      f.Date,
+		Language:  f.Language,
+		Size:      lib.FormatSize(f.Size),
+		Extension: ext,
+		Mirrors:   []string{fileURL(filepath.Join(s.dir, filepath.FromSlash(path)))},
+		InLibrary: true,
+	}
+	if b.Title == "" {
+		b.Title, b.Authors = titleFromName(path, b.Authors)
+	}
+	b.Meta = lib.ParseMetadata(b)
+	if b.Meta.Year != 0 {
+		b.Year = strconv.Itoa(b.Meta.Year)
+	}
+	return b
+}
+
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// titleFromName guesses the title, and the authors if unknown, from a file
+// name such as "Homer - The Iliad.epub".
+func titleFromName(path, authors string) (string, string) {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
+	if author, title, ok := strings.Cut(name, " - "); ok && authors == "" {
+		return strings.TrimSpace(title), strings.TrimSpace(author)
+	}
+	return name, authors
+}
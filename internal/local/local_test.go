@@ -0,0 +1,293 @@
+package local
+
+import (
+    "archive/zip"
+    "context"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+const containerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const contentOPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>The Iliad</dc:title>
+    <dc:creator opf:role="aut">Homer</dc:creator>
+    <dc:language>en</dc:language>
+    <dc:publisher>Penguin</dc:publisher>
+    <dc:date>1998-11-01</dc:date>
+    <dc:identifier opf:scheme="ISBN">978-0-14-027536-0</dc:identifier>
+    <dc:identifier opf:scheme="UUID">urn:uuid:1234</dc:identifier>
+    <dc:description>&lt;p&gt;The war at Troy.&lt;/p&gt;</dc:description>
+  </metadata>
+</package>`
+
+const minimalPDF = `%PDF-1.4
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R /Outlines << /Title (Chapter One) >> >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [] /Count 0 >>
+endobj
+3 0 obj
+<< /Title <FEFF00570061006C00640065006E> /Author (Henry David Thoreau \(1817\)) /CreationDate (D:18540809000000) >>
+endobj
+trailer
+<< /Root 1 0 R /Info 3 0 R >>
+%%EOF
+`
+
+func writeEPUB(t *testing.T, path string) {
+    t.Helper()
+    out, err := os.Create(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    zw := zip.NewWriter(out)
+    for name, content := range map[string]string{
+        "mimetype":               "application/epub+zip",
+        "META-INF/container.xml": containerXML,
+        "OEBPS/content.opf":      contentOPF,
+    } {
+        w, err := zw.Create(name)
+        if err != nil {
+            t.Fatal(err)
+        }
+        w.Write([]byte(content))
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    out.Close()
+}
+
+// newLibrary returns a source over a directory with an EPUB, a PDF, a file
+// named after its book and a file that is not a book.
+func newLibrary(t *testing.T, mode string) (*Source, string) {
+    t.Helper()
+    t.Setenv("TOSHI_CACHE_DIR", t.TempDir())
+
+    dir := t.TempDir()
+    if err := os.MkdirAll(filepath.Join(dir, "Greek"), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    writeEPUB(t, filepath.Join(dir, "Greek", "iliad.epub"))
+    os.WriteFile(filepath.Join(dir, "walden.pdf"), []byte(minimalPDF), 0o644)
+    os.WriteFile(filepath.Join(dir, "Homer - The Odyssey.pdf"), []byte("%PDF-1.4\n"), 0o644)
+    os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("The Iliad"), 0o644)
+
+    s, err := New(lib.SourceConfig{Name: "nas", Kind: Kind, Path: dir, Options: map[string]string{"mode": mode}})
+    if err != nil {
+        t.Fatalf("New() error = %v", err)
+    }
+    return s, dir
+}
+
+func TestSearch_ReadsMetadata(t *testing.T) {
+    s, _ := newLibrary(t, "")
+
+    books, err := s.Search(context.Background(), "iliad")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 1 {
+        t.Fatalf("Search() = %d books, want 1: %#v", len(books), books)
+    }
+    b := books[0]
+    if b.ID != "Greek/iliad.epub" || b.Title != "The Iliad" || b.Authors != "Homer" || b.Year != "1998" ||
+        b.Publisher != "Penguin" || b.Extension != "epub" || !b.InLibrary || b.MD5 == "" {
+        t.Errorf("Search() book = %#v", b)
+    }
+    if len(b.ISBN) != 1 || b.ISBN[0] != "9780140275360" {
+        t.Errorf("ISBN = %v, want [9780140275360]", b.ISBN)
+    }
+
+    d, err := s.Details(context.Background(), b)
+    if err != nil || d.Description != "The war at Troy." || d.Identifiers["isbn"] != "9780140275360" {
+        t.Errorf("Details() = %#v, %v", d, err)
+    }
+
+    books, err = s.Search(context.Background(), "thoreau walden")
+    if err != nil || len(books) != 1 {
+        t.Fatalf("Search(thoreau walden) = %#v, %v", books, err)
+    }
+    if b := books[0]; b.Title != "Walden" || b.Authors != "Henry David Thoreau (1817)" || b.Year != "1854" {
+        t.Errorf("PDF book = %#v", b)
+    }
+
+    books, err = s.Search(context.Background(), "odyssey")
+    if err != nil || len(books) != 1 || books[0].Title != "The Odyssey" || books[0].Authors != "Homer" {
+        t.Errorf("Search(odyssey) = %#v, %v; want the title and author from the file name", books, err)
+    }
+
+    books, err = s.Search(context.Background(), "Homère ilia")
+    if err != nil || len(books) != 1 || books[0].Title != "The Iliad" {
+        t.Errorf("Search(Homère ilia) = %#v, %v; want The Iliad despite the accent", books, err)
+    }
+}
+
+func TestSearch_UpdatesIndex(t *testing.T) {
+    s, dir := newLibrary(t, "")
+    if _, err := s.Search(context.Background(), "homer"); err != nil {
+        t.Fatal(err)
+    }
+
+    os.Remove(filepath.Join(dir, "Greek", "iliad.epub"))
+    os.WriteFile(filepath.Join(dir, "Plato - Republic.pdf"), []byte("%PDF-1.4\n"), 0o644)
+
+    // A new source loads the saved index and brings it up to date.
+    again, err := New(lib.SourceConfig{Name: "nas", Kind: Kind, Path: dir})
+    if err != nil {
+        t.Fatal(err)
+    }
+    books, err := again.Search(context.Background(), "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var ids []string
+    for _, b := range books {
+        ids = append(ids, b.ID)
+    }
+    want := []string{"Homer - The Odyssey.pdf", "Plato - Republic.pdf", "walden.pdf"}
+    if len(ids) != len(want) {
+        t.Fatalf("indexed %v, want %v", ids, want)
+    }
+    for i := range want {
+        if ids[i] != want[i] {
+            t.Fatalf("indexed %v, want %v", ids, want)
+        }
+    }
+}
+
+func TestDownloadFile(t *testing.T) {
+    for _, mode := range []string{ModeCopy, ModeLink} {
+        t.Run(mode, func(t *testing.T) {
+            s, dir := newLibrary(t, mode)
+            books, err := s.Search(context.Background(), "walden")
+            if err != nil || len(books) != 1 {
+                t.Fatalf("Search() = %#v, %v", books, err)
+            }
+
+            out := t.TempDir()
+            links, err := s.ResolveDownloads(context.Background(), books[0])
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := s.DownloadFile(context.Background(), "walden.pdf", links[0], out); err != nil {
+                t.Fatalf("DownloadFile() error = %v", err)
+            }
+
+            dest := filepath.Join(out, "walden.pdf")
+            data, err := os.ReadFile(dest)
+            if err != nil || string(data) != minimalPDF {
+                t.Fatalf("downloaded file = %q, %v", data, err)
+            }
+            info, err := os.Lstat(dest)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if isLink := info.Mode()&os.ModeSymlink != 0; isLink != (mode == ModeLink) {
+                t.Errorf("symlink = %v in %s mode", isLink, mode)
+            }
+            if mode == ModeLink {
+                if target, _ := os.Readlink(dest); target != filepath.Join(dir, "walden.pdf") {
+                    t.Errorf("link target = %s", target)
+                }
+            }
+        })
+    }
+
+    s, _ := newLibrary(t, "")
+    if err := s.DownloadFile(context.Background(), "x.pdf", "file:///etc/passwd", t.TempDir()); err == nil {
+        t.Error("expected error for a file outside the library")
+    }
+}
+
+func TestNew_Errors(t *testing.T) {
+    if _, err := New(lib.SourceConfig{Name: "nas", Kind: Kind}); err == nil {
+        t.Error("expected error without a path")
+    }
+    if _, err := New(lib.SourceConfig{Name: "nas", Kind: Kind, Path: ".", Options: map[string]string{"mode": "move"}}); err == nil {
+        t.Error("expected error for an unknown mode")
+    }
+}
+
+func TestSearch_KeepsPartialIndex(t *testing.T) {
+    s, dir := newLibrary(t, "")
+
+    // Cancel the search once the first file is indexed.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    read := readFile
+    t.Cleanup(func() { readFile = read })
+    readFile = func(ctx context.Context, path string, info fs.FileInfo) (file, error) {
+        f, err := read(ctx, path, info)
+        cancel()
+        return f, err
+    }
+
+    books, err := s.Search(ctx, "")
+    if err != nil {
+        t.Fatalf("interrupted Search() error = %v", err)
+    }
+    if len(books) != 1 {
+        t.Fatalf("interrupted Search() = %d books, want the 1 indexed", len(books))
+    }
+
+    // A new source continues from the saved index, reading only the rest.
+    var reread []string
+    readFile = func(ctx context.Context, path string, info fs.FileInfo) (file, error) {
+        reread = append(reread, path)
+        return read(ctx, path, info)
+    }
+    again, err := New(lib.SourceConfig{Name: "nas", Kind: Kind, Path: dir})
+    if err != nil {
+        t.Fatal(err)
+    }
+    books, err = again.Search(context.Background(), "")
+    if err != nil || len(books) != 3 {
+        t.Fatalf("Search() = %d books, %v; want 3", len(books), err)
+    }
+    if len(reread) != 2 {
+        t.Fatalf("read %v again, want only the 2 files not indexed before", reread)
+    }
+}
+
+func TestDownloadFile_OntoItself(t *testing.T) {
+    for _, mode := range []string{ModeCopy, ModeLink} {
+        t.Run(mode, func(t *testing.T) {
+            // The output directory is inside the library.
+            s, dir := newLibrary(t, mode)
+            out := filepath.Join(dir, "output")
+            if err := os.MkdirAll(out, 0o755); err != nil {
+                t.Fatal(err)
+            }
+            src := filepath.Join(out, "walden.pdf")
+            if err := os.WriteFile(src, []byte(minimalPDF), 0o644); err != nil {
+                t.Fatal(err)
+            }
+
+            if err := s.DownloadFile(context.Background(), "walden.pdf", fileURL(src), out); err != nil {
+                t.Fatalf("DownloadFile() error = %v", err)
+            }
+            info, err := os.Lstat(src)
+            if err != nil {
+                t.Fatalf("library file is gone: %v", err)
+            }
+            data, err := os.ReadFile(src)
+            if info.Mode()&os.ModeSymlink != 0 || err != nil || string(data) != minimalPDF {
+                t.Fatalf("library file = %q, %v, mode %v; want it untouched", data, err, info.Mode())
+            }
+        })
+    }
+}
@@ -0,0 +1,214 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+)
+
+// PDFs larger than maxPDFRead are only read pdfChunk bytes from either end,
+// where the document information and XMP metadata usually are.
+const (
+	maxPDFRead = 32 << 20
+	pdfChunk   = 4 << 20
+)
+
+var (
+	infoRef   = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	xmpTitle  = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpAuthor = regexp.MustCompile(`(?s)<dc:creator>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	pdfDate   = regexp.MustCompile(`^D:(\d{4})`)
+)
+
+// readPDF sets f's title, author and date from the document information
+// dictionary of the PDF in, or from its XMP metadata. Information in
+// compressed object streams is not read.
+func readPDF(in *os.File, f *file) error {
+	data, err := pdfData(in, f.Size)
+	if err != nil {
+		return err
+	}
+
+	if info := infoDict(data); info != nil {
+		f.Title = pdfString(info, "Title")
+		if author := pdfString(info, "Author"); author != "" {
+			f.Authors = []string{author}
+		}
+		if m := pdfDate.FindStringSubmatch(pdfString(info, "CreationDate")); m != nil {
+			f.Date = m[1]
+		}
+	}
+	if f.Title == "" {
+		if m := xmpTitle.FindSubmatch(data); m != nil {
+			f.Title = collapseSpace(html.UnescapeString(string(m[1])))
+		}
+	}
+	if len(f.Authors) == 0 {
+		if m := xmpAuthor.FindSubmatch(data); m != nil {
+			if author := collapseSpace(html.UnescapeString(string(m[1]))); author != "" {
+				f.Authors = []string{author}
+			}
+		}
+	}
+	if f.Title == "" {
+		return errors.New("no title")
+	}
+	return nil
+}
+
+func pdfData(in *os.File, size int64) ([]byte, error) {
+	if size <= maxPDFRead {
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.ReadAll(in)
+	}
+	data := make([]byte, 2*pdfChunk)
+	if _, err := in.ReadAt(data[:pdfChunk], 0); err != nil {
+		return nil, err
+	}
+	if _, err := in.ReadAt(data[pdfChunk:], size-pdfChunk); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// infoDict returns the document information object named by the last
+// trailer, or nil.
+func infoDict(data []byte) []byte {
+	refs := infoRef.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return nil
+	}
+	ref := refs[len(refs)-1]
+	header := regexp.MustCompile(fmt.Sprintf(`(?:^|[^0-9])%s\s+%s\s+obj`, ref[1], ref[2]))
+	locs := header.FindAllIndex(data, -1)
+	if len(locs) == 0 {
+		return nil
+	}
+	obj := data[locs[len(locs)-1][1]:]
+	if end := bytes.Index(obj, []byte("endobj")); end >= 0 {
+		obj = obj[:end]
+	}
+	return obj
+}
+
+// pdfString returns the text string value of key in dict, or "".
+func pdfString(dict []byte, key string) string {
+	i := bytes.Index(dict, []byte("/"+key))
+	if i < 0 {
+		return ""
+	}
+	rest := bytes.TrimLeft(dict[i+len(key)+1:], " \t\r\n")
+	if len(rest) == 0 {
+		return ""
+	}
+
+	var raw []byte
+	switch rest[0] {
+	case '(':
+		raw = literalString(rest[1:])
+	case '<':
+		end := bytes.IndexByte(rest, '>')
+		if end < 0 {
+			return ""
+		}
+		raw = hexString(rest[1:end])
+	default:
+		return ""
+	}
+	return collapseSpace(textString(raw))
+}
+
+// literalString decodes a literal string up to its closing parenthesis.
+func literalString(s []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case '\\':
+			i++
+			if i == len(s) {
+				return out
+			}
+			switch c = s[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					j := i
+					for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(s[i:j]), 8, 8)
+					c, i = byte(n), j-1
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func hexString(s []byte) []byte {
+	var digits []byte
+	for _, c := range s {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// textString decodes a PDF text string, which is UTF-16BE with a byte order
+// mark, UTF-8 with one, or else treated as Latin-1.
+func textString(b []byte) string {
+	switch {
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		b = b[2:]
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+		return string(utf16.Decode(units))
+	case bytes.HasPrefix(b, []byte("\xef\xbb\xbf")):
+		return string(b[3:])
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
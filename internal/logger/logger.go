@@ -14,7 +14,8 @@ const (
 
 var (
 	logLevel = LevelInfo // Shared log level
-	logger   = log.New(os.Stdout, "", log.LstdFlags)
+	// Messages go to stderr, keeping stdout for results.
+	logger = log.New(os.Stderr, "", log.LstdFlags)
 )
 
 // Configure sets up the global log level and output.
@@ -0,0 +1,581 @@
+package opds
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Link relations and media types used by OPDS 1.2 and 2.0.
+const (
+	atomNS         = "http://www.w3.org/2005/Atom"
+	relAcquisition = "http://opds-spec.org/acquisition"
+	relImage       = "http://opds-spec.org/image"
+	relThumbnail   = "http://opds-spec.org/image/thumbnail"
+	typeAtom       = "application/atom+xml"
+	typeOPDSJSON   = "application/opds+json"
+	typeOpenSearch = "application/opensearchdescription+xml"
+)
+
+// feed is an OPDS feed of either version, with every link made absolute.
+type feed struct {
+	entries []entry
+	// next is the next page of the feed.
+	next string
+	// navigation lists the subsections to follow for more entries.
+	navigation []string
+	// partial lists the full entries of partial entries, whose
+	// acquisitions are only given there.
+	partial []string
+	// search is a search URL template, and openSearch an OpenSearch
+	// description document holding one.
+	search     string
+	openSearch string
+}
+
+// entry is a publication in a feed.
+type entry struct {
+	id          string
+	title       string
+	authors     []string
+	summary     string
+	language    string
+	publisher   string
+	issued      string
+	identifiers []string
+	// alternate is the full entry or a web page about the publication.
+	alternate    string
+	cover        string
+	acquisitions []acquisition
+}
+
+// acquisition is a link to download a publication in one format.
+type acquisition struct {
+	href   string
+	mime   string
+	length int64
+}
+
+// parseFeed parses an OPDS 1.2 Atom document, a feed or a single entry, or
+// an OPDS 2.0 JSON feed fetched from base.
+func parseFeed(data []byte, base string) (*feed, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJSONFeed(trimmed, baseURL)
+	}
+	return parseAtomFeed(trimmed, baseURL)
+}
+
+// resolve returns href made absolute against base, or "" if it is invalid.
+func resolve(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// isAcquisition reports whether rel is an acquisition that can be
+// downloaded directly, rather than bought, borrowed or sampled.
+func isAcquisition(rel string) bool {
+	return rel == relAcquisition || rel == relAcquisition+"/open-access"
+}
+
+// isCatalog reports whether mime is an OPDS feed or entry.
+func isCatalog(mime string) bool {
+	return strings.HasPrefix(mime, typeAtom) || strings.HasPrefix(mime, typeOPDSJSON)
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type atomPerson struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+}
+
+type atomEntry struct {
+	ID      string       `xml:"http://www.w3.org/2005/Atom id"`
+	Title   string       `xml:"http://www.w3.org/2005/Atom title"`
+	Authors []atomPerson `xml:"http://www.w3.org/2005/Atom author"`
+	Summary atomText     `xml:"http://www.w3.org/2005/Atom summary"`
+	Content atomText     `xml:"http://www.w3.org/2005/Atom content"`
+	Links   []atomLink   `xml:"http://www.w3.org/2005/Atom link"`
+	// Dublin Core elements, from either the elements or the terms namespace.
+	Language   []string `xml:"language"`
+	Publisher  []string `xml:"publisher"`
+	Issued     []string `xml:"issued"`
+	Date       []string `xml:"date"`
+	Identifier []string `xml:"identifier"`
+	Published  string   `xml:"http://www.w3.org/2005/Atom published"`
+}
+
+type atomFeed struct {
+	Links   []atomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Entries []atomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+func parseAtomFeed(data []byte, base *url.URL) (*feed, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var af atomFeed
+	switch root {
+	case xml.Name{Space: atomNS, Local: "feed"}:
+		if err := xml.Unmarshal(data, &af); err != nil {
+			return nil, fmt.Errorf("error parsing OPDS feed: %w", err)
+		}
+	case xml.Name{Space: atomNS, Local: "entry"}:
+		var ae atomEntry
+		if err := xml.Unmarshal(data, &ae); err != nil {
+			return nil, fmt.Errorf("error parsing OPDS entry: %w", err)
+		}
+		af.Entries = []atomEntry{ae}
+	default:
+		return nil, fmt.Errorf("not an OPDS feed: root element is <%s>", root.Local)
+	}
+
+	f := &feed{}
+	for _, l := range af.Links {
+		href := resolve(base, l.Href)
+		switch {
+		case l.Rel == "next":
+			f.next = href
+		case l.Rel == "search" && strings.HasPrefix(l.Type, typeOpenSearch):
+			f.openSearch = href
+		case l.Rel == "search" && isCatalog(l.Type):
+			f.search = href
+		}
+	}
+
+	for _, ae := range af.Entries {
+		e := entry{
+			id:          strings.TrimSpace(ae.ID),
+			title:       collapseSpace(ae.Title),
+			summary:     atomPlainText(ae.Summary),
+			language:    first(ae.Language),
+			publisher:   first(ae.Publisher),
+			issued:      first(append(append(ae.Issued, ae.Date...), ae.Published)),
+			identifiers: ae.Identifier,
+		}
+		if e.summary == "" {
+			e.summary = atomPlainText(ae.Content)
+		}
+		for _, a := range ae.Authors {
+			if name := collapseSpace(a.Name); name != "" {
+				e.authors = append(e.authors, name)
+			}
+		}
+
+		var navigation, alternateType string
+		for _, l := range ae.Links {
+			href := resolve(base, l.Href)
+			switch {
+			case href == "":
+			case isAcquisition(l.Rel):
+				e.acquisitions = append(e.acquisitions, acquisition{href: href, mime: l.Type, length: l.Length})
+			case l.Rel == relImage || l.Rel == relThumbnail && e.cover == "":
+				e.cover = href
+			case l.Rel == "alternate" && (e.alternate == "" || strings.HasPrefix(l.Type, typeAtom)):
+				e.alternate, alternateType = href, l.Type
+			case isCatalog(l.Type) && !strings.HasPrefix(l.Rel, relAcquisition) && navigation == "":
+				navigation = href
+			}
+		}
+
+		if len(e.acquisitions) == 0 {
+			// A partial entry whose acquisitions are in the full entry,
+			// or a navigation entry.
+			switch {
+			case strings.HasPrefix(e.alternate, "http") && strings.Contains(alternateType, "type=entry"):
+				f.partial = append(f.partial, e.alternate)
+			case navigation != "":
+				f.navigation = append(f.navigation, navigation)
+			case strings.HasPrefix(e.alternate, "http") && isCatalogLink(ae.Links, e.alternate, base):
+				f.navigation = append(f.navigation, e.alternate)
+			}
+			continue
+		}
+		if e.id == "" {
+			e.id = e.acquisitions[0].href
+		}
+		f.entries = append(f.entries, e)
+	}
+	return f, nil
+}
+
+// isCatalogLink reports whether the link to href in links has an OPDS type.
+func isCatalogLink(links []atomLink, href string, base *url.URL) bool {
+	for _, l := range links {
+		if resolve(base, l.Href) == href && isCatalog(l.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// rootElement returns the name of the document's root element.
+func rootElement(data []byte) (xml.Name, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.Name{}, fmt.Errorf("error parsing OPDS feed: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// atomPlainText returns the text of an Atom text construct without markup.
+func atomPlainText(t atomText) string {
+	switch t.Type {
+	case "html":
+		return htmlText(t.Text)
+	case "xhtml":
+		return htmlText(t.Inner)
+	}
+	return collapseSpace(t.Text)
+}
+
+// htmlText returns the text of an HTML fragment.
+func htmlText(fragment string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+	if err != nil {
+		return collapseSpace(fragment)
+	}
+	return collapseSpace(doc.Text())
+}
+
+type openSearchDescription struct {
+	URLs []struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+// parseOpenSearch returns the search template for OPDS results from an
+// OpenSearch description document.
+func parseOpenSearch(data []byte, base string) (string, error) {
+	var desc openSearchDescription
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return "", fmt.Errorf("error parsing OpenSearch description: %w", err)
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	template := ""
+	for _, u := range desc.URLs {
+		if !isCatalog(u.Type) {
+			continue
+		}
+		// Prefer the template that returns acquisition feeds.
+		if template == "" || strings.Contains(u.Type, "kind=acquisition") {
+			template = u.Template
+		}
+	}
+	if template == "" {
+		return "", errors.New("OpenSearch description has no template for OPDS results")
+	}
+	// Keep the braces of the template's parameters from being escaped.
+	return strings.NewReplacer("%7B", "{", "%7D", "}").Replace(resolve(baseURL, template)), nil
+}
+
+var templateParamRegex = regexp.MustCompile(`\{([?&]?)([^}]*)\}`)
+
+// expandTemplate fills a search template with term. It accepts OpenSearch
+// templates such as /search?q={searchTerms}&page={startPage?} and the URI
+// templates of OPDS 2.0 such as /search{?query,author}. Other parameters
+// are left empty.
+func expandTemplate(template, term string) string {
+	query := strings.Index(template, "?")
+	return templateParamRegex.ReplaceAllStringFunc(template, func(param string) string {
+		match := templateParamRegex.FindStringSubmatch(param)
+		operator, names := match[1], strings.Split(match[2], ",")
+
+		if operator != "" {
+			for _, name := range names {
+				if name == "query" {
+					return operator + "query=" + url.QueryEscape(term)
+				}
+			}
+			return ""
+		}
+
+		if strings.TrimSuffix(names[0], "?") != "searchTerms" {
+			return ""
+		}
+		if query >= 0 && query < strings.Index(template, param) {
+			return url.QueryEscape(term)
+		}
+		return url.PathEscape(term)
+	})
+}
+
+// stringList is a JSON value that is either a string or a list of them.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*l = stringList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*l = many
+	return nil
+}
+
+// localized is a JSON string that may be given per language.
+type localized string
+
+func (s *localized) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*s = localized(one)
+		return nil
+	}
+	var byLang map[string]string
+	if err := json.Unmarshal(data, &byLang); err != nil {
+		return err
+	}
+	langs := make([]string, 0, len(byLang))
+	for lang := range byLang {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		if lang == "en" {
+			*s = localized(byLang[lang])
+			return nil
+		}
+	}
+	if len(langs) > 0 {
+		*s = localized(byLang[langs[0]])
+	}
+	return nil
+}
+
+// contributors is a JSON contributor list: a name, an object with a name,
+// or a list of either.
+type contributors []string
+
+func (c *contributors) UnmarshalJSON(data []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(data, &list); err != nil {
+		list = []json.RawMessage{data}
+	}
+	for _, raw := range list {
+		var name localized
+		if err := json.Unmarshal(raw, &name); err == nil {
+			*c = append(*c, string(name))
+			continue
+		}
+		var obj struct {
+			Name localized `json:"name"`
+		}
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return err
+		}
+		*c = append(*c, string(obj.Name))
+	}
+	return nil
+}
+
+type jsonLink struct {
+	Rel       stringList `json:"rel"`
+	Href      string     `json:"href"`
+	Type      string     `json:"type"`
+	Templated bool       `json:"templated"`
+}
+
+func (l jsonLink) has(rel string) bool {
+	for _, r := range l.Rel {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonPublication struct {
+	Metadata struct {
+		Identifier  string       `json:"identifier"`
+		Title       localized    `json:"title"`
+		Author      contributors `json:"author"`
+		Language    stringList   `json:"language"`
+		Publisher   contributors `json:"publisher"`
+		Published   string       `json:"published"`
+		Description string       `json:"description"`
+	} `json:"metadata"`
+	Links  []jsonLink `json:"links"`
+	Images []jsonLink `json:"images"`
+}
+
+type jsonGroup struct {
+	Navigation   []jsonLink        `json:"navigation"`
+	Publications []jsonPublication `json:"publications"`
+}
+
+type jsonFeed struct {
+	Links []jsonLink `json:"links"`
+	jsonGroup
+	Groups []jsonGroup `json:"groups"`
+}
+
+func parseJSONFeed(data []byte, base *url.URL) (*feed, error) {
+	var jf jsonFeed
+	if err := json.Unmarshal(data, &jf); err != nil {
+		return nil, fmt.Errorf("error parsing OPDS feed: %w", err)
+	}
+
+	f := &feed{}
+	for _, l := range jf.Links {
+		switch {
+		case l.has("next"):
+			f.next = resolve(base, l.Href)
+		case l.has("search") && l.Templated:
+			f.search = strings.NewReplacer("%7B", "{", "%7D", "}").Replace(resolve(base, l.Href))
+		case l.has("search") && strings.HasPrefix(l.Type, typeOpenSearch):
+			f.openSearch = resolve(base, l.Href)
+		}
+	}
+
+	for _, group := range append([]jsonGroup{jf.jsonGroup}, jf.Groups...) {
+		for _, l := range group.Navigation {
+			if href := resolve(base, l.Href); href != "" {
+				f.navigation = append(f.navigation, href)
+			}
+		}
+		for _, pub := range group.Publications {
+			if e, ok := jsonEntry(pub, base); ok {
+				f.entries = append(f.entries, e)
+			}
+		}
+	}
+	return f, nil
+}
+
+// jsonEntry maps an OPDS 2.0 publication to an entry, reporting false if it
+// has nothing to download.
+func jsonEntry(pub jsonPublication, base *url.URL) (entry, bool) {
+	m := pub.Metadata
+	e := entry{
+		id:        strings.TrimSpace(m.Identifier),
+		title:     collapseSpace(string(m.Title)),
+		authors:   m.Author,
+		summary:   htmlText(m.Description),
+		language:  first(m.Language),
+		publisher: first(m.Publisher),
+		issued:    m.Published,
+	}
+	if e.id != "" {
+		e.identifiers = []string{e.id}
+	}
+
+	for _, l := range pub.Links {
+		href := resolve(base, l.Href)
+		switch {
+		case href == "":
+		case l.has(relAcquisition) || l.has(relAcquisition+"/open-access"):
+			e.acquisitions = append(e.acquisitions, acquisition{href: href, mime: l.Type})
+		case l.has("self") || l.has("alternate") && e.alternate == "":
+			e.alternate = href
+		}
+	}
+	for _, img := range pub.Images {
+		if e.cover == "" {
+			e.cover = resolve(base, img.Href)
+		}
+	}
+
+	if len(e.acquisitions) == 0 {
+		return entry{}, false
+	}
+	if e.id == "" {
+		e.id = e.acquisitions[0].href
+	}
+	return e, true
+}
+
+// mimeExtensions maps the media types of ebook formats to file extensions.
+var mimeExtensions = map[string]string{
+	"application/epub+zip":           "epub",
+	"application/kepub+zip":          "kepub",
+	"application/pdf":                "pdf",
+	"application/x-mobipocket-ebook": "mobi",
+	"application/x-mobi8-ebook":      "azw3",
+	"application/vnd.amazon.ebook":   "azw",
+	"application/x-fictionbook+xml":  "fb2",
+	"application/fb2+zip":            "fb2",
+	"application/vnd.comicbook+zip":  "cbz",
+	"application/x-cbz":              "cbz",
+	"application/vnd.comicbook-rar":  "cbr",
+	"application/x-cbr":              "cbr",
+	"image/vnd.djvu":                 "djvu",
+	"application/rtf":                "rtf",
+	"text/plain":                     "txt",
+	"text/html":                      "html",
+}
+
+// extension returns the file extension for an acquisition, from its media
+// type or else its URL.
+func extension(a acquisition) string {
+	mime, _, _ := strings.Cut(a.mime, ";")
+	if ext, ok := mimeExtensions[strings.TrimSpace(strings.ToLower(mime))]; ok {
+		return ext
+	}
+	if u, err := url.Parse(a.href); err == nil {
+		return strings.TrimPrefix(strings.ToLower(path.Ext(u.Path)), ".")
+	}
+	return ""
+}
+
+func first(values []string) string {
+	for _, v := range values {
+		if v = collapseSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// collapseSpace trims s and replaces runs of whitespace with single spaces.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,305 @@
+// Package opds searches OPDS 1.2 and 2.0 catalogs, such as those of
+// Calibre-Web, Kavita, Standard Ebooks or Project Gutenberg, as a toshi
+// source.
+package opds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+	"github.com/mfkd/toshi/internal/lib"
+	"github.com/mfkd/toshi/internal/logger"
+	"github.com/mfkd/toshi/internal/scraper"
+)
+
+// Kind is the kind of OPDS sources in sources.json.
+const Kind = "opds"
+
+// maxPages bounds the feed pages fetched for one search, counting
+// pagination and navigation.
+const maxPages = 20
+
+func init() {
+	lib.RegisterSource(Kind, func(cfg lib.SourceConfig, deps lib.SourceDeps) (lib.Source, error) {
+		return New(cfg, deps)
+	})
+}
+
+// Source is an OPDS catalog. Searches use the catalog's OpenSearch or OPDS
+// 2.0 search template; catalogs without one are crawled from the root feed
+// and their entries matched against the term. Each format of a publication
+// becomes a book, downloaded from its acquisition link.
+type Source struct {
+	name   string
+	root   string
+	bodies scraper.BodyFetcher
+	files  scraper.FileDownloader
+
+	// host, username and password authenticate requests to the catalog
+	// with HTTP basic authentication, if username is set.
+	host, username, password string
+
+	mu       sync.Mutex
+	template string
+	// resolved is set once the root feed has been checked for a template.
+	resolved bool
+	// entries are the entries found by searches, by ID, for Details.
+	entries map[string]entry
+}
+
+// New returns the OPDS source configured by cfg, whose URL is the root feed.
+// The "username" and "password" options authenticate to the catalog.
+func New(cfg lib.SourceConfig, deps lib.SourceDeps) (*Source, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("OPDS source %q needs the URL of the catalog's root feed", cfg.Name)
+	}
+	root, err := url.Parse(cfg.URL)
+	if err != nil || (root.Scheme != "http" && root.Scheme != "https") || root.Host == "" {
+		return nil, fmt.Errorf("OPDS source %q: invalid URL %q", cfg.Name, cfg.URL)
+	}
+	if root.User != nil {
+		return nil, fmt.Errorf(`OPDS source %q: give credentials in "options" as "username" and "password", not in the URL`, cfg.Name)
+	}
+	if deps.Bodies == nil || deps.Files == nil {
+		return nil, errors.New("OPDS source needs a body fetcher and a downloader")
+	}
+	return &Source{
+		name:     cfg.Name,
+		root:     cfg.URL,
+		bodies:   deps.Bodies,
+		files:    deps.Files,
+		host:     root.Host,
+		username: cfg.Options["username"],
+		password: cfg.Options["password"],
+		entries:  make(map[string]entry),
+	}, nil
+}
+
+func (s *Source) Name() string { return s.name }
+
+// authorize returns ctx with the catalog's credentials, if any.
+func (s *Source) authorize(ctx context.Context) context.Context {
+	if s.username == "" {
+		return ctx
+	}
+	return scraper.WithBasicAuth(ctx, s.host, s.username, s.password)
+}
+
+// Search returns a book for every downloadable format of the entries found
+// for term.
+func (s *Source) Search(ctx context.Context, term string) ([]lib.Book, error) {
+	template, err := s.searchTemplate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if template == "" {
+		logger.Debugf("%s has no search, crawling the catalog for %q\n", s.name, term)
+		return s.crawl(ctx, s.root, term, true)
+	}
+	return s.crawl(ctx, expandTemplate(template, term), "", false)
+}
+
+// searchTemplate returns the catalog's search template, or "" if it has
+// none. It is looked up once, from the root feed.
+func (s *Source) searchTemplate(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resolved {
+		return s.template, nil
+	}
+
+	root, err := s.fetchFeed(ctx, s.root)
+	if err != nil {
+		return "", err
+	}
+	s.template = root.search
+	if s.template == "" && root.openSearch != "" {
+		data, err := s.bodies.Fetch(s.authorize(ctx), root.openSearch)
+		if err != nil {
+			return "", fmt.Errorf("error loading OpenSearch description: %w", err)
+		}
+		if s.template, err = parseOpenSearch(data, root.openSearch); err != nil {
+			return "", err
+		}
+	}
+	s.resolved = true
+	return s.template, nil
+}
+
+// crawl collects the books of the feed at start, following pagination and
+// partial entries, and navigation links if browse is set, up to maxPages.
+// If match is set, only entries whose title or authors contain all of its
+// words are kept.
+func (s *Source) crawl(ctx context.Context, start, match string, browse bool) ([]lib.Book, error) {
+	var books []lib.Book
+	queue := []string{start}
+	visited := map[string]bool{start: true}
+
+	for pages := 0; len(queue) > 0; pages++ {
+		if pages == maxPages {
+			logger.Debugf("Stopped reading %s after %d pages\n", s.name, maxPages)
+			break
+		}
+		current := queue[0]
+		queue = queue[1:]
+
+		f, err := s.fetchFeed(scraper.AsSearch(ctx), current)
+		if err != nil {
+			if current == start {
+				return nil, err
+			}
+			logger.Debugf("Skipping feed %s: %v\n", current, err)
+			continue
+		}
+
+		s.mu.Lock()
+		for _, e := range f.entries {
+			if match != "" && !matches(e, match) {
+				continue
+			}
+			s.entries[e.id] = e
+			books = append(books, entryBooks(e)...)
+		}
+		s.mu.Unlock()
+
+		links := append([]string{f.next}, f.partial...)
+		if browse {
+			links = append(links, f.navigation...)
+		}
+		for _, next := range links {
+			if next != "" && !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return books, nil
+}
+
+func (s *Source) fetchFeed(ctx context.Context, url string) (*feed, error) {
+	data, err := s.bodies.Fetch(s.authorize(ctx), url)
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data, url)
+}
+
+// Details returns the metadata of b's entry. Entries found by an earlier
+// search in this process are used as they are; otherwise b's full entry is
+// loaded if it links to one.
+func (s *Source) Details(ctx context.Context, b lib.Book) (*lib.Details, error) {
+	s.mu.Lock()
+	e, ok := s.entries[b.ID]
+	s.mu.Unlock()
+
+	if !ok && b.Edit != "" {
+		if f, err := s.fetchFeed(ctx, b.Edit); err == nil {
+			for _, candidate := range f.entries {
+				if candidate.id == b.ID {
+					e, ok = candidate, true
+					break
+				}
+			}
+		}
+	}
+	if !ok {
+		return &lib.Details{Book: b, URL: b.Edit}, nil
+	}
+
+	d := &lib.Details{
+		Book:        b,
+		Description: e.summary,
+		CoverURL:    e.cover,
+		URL:         e.alternate,
+	}
+	for _, id := range e.identifiers {
+		scheme, value, ok := identifier(id)
+		if !ok {
+			continue
+		}
+		if d.Identifiers == nil {
+			d.Identifiers = make(map[string]string)
+		}
+		if d.Identifiers[scheme] == "" {
+			d.Identifiers[scheme] = value
+		}
+	}
+	return d, nil
+}
+
+// ResolveDownloads returns b's acquisition link.
+func (s *Source) ResolveDownloads(ctx context.Context, b lib.Book) ([]string, error) {
+	if len(b.Mirrors) == 0 {
+		return nil, fmt.Errorf("%s has no download link for %s", s.name, b.Title)
+	}
+	return b.Mirrors, nil
+}
+
+// DownloadFile downloads an acquisition link, authenticating if it is on
+// the catalog's host.
+func (s *Source) DownloadFile(ctx context.Context, filename, link, dir string) error {
+	return s.files.DownloadFile(s.authorize(ctx), filename, link, dir)
+}
+
+// entryBooks returns a book for each acquisition of e.
+func entryBooks(e entry) []lib.Book {
+	var isbns []string
+	for _, id := range e.identifiers {
+		if scheme, value, ok := identifier(id); ok && scheme == "isbn" {
+			isbns = append(isbns, value)
+		}
+	}
+
+	books := make([]lib.Book, 0, len(e.acquisitions))
+	for _, a := range e.acquisitions {
+		b := lib.Book{
+			ID:        e.id,
+			Authors:   strings.Join(e.authors, "; "),
+			Title:     e.title,
+			ISBN:      isbns,
+			Publisher: e.publisher,
+			Year:      e.issued,
+			Language:  e.language,
+			Size:      lib.FormatSize(a.length),
+			Extension: extension(a),
+			Mirrors:   []string{a.href},
+			Edit:      e.alternate,
+		}
+		b.Meta = lib.ParseMetadata(b)
+		if b.Meta.Year != 0 {
+			// Show the year of dates such as 2004-05-01.
+			b.Year = strconv.Itoa(b.Meta.Year)
+		}
+		books = append(books, b)
+	}
+	return books
+}
+
+// identifier splits an identifier such as "urn:isbn:9780140275360" into
+// its scheme and value.
+func identifier(id string) (string, string, bool) {
+	id = strings.TrimSpace(id)
+	lower := strings.ToLower(id)
+	for _, scheme := range []string{"isbn", "doi", "issn"} {
+		for _, prefix := range []string{"urn:" + scheme + ":", scheme + ":"} {
+			if strings.HasPrefix(lower, prefix) {
+				return scheme, strings.TrimSpace(id[len(prefix):]), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// matches reports whether every word of term appears in e's title or
+// authors, ignoring case and diacritics and allowing for small spelling
+// differences.
+func matches(e entry, term string) bool {
+	return fuzzy.ContainsWords(e.title+" "+strings.Join(e.authors, " "), term)
+}
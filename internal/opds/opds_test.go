@@ -0,0 +1,372 @@
+package opds
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+    "github.com/mfkd/toshi/internal/scraper"
+)
+
+const atomRoot = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:uuid:root</id>
+  <title>Library</title>
+  <link rel="search" type="application/opensearchdescription+xml" href="/opds/osd"/>
+  <entry>
+    <title>By Author</title>
+    <link rel="subsection" type="application/atom+xml;profile=opds-catalog;kind=navigation" href="/opds/authors"/>
+  </entry>
+</feed>`
+
+const openSearch = `<?xml version="1.0" encoding="UTF-8"?>
+<OpenSearchDescription xmlns="http://a9.com/-/spec/opensearch/1.1/">
+  <Url type="text/html" template="/search.html?q={searchTerms}"/>
+  <Url type="application/atom+xml;profile=opds-catalog;kind=acquisition" template="/opds/search/{searchTerms}?page={startPage?}"/>
+</OpenSearchDescription>`
+
+const atomResults = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/">
+  <id>urn:uuid:search</id>
+  <link rel="next" type="application/atom+xml;profile=opds-catalog" href="/opds/search/page2"/>
+  <entry>
+    <id>urn:uuid:iliad</id>
+    <title>The Iliad</title>
+    <author><name>Homer</name></author>
+    <dc:language>en</dc:language>
+    <dc:publisher>Penguin</dc:publisher>
+    <dc:issued>1998-11-01</dc:issued>
+    <dc:identifier>urn:isbn:9780140275360</dc:identifier>
+    <summary type="html">&lt;p&gt;The &lt;b&gt;war&lt;/b&gt; at Troy.&lt;/p&gt;</summary>
+    <link rel="http://opds-spec.org/image" href="/covers/iliad.jpg"/>
+    <link rel="alternate" type="application/atom+xml;type=entry;profile=opds-catalog" href="/opds/book/iliad"/>
+    <link rel="http://opds-spec.org/acquisition" type="application/epub+zip" href="/download/iliad.epub" length="1572864"/>
+    <link rel="http://opds-spec.org/acquisition/open-access" type="application/pdf" href="/download/iliad.pdf"/>
+    <link rel="http://opds-spec.org/acquisition/buy" type="text/html" href="/buy/iliad"/>
+  </entry>
+</feed>`
+
+const atomResultsPage2 = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:uuid:search2</id>
+  <entry>
+    <id>urn:uuid:odyssey</id>
+    <title>The Odyssey</title>
+    <author><name>Homer</name></author>
+    <link rel="http://opds-spec.org/acquisition" type="application/epub+zip" href="/download/odyssey.epub"/>
+  </entry>
+</feed>`
+
+const jsonFeedDoc = `{
+  "metadata": {"title": "Standard Library"},
+  "links": [
+    {"rel": "self", "href": "/opds2", "type": "application/opds+json"},
+    {"rel": "search", "href": "/opds2/search{?query,author}", "type": "application/opds+json", "templated": true}
+  ],
+  "publications": [
+    {
+      "metadata": {
+        "identifier": "urn:isbn:9780199537853",
+        "title": {"fr": "L'Énéide", "en": "The Aeneid"},
+        "author": [{"name": "Virgil"}, "Publius Vergilius Maro"],
+        "language": ["en"],
+        "published": "2008",
+        "description": "An epic poem."
+      },
+      "links": [
+        {"rel": "http://opds-spec.org/acquisition/open-access", "href": "/books/aeneid.epub", "type": "application/epub+zip"}
+      ],
+      "images": [{"href": "/covers/aeneid.jpg", "type": "image/jpeg"}]
+    }
+  ]
+}`
+
+func newCatalog(t *testing.T) (*httptest.Server, *[]string) {
+    t.Helper()
+    var requested []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requested = append(requested, r.URL.RequestURI())
+        switch r.URL.Path {
+        case "/opds":
+            fmt.Fprint(w, atomRoot)
+        case "/opds/osd":
+            fmt.Fprint(w, openSearch)
+        case "/opds/search/homer iliad", "/opds/search/homer":
+            fmt.Fprint(w, atomResults)
+        case "/opds/search/page2":
+            fmt.Fprint(w, atomResultsPage2)
+        case "/opds2", "/opds2/search":
+            w.Header().Set("Content-Type", "application/opds+json")
+            fmt.Fprint(w, jsonFeedDoc)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+    return srv, &requested
+}
+
+func newSource(t *testing.T, url string) *Source {
+    t.Helper()
+    s := scraper.NewScraper(url)
+    src, err := New(lib.SourceConfig{Name: "calibre", Kind: Kind, URL: url}, lib.SourceDeps{Bodies: s, Files: s})
+    if err != nil {
+        t.Fatalf("New() error = %v", err)
+    }
+    return src
+}
+
+func TestSearch_OpenSearchWithPagination(t *testing.T) {
+    srv, requested := newCatalog(t)
+    src := newSource(t, srv.URL+"/opds")
+
+    books, err := src.Search(context.Background(), "homer")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 3 {
+        t.Fatalf("Search() returned %d books, want 3: %#v", len(books), books)
+    }
+
+    epub := books[0]
+    if epub.Title != "The Iliad" || epub.Authors != "Homer" || epub.Extension != "epub" || epub.Year != "1998" {
+        t.Fatalf("unexpected first book: %#v", epub)
+    }
+    if epub.Size != "1.5 Mb" || epub.Meta.SizeBytes != 1572864 || epub.Meta.Language != "en" {
+        t.Fatalf("unexpected size or metadata: %q %#v", epub.Size, epub.Meta)
+    }
+    if len(epub.ISBN) != 1 || epub.ISBN[0] != "9780140275360" {
+        t.Fatalf("ISBN = %v, want [9780140275360]", epub.ISBN)
+    }
+    if books[1].Extension != "pdf" || books[2].Title != "The Odyssey" {
+        t.Fatalf("unexpected books: %#v", books[1:])
+    }
+
+    links, err := src.ResolveDownloads(context.Background(), epub)
+    if err != nil || len(links) != 1 || links[0] != srv.URL+"/download/iliad.epub" {
+        t.Fatalf("ResolveDownloads() = %v, %v", links, err)
+    }
+
+    // The template is looked up once.
+    if _, err := src.Search(context.Background(), "homer iliad"); err != nil {
+        t.Fatalf("second Search() error = %v", err)
+    }
+    roots := 0
+    for _, uri := range *requested {
+        if uri == "/opds" {
+            roots++
+        }
+    }
+    if roots != 1 {
+        t.Fatalf("root feed fetched %d times, want 1", roots)
+    }
+}
+
+func TestDetails(t *testing.T) {
+    srv, _ := newCatalog(t)
+    src := newSource(t, srv.URL+"/opds")
+
+    books, err := src.Search(context.Background(), "homer")
+    if err != nil || len(books) == 0 {
+        t.Fatalf("Search() = %v, %v", books, err)
+    }
+    d, err := src.Details(context.Background(), books[0])
+    if err != nil {
+        t.Fatalf("Details() error = %v", err)
+    }
+    if d.Description != "The war at Troy." {
+        t.Fatalf("Description = %q", d.Description)
+    }
+    if d.CoverURL != srv.URL+"/covers/iliad.jpg" || d.Identifiers["isbn"] != "9780140275360" {
+        t.Fatalf("unexpected details: %#v", d)
+    }
+}
+
+func TestSearch_JSONFeed(t *testing.T) {
+    srv, requested := newCatalog(t)
+    src := newSource(t, srv.URL+"/opds2")
+
+    books, err := src.Search(context.Background(), "aeneid")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 1 {
+        t.Fatalf("Search() returned %d books, want 1", len(books))
+    }
+    b := books[0]
+    if b.Title != "The Aeneid" || b.Authors != "Virgil; Publius Vergilius Maro" || b.Extension != "epub" || b.Year != "2008" {
+        t.Fatalf("unexpected book: %#v", b)
+    }
+    if last := (*requested)[len(*requested)-1]; last != "/opds2/search?query=aeneid" {
+        t.Fatalf("search requested %q, want /opds2/search?query=aeneid", last)
+    }
+}
+
+func TestSearch_CrawlsCatalogWithoutSearch(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/opds":
+            fmt.Fprint(w, strings.Replace(atomRoot, `href="/opds/osd"`, `href="/missing"`, 1))
+        case "/opds/authors":
+            fmt.Fprint(w, atomResults)
+        case "/opds/search/page2":
+            fmt.Fprint(w, atomResultsPage2)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+
+    src := newSource(t, srv.URL+"/opds")
+    src.resolved = true // as if the root had no search link
+
+    books, err := src.Search(context.Background(), "odyssey")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 1 || books[0].Title != "The Odyssey" {
+        t.Fatalf("Search() = %#v, want only The Odyssey", books)
+    }
+
+    // Crawled entries are matched like other results, despite a typo.
+    books, err = src.Search(context.Background(), "Odysey")
+    if err != nil || len(books) != 1 || books[0].Title != "The Odyssey" {
+        t.Fatalf("Search(Odysey) = %#v, %v; want The Odyssey", books, err)
+    }
+}
+
+func TestSearch_FollowsOnlyResultLinks(t *testing.T) {
+    results := `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:uuid:search</id>
+  <entry>
+    <title>Browse by author</title>
+    <link rel="subsection" type="application/atom+xml;profile=opds-catalog;kind=navigation" href="/opds/authors"/>
+  </entry>
+  <entry>
+    <id>urn:uuid:odyssey</id>
+    <title>The Odyssey</title>
+    <link rel="alternate" type="application/atom+xml;type=entry;profile=opds-catalog" href="/opds/book/odyssey"/>
+  </entry>
+</feed>`
+    full := `<?xml version="1.0" encoding="UTF-8"?>
+<entry xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:uuid:odyssey</id>
+  <title>The Odyssey</title>
+  <author><name>Homer</name></author>
+  <link rel="http://opds-spec.org/acquisition" type="application/epub+zip" href="/download/odyssey.epub"/>
+</entry>`
+
+    var requested []string
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requested = append(requested, r.URL.Path)
+        switch r.URL.Path {
+        case "/opds":
+            fmt.Fprint(w, strings.Replace(atomRoot, `type="application/opensearchdescription+xml" href="/opds/osd"`,
+                `type="application/atom+xml;profile=opds-catalog" href="/opds/search?q={searchTerms}"`, 1))
+        case "/opds/search":
+            fmt.Fprint(w, results)
+        case "/opds/book/odyssey":
+            fmt.Fprint(w, full)
+        case "/opds/authors":
+            fmt.Fprint(w, atomResults)
+        default:
+            http.NotFound(w, r)
+        }
+    }))
+    t.Cleanup(srv.Close)
+
+    books, err := newSource(t, srv.URL+"/opds").Search(context.Background(), "odyssey")
+    if err != nil {
+        t.Fatalf("Search() error = %v", err)
+    }
+    if len(books) != 1 || books[0].Title != "The Odyssey" || books[0].Authors != "Homer" {
+        t.Fatalf("Search() = %#v, want the full entry of The Odyssey only", books)
+    }
+    for _, path := range requested {
+        if path == "/opds/authors" {
+            t.Fatalf("search followed a navigation link: %v", requested)
+        }
+    }
+}
+
+func TestExpandTemplate(t *testing.T) {
+    tests := []struct {
+        template, want string
+    }{
+        {"https://x.example/opds/search/{searchTerms}", "https://x.example/opds/search/the%20iliad"},
+        {"https://x.example/search?q={searchTerms}&page={startPage?}", "https://x.example/search?q=the+iliad&page="},
+        {"https://x.example/search{?query,author}", "https://x.example/search?query=the+iliad"},
+        {"https://x.example/search?lang=en{&query}", "https://x.example/search?lang=en&query=the+iliad"},
+    }
+    for _, tt := range tests {
+        if got := expandTemplate(tt.template, "the iliad"); got != tt.want {
+            t.Errorf("expandTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+        }
+    }
+}
+
+func TestRegistered(t *testing.T) {
+    srv, _ := newCatalog(t)
+    src, err := lib.NewSource(lib.SourceConfig{Name: "library", Kind: Kind, URL: srv.URL + "/opds"}, lib.SourceDeps{Bodies: scraper.NewScraper(srv.URL), Files: scraper.NewScraper(srv.URL)})
+    if err != nil {
+        t.Fatalf("NewSource() error = %v", err)
+    }
+    if src.Name() != "library" {
+        t.Fatalf("Name() = %q, want library", src.Name())
+    }
+    if _, err := lib.NewSource(lib.SourceConfig{Name: "library", Kind: Kind}, lib.SourceDeps{}); err == nil {
+        t.Fatal("expected error without a URL")
+    }
+}
+
+func TestSource_BasicAuth(t *testing.T) {
+    catalog, _ := newCatalog(t)
+    var unauthorized int
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if user, pass, ok := r.BasicAuth(); !ok || user != "reader" || pass != "s3cret" {
+            unauthorized++
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        if r.URL.Path == "/download/iliad.epub" {
+            fmt.Fprint(w, "epub")
+            return
+        }
+        catalog.Config.Handler.ServeHTTP(w, r)
+    }))
+    t.Cleanup(srv.Close)
+
+    s := scraper.NewScraper(srv.URL)
+    cfg := lib.SourceConfig{Name: "calibre", Kind: Kind, URL: srv.URL + "/opds", Options: map[string]string{"username": "reader", "password": "s3cret"}}
+    src, err := New(cfg, lib.SourceDeps{Bodies: s, Files: s})
+    if err != nil {
+        t.Fatalf("New() error = %v", err)
+    }
+
+    books, err := src.Search(context.Background(), "homer")
+    if err != nil || len(books) == 0 {
+        t.Fatalf("Search() = %v, %v", books, err)
+    }
+    for _, b := range books {
+        if strings.Contains(strings.Join(b.Mirrors, " "), "s3cret") {
+            t.Fatalf("credentials in mirrors: %v", b.Mirrors)
+        }
+    }
+    dir := t.TempDir()
+    if err := src.DownloadFile(context.Background(), "iliad.epub", books[0].Mirrors[0], dir); err != nil {
+        t.Fatalf("DownloadFile() error = %v", err)
+    }
+    if unauthorized != 0 {
+        t.Fatalf("%d requests were sent without credentials", unauthorized)
+    }
+
+    cfg.URL = strings.Replace(srv.URL, "http://", "http://reader:s3cret@", 1) + "/opds"
+    if _, err := New(cfg, lib.SourceDeps{Bodies: s, Files: s}); err == nil {
+        t.Fatal("expected error for credentials in the URL")
+    }
+}
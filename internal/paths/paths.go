@@ -0,0 +1,122 @@
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const appName = "toshi"
+
+// CacheDir returns the directory toshi uses for cached and diagnostic data.
+// TOSHI_CACHE_DIR takes precedence over the user's cache directory.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("TOSHI_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating user cache directory: %w", err)
+	}
+
+	return filepath.Join(base, appName), nil
+}
+
+// CacheSubdir returns a directory below CacheDir, creating it if needed.
+func CacheSubdir(name string) (string, error) {
+	base, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// DataDir returns the directory toshi keeps user data such as history in.
+// TOSHI_DATA_DIR takes precedence over $XDG_DATA_HOME/toshi and
+// ~/.local/share/toshi.
+func DataDir() (string, error) {
+	if dir := os.Getenv("TOSHI_DATA_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".local", "share", appName), nil
+}
+
+// DataFile returns the path of a file in DataDir, creating the directory if
+// needed.
+func DataFile(name string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// DataSubdir returns a directory below DataDir, creating it if needed.
+func DataSubdir(name string) (string, error) {
+	base, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// ConfigDir returns the directory toshi reads its configuration from.
+// TOSHI_CONFIG_DIR takes precedence over the user's config directory.
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("TOSHI_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating user config directory: %w", err)
+	}
+
+	return filepath.Join(base, appName), nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it into place, so a concurrent reader never sees a partial file.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
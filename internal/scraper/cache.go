@@ -0,0 +1,202 @@
+package scraper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mfkd/toshi/internal/paths"
+)
+
+// Defaults for NewCache.
+const (
+	// DefaultSearchTTL is how long search result pages stay fresh. New
+	// uploads appear in them, so they are kept briefly.
+	DefaultSearchTTL = 15 * time.Minute
+	// DefaultPageTTL is how long other pages, such as mirror pages, stay
+	// fresh.
+	DefaultPageTTL = 24 * time.Hour
+	// DefaultCacheSize caps the total size of cached bodies.
+	DefaultCacheSize = 100 << 20
+)
+
+const (
+	metaSuffix = ".json"
+	bodySuffix = ".body"
+)
+
+// Cache stores response bodies on disk keyed by URL. Entries past their TTL
+// are revalidated with a conditional request when the server sent an ETag
+// or Last-Modified header. When the bodies exceed MaxBytes, the least
+// recently used entries are evicted.
+type Cache struct {
+	Dir       string
+	SearchTTL time.Duration
+	PageTTL   time.Duration
+	MaxBytes  int64
+
+	mu sync.Mutex
+}
+
+// cacheEntry is the metadata stored next to a cached body.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+
+	body []byte
+}
+
+// NewCache returns a cache in dir with the default TTLs and size cap,
+// creating the directory if needed.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{Dir: dir, SearchTTL: DefaultSearchTTL, PageTTL: DefaultPageTTL, MaxBytes: DefaultCacheSize}, nil
+}
+
+// path returns the file for url with the given suffix.
+func (c *Cache) path(url, suffix string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+suffix)
+}
+
+// lookup returns the cached entry for url, if any.
+func (c *Cache) lookup(url string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(url, metaSuffix))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return nil, false
+	}
+	if e.body, err = os.ReadFile(c.path(url, bodySuffix)); err != nil {
+		return nil, false
+	}
+
+	// The body's modification time records its last use for eviction.
+	now := time.Now()
+	_ = os.Chtimes(c.path(url, bodySuffix), now, now)
+	return &e, true
+}
+
+// store saves e, then evicts old entries if the cache is over its cap.
+func (c *Cache) store(e *cacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// Write the body first so a reader that finds the metadata finds the
+	// matching body too.
+	if err := paths.WriteFileAtomic(c.path(e.URL, bodySuffix), e.body); err != nil {
+		return err
+	}
+	if err := paths.WriteFileAtomic(c.path(e.URL, metaSuffix), meta); err != nil {
+		return err
+	}
+	return c.evict()
+}
+
+// evict removes the least recently used entries until the bodies fit in
+// MaxBytes. It must be called with c.mu held.
+func (c *Cache) evict() error {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+
+	type body struct {
+		path    string
+		size    int64
+		lastUse time.Time
+	}
+	var bodies []body
+	var total int64
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), bodySuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		bodies = append(bodies, body{filepath.Join(c.Dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].lastUse.Before(bodies[j].lastUse) })
+	for _, b := range bodies {
+		if total <= c.MaxBytes {
+			break
+		}
+		os.Remove(strings.TrimSuffix(b.path, bodySuffix) + metaSuffix)
+		os.Remove(b.path)
+		total -= b.size
+	}
+	return nil
+}
+
+// Clear removes every cached entry.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(c.Dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the number of cached entries and the size of their bodies.
+func (c *Cache) Stats() (entries int, size int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), bodySuffix) {
+			continue
+		}
+		if info, err := f.Info(); err == nil {
+			entries++
+			size += info.Size()
+		}
+	}
+	return entries, size, nil
+}
@@ -0,0 +1,174 @@
+package scraper
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func newTestCache(t *testing.T) *Cache {
+    t.Helper()
+    c, err := NewCache(t.TempDir())
+    if err != nil {
+        t.Fatalf("NewCache() error = %v", err)
+    }
+    return c
+}
+
+func TestScrape_CacheHitSkipsRequest(t *testing.T) {
+    var hits atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits.Add(1)
+        _, _ = io.WriteString(w, "<html><body><div id='ok'>hello</div></body></html>")
+    }))
+    t.Cleanup(srv.Close)
+
+    s := NewScraper(srv.URL + "/search.php")
+    s.Cache = newTestCache(t)
+
+    for i := 0; i < 2; i++ {
+        doc, err := s.ScrapeWithContext(context.Background(), srv.URL+"/search.php?req=iliad")
+        if err != nil {
+            t.Fatalf("ScrapeWithContext() error = %v", err)
+        }
+        if got := doc.Find("#ok").Text(); got != "hello" {
+            t.Fatalf("unexpected content: %q", got)
+        }
+    }
+    if hits.Load() != 1 {
+        t.Fatalf("server hit %d times, want 1", hits.Load())
+    }
+}
+
+func TestScrape_AuthenticatedPagesBypassCache(t *testing.T) {
+    var hits atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits.Add(1)
+        if _, _, ok := r.BasicAuth(); !ok {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        _, _ = io.WriteString(w, "<feed>private</feed>")
+    }))
+    t.Cleanup(srv.Close)
+
+    s := NewScraper(srv.URL)
+    s.Cache = newTestCache(t)
+    host := strings.TrimPrefix(srv.URL, "http://")
+    ctx := WithBasicAuth(context.Background(), host, "reader", "secret")
+
+    for i := 0; i < 2; i++ {
+        if _, err := s.Fetch(ctx, srv.URL+"/opds"); err != nil {
+            t.Fatalf("Fetch() error = %v", err)
+        }
+    }
+    if hits.Load() != 2 {
+        t.Fatalf("server hit %d times, want 2 as authenticated pages are not cached", hits.Load())
+    }
+    if _, ok := s.Cache.lookup(srv.URL + "/opds"); ok {
+        t.Fatal("authenticated page was stored in the cache")
+    }
+    if _, err := s.Fetch(context.Background(), srv.URL+"/opds"); err == nil {
+        t.Fatal("expected an unauthenticated fetch to reach the server and fail")
+    }
+}
+
+func TestScrape_CacheRevalidatesStaleEntry(t *testing.T) {
+    var hits atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        hits.Add(1)
+        if r.Header.Get("If-None-Match") == `"v1"` {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        w.Header().Set("ETag", `"v1"`)
+        _, _ = io.WriteString(w, "<html><body><div id='ok'>hello</div></body></html>")
+    }))
+    t.Cleanup(srv.Close)
+
+    s := NewScraper(srv.URL + "/search.php")
+    s.Cache = newTestCache(t)
+    s.Cache.PageTTL = 0
+
+    for i := 0; i < 2; i++ {
+        doc, err := s.ScrapeWithContext(context.Background(), srv.URL+"/mirror")
+        if err != nil {
+            t.Fatalf("ScrapeWithContext() error = %v", err)
+        }
+        if got := doc.Find("#ok").Text(); got != "hello" {
+            t.Fatalf("request %d: unexpected content: %q", i+1, got)
+        }
+    }
+    if hits.Load() != 2 {
+        t.Fatalf("server hit %d times, want 2", hits.Load())
+    }
+}
+
+func TestScraper_TTLByKind(t *testing.T) {
+    s := NewScraper("https://books.example/search.php")
+    s.Cache = &Cache{SearchTTL: time.Minute, PageTTL: time.Hour}
+
+    if got := s.ttl(context.Background()); got != time.Hour {
+        t.Fatalf("page ttl = %v, want %v", got, time.Hour)
+    }
+    if got := s.ttl(AsSearch(context.Background())); got != time.Minute {
+        t.Fatalf("search page ttl = %v, want %v", got, time.Minute)
+    }
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+    c := newTestCache(t)
+    c.MaxBytes = 25
+
+    old := time.Now().Add(-time.Hour)
+    for i, url := range []string{"https://a.example", "https://b.example"} {
+        if err := c.store(&cacheEntry{URL: url, FetchedAt: time.Now(), body: []byte(strings.Repeat("x", 10))}); err != nil {
+            t.Fatalf("store() error = %v", err)
+        }
+        used := old.Add(time.Duration(i) * time.Minute)
+        if err := os.Chtimes(c.path(url, bodySuffix), used, used); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if err := c.store(&cacheEntry{URL: "https://c.example", FetchedAt: time.Now(), body: []byte(strings.Repeat("x", 10))}); err != nil {
+        t.Fatalf("store() error = %v", err)
+    }
+
+    if _, ok := c.lookup("https://a.example"); ok {
+        t.Fatal("least recently used entry was not evicted")
+    }
+    for _, url := range []string{"https://b.example", "https://c.example"} {
+        if _, ok := c.lookup(url); !ok {
+            t.Fatalf("entry %s was evicted", url)
+        }
+    }
+}
+
+func TestCache_ClearAndStats(t *testing.T) {
+    c := newTestCache(t)
+    if err := c.store(&cacheEntry{URL: "https://a.example", FetchedAt: time.Now(), body: []byte("hello")}); err != nil {
+        t.Fatalf("store() error = %v", err)
+    }
+
+    entries, size, err := c.Stats()
+    if err != nil || entries != 1 || size != 5 {
+        t.Fatalf("Stats() = %d, %d, %v; want 1, 5, nil", entries, size, err)
+    }
+
+    if err := c.Clear(); err != nil {
+        t.Fatalf("Clear() error = %v", err)
+    }
+    if _, ok := c.lookup("https://a.example"); ok {
+        t.Fatal("entry still cached after Clear")
+    }
+    if entries, _, _ := c.Stats(); entries != 0 {
+        t.Fatalf("Stats() entries = %d after Clear, want 0", entries)
+    }
+}
@@ -0,0 +1,99 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DocumentFetcher fetches and parses an HTML page. *Scraper implements it,
+// and the middleware in this package wraps one.
+type DocumentFetcher interface {
+	ScrapeWithContext(ctx context.Context, url string) (*goquery.Document, error)
+}
+
+// FileDownloader saves the file at url as filename in dir. *Scraper
+// implements it.
+type FileDownloader interface {
+	DownloadFile(ctx context.Context, filename, url, dir string) error
+}
+
+// BodyFetcher fetches the raw body of a page, for sources whose pages are
+// not HTML. *Scraper implements it.
+type BodyFetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// DocumentFetcherFunc adapts a function to DocumentFetcher.
+type DocumentFetcherFunc func(ctx context.Context, url string) (*goquery.Document, error)
+
+func (f DocumentFetcherFunc) ScrapeWithContext(ctx context.Context, url string) (*goquery.Document, error) {
+	return f(ctx, url)
+}
+
+// FileDownloaderFunc adapts a function to FileDownloader.
+type FileDownloaderFunc func(ctx context.Context, filename, url, dir string) error
+
+func (f FileDownloaderFunc) DownloadFile(ctx context.Context, filename, url, dir string) error {
+	return f(ctx, filename, url, dir)
+}
+
+// noCacheKey marks a context whose pages must not come from the cache.
+type noCacheKey struct{}
+
+// WithoutCache returns a context under which the scraper fetches every page
+// from the site, ignoring cached copies. The responses still refresh the
+// cache.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCacheKey{}).(bool)
+	return disabled
+}
+
+// searchKey marks a context whose pages are search results.
+type searchKey struct{}
+
+// AsSearch returns a context under which fetched pages are cached as search
+// results, which expire sooner than other pages. Sources mark every search
+// page with it.
+func AsSearch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, searchKey{}, true)
+}
+
+func isSearch(ctx context.Context) bool {
+	search, _ := ctx.Value(searchKey{}).(bool)
+	return search
+}
+
+// credentialsKey marks a context whose requests to a host authenticate.
+type credentialsKey struct{}
+
+type credentials struct {
+	host, username, password string
+}
+
+// WithBasicAuth returns a context under which requests to host use HTTP
+// basic authentication. The credentials are never part of a URL, so they
+// are not logged or recorded, and are not sent to other hosts. Pages fetched
+// under it bypass the cache, which is shared and keyed only by URL.
+func WithBasicAuth(ctx context.Context, host, username, password string) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, credentials{host: host, username: username, password: password})
+}
+
+func authenticated(ctx context.Context) bool {
+	_, ok := ctx.Value(credentialsKey{}).(credentials)
+	return ok
+}
+
+// authenticate adds the context's credentials to req if they are for its
+// host.
+func authenticate(ctx context.Context, req *http.Request) {
+	if c, ok := ctx.Value(credentialsKey{}).(credentials); ok && strings.EqualFold(c.host, req.URL.Host) {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
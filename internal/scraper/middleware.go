@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mfkd/toshi/internal/logger"
+)
+
+// Middleware wraps a DocumentFetcher to add behaviour around each fetch.
+type Middleware func(DocumentFetcher) DocumentFetcher
+
+// Chain wraps f with each middleware in turn, so the first one listed is the
+// outermost and sees every call first.
+func Chain(f DocumentFetcher, middleware ...Middleware) DocumentFetcher {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		f = middleware[i](f)
+	}
+	return f
+}
+
+// Logging logs each fetch and how long it took at debug level.
+func Logging() Middleware {
+	return func(next DocumentFetcher) DocumentFetcher {
+		return DocumentFetcherFunc(func(ctx context.Context, url string) (*goquery.Document, error) {
+			start := time.Now()
+			doc, err := next.ScrapeWithContext(ctx, url)
+			if err != nil {
+				logger.Debugf("GET %s failed after %v: %v\n", url, time.Since(start).Round(time.Millisecond), err)
+			} else {
+				logger.Debugf("GET %s (%v)\n", url, time.Since(start).Round(time.Millisecond))
+			}
+			return doc, err
+		})
+	}
+}
+
+// RateLimit spaces fetches at least interval apart to avoid hammering the
+// site. When it wraps a *Scraper directly, pages the scraper has a fresh
+// cached copy of are fetched without waiting.
+func RateLimit(interval time.Duration) Middleware {
+	return func(next DocumentFetcher) DocumentFetcher {
+		var mu sync.Mutex
+		var last time.Time
+		cached, _ := next.(interface {
+			Fresh(ctx context.Context, url string) bool
+		})
+
+		return DocumentFetcherFunc(func(ctx context.Context, url string) (*goquery.Document, error) {
+			if cached == nil || cacheDisabled(ctx) || !cached.Fresh(ctx, url) {
+				mu.Lock()
+				wait := time.Until(last.Add(interval))
+				if wait < 0 {
+					wait = 0
+				}
+				last = time.Now().Add(wait)
+				mu.Unlock()
+
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			return next.ScrapeWithContext(ctx, url)
+		})
+	}
+}
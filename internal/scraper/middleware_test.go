@@ -0,0 +1,52 @@
+package scraper
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/PuerkitoBio/goquery"
+)
+
+func okFetcher(calls *[]string, name string) DocumentFetcher {
+    return DocumentFetcherFunc(func(ctx context.Context, url string) (*goquery.Document, error) {
+        *calls = append(*calls, name)
+        return goquery.NewDocumentFromReader(strings.NewReader("<p>ok</p>"))
+    })
+}
+
+func TestChain_Order(t *testing.T) {
+    var calls []string
+    tag := func(name string) Middleware {
+        return func(next DocumentFetcher) DocumentFetcher {
+            return DocumentFetcherFunc(func(ctx context.Context, url string) (*goquery.Document, error) {
+                calls = append(calls, name)
+                return next.ScrapeWithContext(ctx, url)
+            })
+        }
+    }
+
+    f := Chain(okFetcher(&calls, "fetch"), tag("outer"), tag("inner"))
+    if _, err := f.ScrapeWithContext(context.Background(), "https://a.example"); err != nil {
+        t.Fatalf("ScrapeWithContext() error = %v", err)
+    }
+    if got := strings.Join(calls, ","); got != "outer,inner,fetch" {
+        t.Fatalf("call order = %s, want outer,inner,fetch", got)
+    }
+}
+
+func TestRateLimit_SpacesFetches(t *testing.T) {
+    var calls []string
+    f := RateLimit(20 * time.Millisecond)(okFetcher(&calls, "fetch"))
+
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        if _, err := f.ScrapeWithContext(context.Background(), "https://a.example"); err != nil {
+            t.Fatalf("ScrapeWithContext() error = %v", err)
+        }
+    }
+    if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+        t.Fatalf("3 fetches took %v, want at least 40ms", elapsed)
+    }
+}
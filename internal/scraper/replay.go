@@ -0,0 +1,191 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// exchange is a recorded request and its response. The response body is
+// kept in a file of its own next to the exchange so HTML pages stay
+// readable.
+type exchange struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	Body            string      `json:"body"`
+}
+
+// Recorder is an http.RoundTripper that saves every exchange made through it
+// in Dir as numbered files, e.g. 0001.json and 0001.body. Credentials are
+// left out, as recordings are meant to be shared in bug reports: URLs are
+// saved without user info and credential headers as "REDACTED".
+type Recorder struct {
+	Dir  string
+	Base http.RoundTripper
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewRecorder returns a Recorder writing to dir, creating it if needed.
+// Numbering continues after any exchanges already recorded there.
+func NewRecorder(dir string, base http.RoundTripper) (*Recorder, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Dir: dir, Base: base, next: len(existing) + 1}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := fmt.Sprintf("%04d", r.next)
+	e := exchange{
+		Method:          req.Method,
+		URL:             redactURL(req.URL),
+		RequestHeaders:  redactHeaders(req.Header),
+		Status:          resp.StatusCode,
+		ResponseHeaders: redactHeaders(resp.Header),
+		Body:            name + ".body",
+	}
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(r.Dir, e.Body), body, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(r.Dir, name+".json"), meta, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	r.next++
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper that answers requests from a recording
+// made by Recorder, without using the network. Requests are matched by
+// method and URL. Repeated requests get the recorded responses in order,
+// then the last one again. A request that was not recorded fails.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges map[string][]exchange
+	served    map[string]int
+	dir       string
+}
+
+// NewReplayer loads the recording in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded requests found in %s", dir)
+	}
+	sort.Strings(files)
+
+	r := &Replayer{exchanges: make(map[string][]exchange), served: make(map[string]int), dir: dir}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var e exchange
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		key := replayKey(e.Method, e.URL)
+		r.exchanges[key] = append(r.exchanges[key], e)
+	}
+	return r, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := replayKey(req.Method, redactURL(req.URL))
+
+	r.mu.Lock()
+	recorded := r.exchanges[key]
+	if len(recorded) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for %s %s", req.Method, req.URL)
+	}
+	e := recorded[min(r.served[key], len(recorded)-1)]
+	r.served[key]++
+	r.mu.Unlock()
+
+	body, err := os.ReadFile(filepath.Join(r.dir, e.Body))
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.ResponseHeaders,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// credentialHeaders are the headers replaced by redactHeaders.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// redactHeaders returns a copy of h with the values of credential headers
+// replaced.
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range credentialHeaders {
+		if _, ok := h[name]; ok {
+			h[name] = []string{"REDACTED"}
+		}
+	}
+	return h
+}
+
+// redactURL returns u without user info.
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	stripped := *u
+	stripped.User = nil
+	return stripped.String()
+}
+
+func replayKey(method, url string) string {
+	return strings.ToUpper(method) + " " + url
+}
@@ -0,0 +1,126 @@
+package scraper
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRecordReplay_RoundTrip(t *testing.T) {
+    dir := t.TempDir()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/html")
+        _, _ = io.WriteString(w, "<html><body><div id='ok'>"+r.URL.Query().Get("req")+"</div></body></html>")
+    }))
+
+    recorder := NewScraper(srv.URL)
+    if err := recorder.Record(dir); err != nil {
+        t.Fatalf("Record() error = %v", err)
+    }
+    for _, term := range []string{"iliad", "odyssey"} {
+        if _, err := recorder.Scrape(srv.URL + "/search.php?req=" + term); err != nil {
+            t.Fatalf("Scrape() error = %v", err)
+        }
+    }
+    srv.Close()
+
+    replayer := NewScraper(srv.URL)
+    if err := replayer.Replay(dir); err != nil {
+        t.Fatalf("Replay() error = %v", err)
+    }
+    for _, term := range []string{"odyssey", "iliad", "iliad"} {
+        doc, err := replayer.ScrapeWithContext(context.Background(), srv.URL+"/search.php?req="+term)
+        if err != nil {
+            t.Fatalf("replayed Scrape() error = %v", err)
+        }
+        if got := doc.Find("#ok").Text(); got != term {
+            t.Fatalf("replayed content = %q, want %q", got, term)
+        }
+    }
+
+    _, err := replayer.Scrape(srv.URL + "/search.php?req=aeneid")
+    if err == nil || !strings.Contains(err.Error(), "no recorded response") {
+        t.Fatalf("expected unmatched request to fail, got %v", err)
+    }
+}
+
+func TestRecordReplay_KeepsStatus(t *testing.T) {
+    dir := t.TempDir()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNotFound)
+    }))
+
+    recorder := NewScraper(srv.URL)
+    if err := recorder.Record(dir); err != nil {
+        t.Fatalf("Record() error = %v", err)
+    }
+    status, err := recorder.CheckHead(context.Background(), srv.URL+"/missing")
+    if err != nil || status != http.StatusNotFound {
+        t.Fatalf("CheckHead() = %d, %v; want 404", status, err)
+    }
+    srv.Close()
+
+    replayer := NewScraper(srv.URL)
+    if err := replayer.Replay(dir); err != nil {
+        t.Fatalf("Replay() error = %v", err)
+    }
+    status, err = replayer.CheckHead(context.Background(), srv.URL+"/missing")
+    if err != nil || status != http.StatusNotFound {
+        t.Fatalf("replayed CheckHead() = %d, %v; want 404", status, err)
+    }
+}
+
+func TestNewReplayer_EmptyDir(t *testing.T) {
+    if _, err := NewReplayer(t.TempDir()); err == nil {
+        t.Fatal("expected error for a directory without recordings")
+    }
+}
+
+func TestRecorder_RedactsCredentials(t *testing.T) {
+    dir := t.TempDir()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if user, pass, ok := r.BasicAuth(); !ok || user != "reader" || pass != "s3cret" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret-session"})
+        _, _ = io.WriteString(w, "<feed/>")
+    }))
+    defer srv.Close()
+
+    link := strings.Replace(srv.URL, "http://", "http://reader:s3cret@", 1) + "/opds"
+    recorder := NewScraper(srv.URL)
+    if err := recorder.Record(dir); err != nil {
+        t.Fatalf("Record() error = %v", err)
+    }
+    if _, err := recorder.Fetch(context.Background(), link); err != nil {
+        t.Fatalf("Fetch() error = %v", err)
+    }
+
+    files, err := os.ReadDir(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, f := range files {
+        data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "cmVhZGVy") {
+            t.Errorf("%s contains credentials:\n%s", f.Name(), data)
+        }
+    }
+
+    replayer := NewScraper(srv.URL)
+    if err := replayer.Replay(dir); err != nil {
+        t.Fatalf("Replay() error = %v", err)
+    }
+    if body, err := replayer.Fetch(context.Background(), link); err != nil || string(body) != "<feed/>" {
+        t.Fatalf("replayed Fetch() = %q, %v", body, err)
+    }
+}
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -19,6 +20,11 @@ type Scraper struct {
 	UserAgent    string
 	URL          string
 	RequestDelay time.Duration
+
+	// Cache, if set, stores scraped pages. File downloads are not cached.
+	// Unlike the fetch middleware it works on responses, since stale pages
+	// are revalidated with conditional requests.
+	Cache *Cache
 }
 
 // NewScraper creates a new Scraper with the given URL.
@@ -31,6 +37,31 @@ func NewScraper(url string) *Scraper {
 	}
 }
 
+// Record saves every request the scraper makes, with its response, in dir.
+// The cache is turned off so every page is requested and recorded.
+func (s *Scraper) Record(dir string) error {
+	recorder, err := NewRecorder(dir, s.client.Transport)
+	if err != nil {
+		return err
+	}
+	s.client.Transport = recorder
+	s.Cache = nil
+	return nil
+}
+
+// Replay answers the scraper's requests from the recording in dir instead of
+// the network. There is nothing to wait for, so RequestDelay is cleared.
+func (s *Scraper) Replay(dir string) error {
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		return err
+	}
+	s.client.Transport = replayer
+	s.Cache = nil
+	s.RequestDelay = 0
+	return nil
+}
+
 // Scrape sends a GET request to the given URL and returns the document.
 func (s *Scraper) Scrape(url string) (*goquery.Document, error) {
 	return s.ScrapeWithContext(context.Background(), url)
@@ -38,12 +69,50 @@ func (s *Scraper) Scrape(url string) (*goquery.Document, error) {
 
 // ScrapeWithContext sends a GET request to the given URL and returns the document with context.
 func (s *Scraper) ScrapeWithContext(ctx context.Context, url string) (*goquery.Document, error) {
+	body, err := s.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	// load html document
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error loading document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// Fetch returns the body of url, from the cache if it holds a fresh copy.
+// A stale copy is revalidated with a conditional request. Pages fetched with
+// credentials are neither read from nor stored in the cache.
+func (s *Scraper) Fetch(ctx context.Context, url string) ([]byte, error) {
+	useCache := s.Cache != nil && !authenticated(ctx)
+	var cached *cacheEntry
+	if useCache && !cacheDisabled(ctx) {
+		if e, ok := s.Cache.lookup(url); ok {
+			if time.Since(e.FetchedAt) < s.ttl(ctx) {
+				return e.body, nil
+			}
+			cached = e
+		}
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", s.UserAgent)
+	authenticate(ctx, req)
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -51,17 +120,56 @@ func (s *Scraper) ScrapeWithContext(ctx context.Context, url string) (*goquery.D
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.FetchedAt = time.Now()
+		s.storeCached(cached)
+		return cached.body, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("HTTP request failed with status %d (%s) for URL: %s", resp.StatusCode, resp.Status, url)
 	}
 
-	// load html document
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error loading document: %w", err)
+		return nil, fmt.Errorf("error reading response: %w", err)
 	}
 
-	return doc, nil
+	if useCache {
+		s.storeCached(&cacheEntry{
+			URL:          url,
+			FetchedAt:    time.Now(),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			body:         body,
+		})
+	}
+	return body, nil
+}
+
+// storeCached saves e in the cache. A failure only costs a later refetch,
+// so it is not reported.
+func (s *Scraper) storeCached(e *cacheEntry) {
+	_ = s.Cache.store(e)
+}
+
+// ttl returns how long a cached copy of a page stays fresh: search pages,
+// marked by the context, expire sooner than other pages.
+func (s *Scraper) ttl(ctx context.Context) time.Duration {
+	if isSearch(ctx) {
+		return s.Cache.SearchTTL
+	}
+	return s.Cache.PageTTL
+}
+
+// Fresh reports whether the cache holds a copy of url that can be used
+// without asking the site when fetched with ctx.
+func (s *Scraper) Fresh(ctx context.Context, url string) bool {
+	if s.Cache == nil || authenticated(ctx) {
+		return false
+	}
+	e, ok := s.Cache.lookup(url)
+	return ok && time.Since(e.FetchedAt) < s.ttl(ctx)
 }
 
 // CheckHead sends a HEAD request to the given URL and returns the status code.
@@ -100,6 +208,7 @@ func (s *Scraper) DownloadFile(ctx context.Context, filename, downloadURL, downl
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", s.UserAgent)
+	authenticate(ctx, req)
 
 	// Send the request
 	resp, err := s.client.Do(req)
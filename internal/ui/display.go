@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"syscall"
 
@@ -27,57 +28,121 @@ func displayBooksPaginated(books []lib.Book, startIndex int) {
 	}
 
 	// Print the centered header
-	fmt.Println(FgBlue + strings.Repeat("=", terminalWidth) + Reset)
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
 	header := fmt.Sprintf("Books %d to %d of %d", startIndex+1, endIndex, len(books))
-	fmt.Printf("%s%s%s\n", strings.Repeat(" ", (terminalWidth-len(header))/2), Bold+FgBrightWhite+header+Reset, strings.Repeat(" ", (terminalWidth-len(header))/2))
-	fmt.Println(FgBlue + strings.Repeat("=", terminalWidth) + Reset)
+	fmt.Println(centered(header, terminalWidth, theme.Bold+theme.Text))
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
 
 	// Print each book
 	for i := startIndex; i < endIndex; i++ {
 		book := books[i]
 
 		// Print book index
-		fmt.Printf("%s#%d%s\n", Bold+FgYellow, i+1, Reset)
+		fmt.Printf("%s#%d%s\n", theme.Bold+theme.Number, i+1, theme.Reset)
 
 		// Print book details with refined alignment and hide empty fields
 		if book.Title != "" {
-			fmt.Printf("  %sTitle:%s       %s%s\n", Bold+FgCyan, Reset, Bold+FgBrightWhite, book.Title)
+			fmt.Printf("  %sTitle:%s       %s%s\n", theme.Bold+theme.Heading, theme.Reset, theme.Bold+theme.Text, book.Title)
 		}
 		if book.Authors != "" {
-			fmt.Printf("  %sAuthor(s):%s   %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Authors)
+			fmt.Printf("  %sAuthor(s):%s   %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Authors)
 		}
 		if book.Year != "" {
-			fmt.Printf("  %sYear:%s        %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Year)
+			fmt.Printf("  %sYear:%s        %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Year)
 		}
 		if book.Publisher != "" {
-			fmt.Printf("  %sPublisher:%s   %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Publisher)
+			fmt.Printf("  %sPublisher:%s   %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Publisher)
 		}
 		if book.Pages != "" {
-			fmt.Printf("  %sPages:%s       %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Pages)
+			fmt.Printf("  %sPages:%s       %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Pages)
 		}
 		if book.Language != "" {
-			fmt.Printf("  %sLanguage:%s    %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Language)
+			fmt.Printf("  %sLanguage:%s    %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Language)
 		}
 		if book.Size != "" {
-			fmt.Printf("  %sSize:%s        %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Size)
+			fmt.Printf("  %sSize:%s        %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Size)
 		}
 		if book.Extension != "" {
-			fmt.Printf("  %sFormat:%s      %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, book.Extension)
+			fmt.Printf("  %sFormat:%s      %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, book.Extension)
 		}
 		if len(book.ISBN) > 0 {
-			fmt.Printf("  %sISBN(s):%s     %s%s\n", FgBlue, Reset, Bold+FgBrightWhite, strings.Join(book.ISBN, ", "))
+			fmt.Printf("  %sISBN(s):%s     %s%s\n", theme.Muted, theme.Reset, theme.Bold+theme.Text, strings.Join(book.ISBN, ", "))
+		}
+		if book.InLibrary {
+			fmt.Printf("  %sLibrary:%s     %salready in library\n", theme.Muted, theme.Reset, theme.Bold+theme.Text)
 		}
 
 		// Add a dashed divider between books
-		fmt.Println(FgBlue + strings.Repeat("-", terminalWidth) + Reset)
+		fmt.Println(theme.Muted + strings.Repeat("-", terminalWidth) + theme.Reset)
 		fmt.Println() // Add extra vertical space for better readability
 	}
 
 	// Final divider
-	fmt.Println(FgBlue + strings.Repeat("=", terminalWidth) + Reset)
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
 
 	// Print options at the end
-	fmt.Printf("%sOptions:%s\n", Bold+FgRed, Reset)
-	fmt.Printf("%sEnter the number of the book to select it.%s\n", Bold+FgRed, Reset)
-	fmt.Printf("%sEnter 'q' to Quit.%s\n", Bold+FgRed, Reset)
+	fmt.Printf("%sOptions:%s\n", theme.Bold+theme.Alert, theme.Reset)
+	fmt.Printf("%sEnter the number of the book to select it.%s\n", theme.Bold+theme.Alert, theme.Reset)
+	fmt.Printf("%sEnter 'q' to Quit.%s\n", theme.Bold+theme.Alert, theme.Reset)
+}
+
+// Display a page of works, one line each, with their formats and editions
+func displayWorksPaginated(works []lib.Work, startIndex int) {
+	terminalWidth := getTerminalWidth()
+	endIndex := startIndex + worksPerPage
+	if endIndex > len(works) {
+		endIndex = len(works)
+	}
+
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+	header := fmt.Sprintf("Works %d to %d of %d", startIndex+1, endIndex, len(works))
+	fmt.Println(centered(header, terminalWidth, theme.Bold+theme.Text))
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+
+	for i := startIndex; i < endIndex; i++ {
+		work := works[i]
+
+		line := fmt.Sprintf("%s#%-3d%s %s%s%s", theme.Bold+theme.Number, work.Numbers[0], theme.Reset, theme.Bold+theme.Text, work.Title, theme.Reset)
+		if work.Author != "" {
+			line += fmt.Sprintf(" %s— %s%s", theme.Heading, work.Author, theme.Reset)
+		}
+
+		details := fmt.Sprintf("[%s]", strings.Join(work.Formats(), ", "))
+		if n := len(work.Books); n > 1 {
+			details += fmt.Sprintf(" %d editions", n)
+		}
+		if min, max := work.YearRange(); min == max && min != 0 {
+			details += fmt.Sprintf(" %d", min)
+		} else if min != max {
+			details += fmt.Sprintf(" %d–%d", min, max)
+		}
+		if slices.ContainsFunc(work.Books, func(b lib.Book) bool { return b.InLibrary }) {
+			details += " in library"
+		}
+
+		fmt.Printf("%s %s%s%s\n", line, theme.Muted, details, theme.Reset)
+	}
+
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+}
+
+// Display every edition of a work on one line each, numbered as in the
+// flat result list
+func displayEditions(work lib.Work) {
+	terminalWidth := getTerminalWidth()
+
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+	for i, book := range work.Books {
+		fields := []string{}
+		for _, field := range []string{book.Year, book.Publisher, book.Authors, book.Language, book.Size} {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		if book.InLibrary {
+			fields = append(fields, "in library")
+		}
+		fmt.Printf("%s#%-3d%s %s%-5s%s %s\n", theme.Bold+theme.Number, work.Numbers[i], theme.Reset, theme.Bold+theme.Heading, book.Extension, theme.Reset, strings.Join(fields, " · "))
+	}
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
 }
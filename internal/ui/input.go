@@ -1,54 +1,242 @@
 package ui
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/mfkd/toshi/internal/lib"
 )
 
-const booksPerPage = 5
+const (
+	booksPerPage = 5
+	worksPerPage = 15
+)
+
+// CLI selects a book by prompting on the terminal. With Group set, results
+// are shown one line per work and a work is expanded to pick an edition;
+// books keep the numbers of the flat list.
+// With Table set, books are listed one line each, as many as fit the
+// terminal. Details, if set, loads the description page shown by the
+// 'i <number>' command.
+type CLI struct {
+	Group   bool
+	Table   bool
+	Details func(lib.Book) (*lib.Details, error)
+}
+
+func (c CLI) SelectBook(books []lib.Book) *lib.Book {
+	if c.Group {
+		if works := lib.GroupWorks(books); len(works) < len(books) {
+			return c.selectWork(works)
+		}
+	}
 
-type CLI struct{}
+	return c.selectBook(books)
+}
 
-func (CLI) SelectBook(books []lib.Book) *lib.Book {
+// selectWork lets the user pick a work and then one of its editions. Works
+// and editions are numbered by their position in the flat result list, the
+// one saved as the session, so that 'toshi get' picks the book shown.
+func (c CLI) selectWork(works []lib.Work) *lib.Book {
 	startIndex := 0
 
 	for {
-		displayBooksPaginated(books, startIndex)
+		displayWorksPaginated(works, startIndex)
 
 		// Print options
-		fmt.Printf("\n%sOptions:%s\n", FgYellow, Reset)
-		fmt.Println("Enter the number of the book to select it.")
-		if startIndex > 0 {
-			fmt.Printf("%sEnter 'p' for Previous page.%s\n", FgMagenta, Reset)
+		fmt.Printf("\n%sOptions:%s\n", theme.Number, theme.Reset)
+		fmt.Println("Enter the number of a work to list its editions and formats.")
+		printPagingOptions(startIndex, worksPerPage, len(works))
+		fmt.Printf("%sEnter 'q' to Quit.%s\n", theme.Alert, theme.Reset)
+		fmt.Print("Your choice: ")
+
+		input, ok := readInput()
+		if !ok {
+			continue
+		}
+
+		// Handle input
+		if input == "n" && startIndex+worksPerPage < len(works) {
+			startIndex += worksPerPage
+		} else if input == "p" && startIndex > 0 {
+			startIndex -= worksPerPage
+		} else if input == "q" {
+			return nil
+		} else {
+			selection, err := strconv.Atoi(input)
+			i := slices.IndexFunc(works, func(w lib.Work) bool { return w.Numbers[0] == selection })
+			if err != nil || i < 0 {
+				fmt.Printf("%sInvalid input. Please try again.%s\n", theme.Alert, theme.Reset)
+				continue
+			}
+
+			work := works[i]
+			if len(work.Books) == 1 {
+				return &work.Books[0]
+			}
+			if book, back := c.selectEdition(work); !back {
+				return book
+			}
+		}
+	}
+}
+
+// selectEdition lets the user pick one edition of a work. It returns
+// back=true if the user asked to return to the list of works.
+func (c CLI) selectEdition(work lib.Work) (book *lib.Book, back bool) {
+	for {
+		displayEditions(work)
+
+		fmt.Printf("\n%sOptions:%s\n", theme.Number, theme.Reset)
+		fmt.Println("Enter the number of the edition to select it.")
+		c.printDetailsOption()
+		fmt.Printf("%sEnter 'b' to go Back to the list of works.%s\n", theme.Hint, theme.Reset)
+		fmt.Printf("%sEnter 'q' to Quit.%s\n", theme.Alert, theme.Reset)
+		fmt.Print("Your choice: ")
+
+		input, ok := readInput()
+		if !ok {
+			continue
+		}
+
+		switch input {
+		case "b":
+			return nil, true
+		case "q":
+			return nil, false
+		}
+		if c.showDetails(input, work.Books, work.Numbers) {
+			continue
+		}
+
+		selection, err := strconv.Atoi(input)
+		if b := numberedBook(work.Books, work.Numbers, selection); err == nil && b != nil {
+			return b, false
 		}
-		if startIndex+booksPerPage < len(books) {
-			fmt.Printf("%sEnter 'n' for Next page.%s\n", FgMagenta, Reset)
+		fmt.Printf("%sInvalid input. Please try again.%s\n", theme.Alert, theme.Reset)
+	}
+}
+
+// selectBook pages through books until the user picks one, either five
+// detailed entries or a screenful of table rows at a time.
+func (c CLI) selectBook(books []lib.Book) *lib.Book {
+	startIndex := 0
+
+	for {
+		perPage := booksPerPage
+		if c.Table {
+			perPage = tablePageSize()
+			displayBooksTable(books, startIndex, perPage)
+		} else {
+			displayBooksPaginated(books, startIndex)
 		}
-		fmt.Printf("%sEnter 'q' to Quit.%s\n", FgRed, Reset)
+
+		// Print options
+		fmt.Printf("\n%sOptions:%s\n", theme.Number, theme.Reset)
+		fmt.Println("Enter the number of the book to select it.")
+		c.printDetailsOption()
+		printPagingOptions(startIndex, perPage, len(books))
+		fmt.Printf("%sEnter 'q' to Quit.%s\n", theme.Alert, theme.Reset)
 		fmt.Print("Your choice: ")
 
-		// Read user input
-		var input string
-		if _, err := fmt.Scanln(&input); err != nil {
-			fmt.Printf("%sError reading input. Please try again.%s\n", FgRed, Reset)
+		input, ok := readInput()
+		if !ok {
 			continue
 		}
 
 		// Handle input
-		if input == "n" && startIndex+booksPerPage < len(books) {
-			startIndex += booksPerPage
+		if input == "n" && startIndex+perPage < len(books) {
+			startIndex += perPage
 		} else if input == "p" && startIndex > 0 {
-			startIndex -= booksPerPage
+			startIndex = max(startIndex-perPage, 0)
 		} else if input == "q" {
 			return nil
+		} else if c.showDetails(input, books, nil) {
+			continue
 		} else {
 			selection, err := strconv.Atoi(input)
-			if err == nil && selection > 0 && selection <= len(books) {
-				return &books[selection-1]
+			if b := numberedBook(books, nil, selection); err == nil && b != nil {
+				return b
 			}
-			fmt.Printf("%sInvalid input. Please try again.%s\n", FgRed, Reset)
+			fmt.Printf("%sInvalid input. Please try again.%s\n", theme.Alert, theme.Reset)
 		}
 	}
 }
+
+func printPagingOptions(startIndex, perPage, total int) {
+	if startIndex > 0 {
+		fmt.Printf("%sEnter 'p' for Previous page.%s\n", theme.Hint, theme.Reset)
+	}
+	if startIndex+perPage < total {
+		fmt.Printf("%sEnter 'n' for Next page.%s\n", theme.Hint, theme.Reset)
+	}
+}
+
+func (c CLI) printDetailsOption() {
+	if c.Details != nil {
+		fmt.Printf("%sEnter 'i' and a number for the book's details, e.g. 'i 3'.%s\n", theme.Hint, theme.Reset)
+	}
+}
+
+// showDetails handles the 'i <number>' command for books numbered as in
+// numberedBook. It reports whether input was such a command, so the caller
+// can prompt again.
+func (c CLI) showDetails(input string, books []lib.Book, numbers []int) bool {
+	rest, ok := strings.CutPrefix(input, "i")
+	if !ok || c.Details == nil {
+		return false
+	}
+	selection, err := strconv.Atoi(strings.TrimSpace(rest))
+	if err != nil {
+		return false
+	}
+	book := numberedBook(books, numbers, selection)
+	if book == nil {
+		fmt.Printf("%sInvalid input. Please try again.%s\n", theme.Alert, theme.Reset)
+		return true
+	}
+
+	details, err := c.Details(*book)
+	if err != nil {
+		fmt.Printf("%sError loading details: %v%s\n", theme.Alert, err, theme.Reset)
+	} else {
+		fmt.Println()
+		PrintBookDetails(os.Stdout, details, FormatText)
+	}
+
+	fmt.Print("\nPress Enter to continue.")
+	stdin.ReadString('\n')
+	return true
+}
+
+// numberedBook returns the book shown as number n, or nil. Books are
+// numbered by numbers, or from 1 in order if numbers is nil.
+func numberedBook(books []lib.Book, numbers []int, n int) *lib.Book {
+	if numbers == nil {
+		if n < 1 || n > len(books) {
+			return nil
+		}
+		return &books[n-1]
+	}
+	if i := slices.Index(numbers, n); i >= 0 {
+		return &books[i]
+	}
+	return nil
+}
+
+// stdin buffers the terminal input read by the line interface.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readInput reads one line of user input.
+func readInput() (string, bool) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Printf("%sError reading input. Please try again.%s\n", theme.Alert, theme.Reset)
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
@@ -0,0 +1,23 @@
+package ui
+
+import (
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+func TestNumberedBook(t *testing.T) {
+    books := []lib.Book{{ID: "1"}, {ID: "3"}, {ID: "4"}}
+
+    if b := numberedBook(books, nil, 2); b == nil || b.ID != "3" {
+        t.Fatalf("numberedBook without numbers = %#v, want book 3", b)
+    }
+    if b := numberedBook(books, []int{1, 3, 4}, 3); b == nil || b.ID != "3" {
+        t.Fatalf("numberedBook(3) = %#v, want the book numbered 3", b)
+    }
+    for _, n := range []int{0, 2, 5} {
+        if b := numberedBook(books, []int{1, 3, 4}, n); b != nil {
+            t.Fatalf("numberedBook(%d) = %#v, want nil", n, b)
+        }
+    }
+}
@@ -0,0 +1,143 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+// Output formats for non-interactive use.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// PrintBooks writes books to w in the given format without prompting.
+func PrintBooks(w io.Writer, books []lib.Book, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if books == nil {
+			books = []lib.Book{}
+		}
+		return enc.Encode(books)
+	case FormatText:
+		return PrintPage(w, books, 0, len(books))
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// PrintPage writes up to count books starting at index start as a text
+// table, numbered by their position in books.
+func PrintPage(w io.Writer, books []lib.Book, start, count int) error {
+	end := min(start+count, len(books))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tID\tAUTHOR(S)\tTITLE\tYEAR\tLANG\tSIZE\tFORMAT")
+	for i := start; i < end; i++ {
+		b := books[i]
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1, b.ID, oneLine(b.Authors), titleCell(b), yearCell(b), b.Meta.Language, b.Size, b.Extension)
+	}
+	return tw.Flush()
+}
+
+// PrintBook writes a single book in the given format.
+func PrintBook(w io.Writer, b lib.Book, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	case FormatText, "":
+		return PrintDetails(w, b)
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// PrintDetails writes every known field of b, one per line.
+func PrintDetails(w io.Writer, b lib.Book) error {
+	for _, row := range detailRows(b) {
+		if _, err := fmt.Fprintf(w, "%s%-11s%s %s\n", theme.Heading, row[0], theme.Reset, row[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descriptionWidth is the column descriptions are wrapped at.
+const descriptionWidth = 78
+
+// PrintBookDetails writes the extended metadata of a book in the given
+// format.
+func PrintBookDetails(w io.Writer, d *lib.Details, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case FormatText, "":
+		if err := PrintDetails(w, d.Book); err != nil {
+			return err
+		}
+
+		rows := [][2]string{{"Series:", d.Series}, {"Edition:", d.Edition}}
+		keys := make([]string, 0, len(d.Identifiers))
+		for key := range d.Identifiers {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			rows = append(rows, [2]string{strings.ToUpper(key) + ":", d.Identifiers[key]})
+		}
+		rows = append(rows, [2]string{"MD5:", d.MD5}, [2]string{"Cover:", d.CoverURL}, [2]string{"Page:", d.URL})
+
+		for _, row := range rows {
+			if row[1] == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s%-11s%s %s\n", theme.Heading, row[0], theme.Reset, row[1]); err != nil {
+				return err
+			}
+		}
+
+		if d.Description != "" {
+			_, err := fmt.Fprintf(w, "\n%s\n", wrap(d.Description, descriptionWidth))
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// wrap breaks s into lines of at most width columns at word boundaries.
+func wrap(s string, width int) string {
+	var b strings.Builder
+	lineWidth := 0
+	for _, word := range strings.Fields(s) {
+		w := displayWidth(word)
+		if lineWidth > 0 && lineWidth+1+w > width {
+			b.WriteByte('\n')
+			lineWidth = 0
+		} else if lineWidth > 0 {
+			b.WriteByte(' ')
+			lineWidth++
+		}
+		b.WriteString(word)
+		lineWidth += w
+	}
+	return b.String()
+}
+
+// oneLine collapses whitespace so a field cannot break the line layout.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,52 @@
+package ui
+
+import (
+    "bytes"
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+func TestWrap(t *testing.T) {
+    got := wrap("the quick brown fox jumps over the lazy dog", 15)
+    want := "the quick brown\nfox jumps over\nthe lazy dog"
+    if got != want {
+        t.Fatalf("wrap = %q, want %q", got, want)
+    }
+}
+
+func TestPrintBookDetails(t *testing.T) {
+    defer func(saved Theme) { theme = saved }(theme)
+    theme = plainTheme
+
+    d := &lib.Details{
+        Book:        lib.Book{Title: "The Iliad", Authors: "Homer"},
+        Series:      "Penguin Classics",
+        Identifiers: map[string]string{"isbn": "0140275363"},
+        Description: "The greatest war story of all time.",
+    }
+
+    var text bytes.Buffer
+    if err := PrintBookDetails(&text, d, FormatText); err != nil {
+        t.Fatalf("PrintBookDetails error = %v", err)
+    }
+    for _, want := range []string{"Title:      The Iliad", "Series:     Penguin Classics", "ISBN:       0140275363", "\n\nThe greatest war story"} {
+        if !strings.Contains(text.String(), want) {
+            t.Errorf("text output missing %q:\n%s", want, text.String())
+        }
+    }
+
+    var out bytes.Buffer
+    if err := PrintBookDetails(&out, d, FormatJSON); err != nil {
+        t.Fatalf("PrintBookDetails error = %v", err)
+    }
+    var decoded lib.Details
+    if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+        t.Fatalf("invalid JSON: %v", err)
+    }
+    if decoded.Series != d.Series || decoded.Book.Title != "The Iliad" {
+        t.Fatalf("decoded = %#v", decoded)
+    }
+}
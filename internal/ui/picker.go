@@ -0,0 +1,187 @@
+package ui
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+// DefaultPickerCommand is run when TOSHI_PICKER is not set.
+const DefaultPickerCommand = "fzf --multi"
+
+// Picker selects books with an external fuzzy finder such as fzf. Results
+// are written to the command's stdin as tab-separated lines and the lines it
+// prints are mapped back to books.
+type Picker struct {
+	// Command is a shell command line, e.g. "fzf --multi" or "sk -m".
+	Command string
+}
+
+// PickerCommand returns the picker command from TOSHI_PICKER, or the default.
+func PickerCommand() string {
+	if cmd := strings.TrimSpace(os.Getenv("TOSHI_PICKER")); cmd != "" {
+		return cmd
+	}
+	return DefaultPickerCommand
+}
+
+// Available reports whether the picker program can be found.
+func (p Picker) Available() bool {
+	fields := strings.Fields(p.command())
+	if len(fields) == 0 {
+		return false
+	}
+	_, err := exec.LookPath(fields[0])
+	return err == nil
+}
+
+func (p Picker) SelectBook(books []lib.Book) *lib.Book {
+	selected := p.SelectBooks(books)
+	if len(selected) == 0 {
+		return nil
+	}
+	return &selected[0]
+}
+
+// SelectBooks runs the picker and returns every book the user chose, or nil
+// if the picker was cancelled or failed.
+func (p Picker) SelectBooks(books []lib.Book) []lib.Book {
+	if len(books) == 0 {
+		fmt.Println("No books found.")
+		return nil
+	}
+
+	command := p.command()
+	if supportsFzfOptions(command) {
+		dir, err := writePreviews(books)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error preparing previews: %v\n", err)
+		} else {
+			defer os.RemoveAll(dir)
+			command += " " + fzfOptions(dir)
+		}
+	}
+
+	var input bytes.Buffer
+	for i, b := range books {
+		input.WriteString(pickerLine(i, b))
+		input.WriteByte('\n')
+	}
+
+	// The picker draws on the terminal itself and reads keys from /dev/tty.
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// fzf exits with 1 when nothing matched and 130 when cancelled.
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 && exitErr.ExitCode() != 130 {
+			fmt.Fprintf(os.Stderr, "Error running picker %q: %v\n", p.command(), err)
+		}
+		return nil
+	}
+
+	return parsePickerOutput(out, books)
+}
+
+func (p Picker) command() string {
+	if p.Command == "" {
+		return PickerCommand()
+	}
+	return p.Command
+}
+
+// pickerLine formats the book at index i as a tab-separated line whose first
+// field is the 1-based index used to map the selection back.
+func pickerLine(i int, b lib.Book) string {
+	fields := []string{
+		strconv.Itoa(i + 1),
+		titleCell(b),
+		oneLine(b.Authors),
+		yearCell(b),
+		b.Meta.Language,
+		oneLine(b.Size),
+		oneLine(b.Extension),
+	}
+	for i, f := range fields {
+		fields[i] = strings.ReplaceAll(f, "\t", " ")
+	}
+	return strings.Join(fields, "\t")
+}
+
+// parsePickerOutput maps the lines printed by the picker back to books,
+// ignoring lines that do not start with a known index.
+func parsePickerOutput(out []byte, books []lib.Book) []lib.Book {
+	var selected []lib.Book
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		field, _, _ := strings.Cut(scanner.Text(), "\t")
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > len(books) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		selected = append(selected, books[n-1])
+	}
+	return selected
+}
+
+// supportsFzfOptions reports whether command runs fzf or skim, which accept
+// the --delimiter, --with-nth and --preview options.
+func supportsFzfOptions(command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+	switch filepath.Base(fields[0]) {
+	case "fzf", "sk":
+		return true
+	}
+	return false
+}
+
+// fzfOptions hides the index field and previews the metadata file of the
+// highlighted book from dir.
+func fzfOptions(dir string) string {
+	preview := "cat " + shellQuote(dir) + "/{1}"
+	return "--delimiter='\\t' --with-nth=2.. --preview=" + shellQuote(preview) + " --preview-window=down,9,wrap"
+}
+
+// writePreviews writes the full metadata of each book to a file named after
+// its index in a new temporary directory, for the picker's preview pane.
+func writePreviews(books []lib.Book) (string, error) {
+	dir, err := os.MkdirTemp("", "toshi-picker-")
+	if err != nil {
+		return "", err
+	}
+
+	for i, b := range books {
+		var buf strings.Builder
+		for _, row := range detailRows(b) {
+			fmt.Fprintf(&buf, "%-11s %s\n", row[0], row[1])
+		}
+		if b.Edit != "" {
+			fmt.Fprintf(&buf, "%-11s %s\n", "Link:", b.Edit)
+		}
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(i+1)), []byte(buf.String()), 0o600); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// shellQuote quotes s for use as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
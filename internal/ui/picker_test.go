@@ -0,0 +1,77 @@
+package ui
+
+import (
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+func pickerBooks() []lib.Book {
+    return []lib.Book{
+        {ID: "1", Title: "The Iliad", Authors: "Homer", Year: "1998", Meta: lib.Metadata{Year: 1998}, Size: "1 Mb", Extension: "epub"},
+        {ID: "2", Title: "The\tOdyssey", Authors: "Homer", Year: "2003", Meta: lib.Metadata{Year: 2003}, Size: "2 Mb", Extension: "pdf"},
+        {ID: "3", Title: "Aeneid", Authors: "Virgil", Year: "1990", Meta: lib.Metadata{Year: 1990}, Size: "3 Mb", Extension: "epub"},
+    }
+}
+
+func TestPickerLine(t *testing.T) {
+    got := pickerLine(1, pickerBooks()[1])
+    want := "2\tThe Odyssey\tHomer\t2003\t\t2 Mb\tpdf"
+    if got != want {
+        t.Fatalf("pickerLine = %q, want %q", got, want)
+    }
+}
+
+func TestParsePickerOutput(t *testing.T) {
+    books := pickerBooks()
+    out := []byte("3\tAeneid\tVirgil\n\ngarbage\n1\tThe Iliad\n3\tAeneid\n9\tmissing\n")
+
+    selected := parsePickerOutput(out, books)
+    if len(selected) != 2 || selected[0].ID != "3" || selected[1].ID != "1" {
+        t.Fatalf("selected = %#v, want books 3 and 1", selected)
+    }
+}
+
+func TestPickerSelectBooks(t *testing.T) {
+    books := pickerBooks()
+
+    selected := Picker{Command: "grep -i homer"}.SelectBooks(books)
+    if len(selected) != 2 || selected[0].ID != "1" || selected[1].ID != "2" {
+        t.Fatalf("selected = %#v, want both Homer books", selected)
+    }
+
+    if b := (Picker{Command: "grep nothing-matches"}).SelectBook(books); b != nil {
+        t.Fatalf("SelectBook = %#v, want nil when the picker selects nothing", b)
+    }
+}
+
+func TestWritePreviews(t *testing.T) {
+    dir, err := writePreviews(pickerBooks())
+    if err != nil {
+        t.Fatalf("writePreviews error = %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    data, err := os.ReadFile(dir + "/3")
+    if err != nil {
+        t.Fatalf("reading preview: %v", err)
+    }
+    if !strings.Contains(string(data), "Aeneid") || !strings.Contains(string(data), "Virgil") {
+        t.Fatalf("preview = %q, want title and author", data)
+    }
+}
+
+func TestSupportsFzfOptions(t *testing.T) {
+    for command, want := range map[string]bool{
+        "fzf --multi":         true,
+        "/usr/local/bin/sk -m": true,
+        "peco":                false,
+        "":                    false,
+    } {
+        if got := supportsFzfOptions(command); got != want {
+            t.Errorf("supportsFzfOptions(%q) = %v, want %v", command, got, want)
+        }
+    }
+}
@@ -1,13 +1,111 @@
 package ui
 
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Color modes accepted by Configure.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
 // ANSI escape codes for text colors and styles
 const (
-	Reset         = "\033[0m"
-	Bold          = "\033[1m"
-	FgYellow      = "\033[33m"
-	FgMagenta     = "\033[35m"
-	FgRed         = "\033[31m"
-	FgBlue        = "\033[34m"
-	FgCyan        = "\033[36m"
-	FgBrightWhite = "\033[97m"
+	ansiReset       = "\033[0m"
+	ansiBold        = "\033[1m"
+	ansiReverse     = "\033[7m"
+	ansiBlack       = "\033[30m"
+	ansiRed         = "\033[31m"
+	ansiYellow      = "\033[33m"
+	ansiBlue        = "\033[34m"
+	ansiMagenta     = "\033[35m"
+	ansiCyan        = "\033[36m"
+	ansiBrightWhite = "\033[97m"
 )
+
+// Theme maps the roles of text in the interface to escape codes.
+type Theme struct {
+	Reset     string
+	Bold      string
+	Text      string // book details and headings
+	Heading   string // titles and table headers
+	Muted     string // dividers and field labels
+	Number    string // book numbers
+	Hint      string // navigation options
+	Alert     string // errors and the quit option
+	Highlight string // the selected row of the full-screen picker
+}
+
+// Themes lists the built-in palettes by name.
+var Themes = map[string]Theme{
+	"dark": {
+		Reset: ansiReset, Bold: ansiBold, Text: ansiBrightWhite, Heading: ansiCyan,
+		Muted: ansiBlue, Number: ansiYellow, Hint: ansiMagenta, Alert: ansiRed, Highlight: ansiReverse,
+	},
+	"light": {
+		Reset: ansiReset, Bold: ansiBold, Text: ansiBlack, Heading: ansiBlue,
+		Muted: ansiCyan, Number: ansiMagenta, Hint: ansiMagenta, Alert: ansiRed, Highlight: ansiReverse,
+	},
+}
+
+// plainTheme is used when colors are disabled. The picker still needs
+// reverse video to show the selected row.
+var plainTheme = Theme{Highlight: ansiReverse}
+
+// theme is the palette in use.
+var theme = Themes["dark"]
+
+// Configure selects the theme by name and disables colors according to
+// mode, NO_COLOR, TERM=dumb and whether stdout is a terminal.
+func Configure(mode, name string) error {
+	t, ok := Themes[name]
+	if !ok {
+		return fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+
+	enabled, err := colorEnabled(mode, term.IsTerminal(int(os.Stdout.Fd())))
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		t = plainTheme
+	}
+
+	theme = t
+	return nil
+}
+
+// colorEnabled decides whether to print colors. An explicit mode wins over
+// the environment; in auto mode colors need a terminal and are turned off by
+// a non-empty NO_COLOR or TERM=dumb.
+func colorEnabled(mode string, isTerminal bool) (bool, error) {
+	switch mode {
+	case ColorAlways:
+		return true, nil
+	case ColorNever:
+		return false, nil
+	case ColorAuto, "":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return isTerminal, nil
+	}
+	return false, fmt.Errorf("invalid color mode %q, expected %s, %s or %s", mode, ColorAuto, ColorAlways, ColorNever)
+}
+
+// ThemeNames returns the names of the built-in themes, sorted.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
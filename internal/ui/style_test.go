@@ -0,0 +1,61 @@
+package ui
+
+import "testing"
+
+func TestColorEnabled(t *testing.T) {
+    tests := []struct {
+        name       string
+        mode       string
+        noColor    string
+        term       string
+        isTerminal bool
+        want       bool
+    }{
+        {"auto on terminal", ColorAuto, "", "xterm", true, true},
+        {"auto redirected", ColorAuto, "", "xterm", false, false},
+        {"auto with NO_COLOR", ColorAuto, "1", "xterm", true, false},
+        {"auto on dumb terminal", ColorAuto, "", "dumb", true, false},
+        {"always redirected", ColorAlways, "1", "dumb", false, true},
+        {"never on terminal", ColorNever, "", "xterm", true, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv("NO_COLOR", tt.noColor)
+            t.Setenv("TERM", tt.term)
+            got, err := colorEnabled(tt.mode, tt.isTerminal)
+            if err != nil {
+                t.Fatalf("colorEnabled error = %v", err)
+            }
+            if got != tt.want {
+                t.Fatalf("colorEnabled(%q, %v) = %v, want %v", tt.mode, tt.isTerminal, got, tt.want)
+            }
+        })
+    }
+
+    if _, err := colorEnabled("sometimes", true); err == nil {
+        t.Fatal("expected error for unknown mode")
+    }
+}
+
+func TestConfigure(t *testing.T) {
+    defer func(saved Theme) { theme = saved }(theme)
+
+    if err := Configure(ColorAlways, "light"); err != nil {
+        t.Fatalf("Configure error = %v", err)
+    }
+    if theme != Themes["light"] {
+        t.Fatalf("theme = %#v, want light theme", theme)
+    }
+
+    if err := Configure(ColorNever, "dark"); err != nil {
+        t.Fatalf("Configure error = %v", err)
+    }
+    if theme.Text != "" || theme.Reset != "" {
+        t.Fatalf("theme = %#v, want no colors", theme)
+    }
+
+    if err := Configure(ColorAuto, "neon"); err == nil {
+        t.Fatal("expected error for unknown theme")
+    }
+}
@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+// Fixed widths of the narrow table columns.
+const (
+	indexColumnWidth  = 4
+	yearColumnWidth   = 4
+	langColumnWidth   = 4
+	sizeColumnWidth   = 8
+	formatColumnWidth = 6
+	columnGap         = 2
+
+	// minTitleWidth keeps titles readable on narrow terminals.
+	minTitleWidth = 10
+	// tableChromeLines are the header and option lines around the table.
+	tableChromeLines = 11
+)
+
+// Function to get the terminal height dynamically
+func getTerminalHeight() int {
+	_, height, err := term.GetSize(int(syscall.Stdout))
+	if err != nil {
+		return 24 // Fallback to a default height
+	}
+	return height
+}
+
+// tablePageSize returns how many one-line rows fit the terminal.
+func tablePageSize() int {
+	return max(getTerminalHeight()-tableChromeLines, booksPerPage)
+}
+
+// tableColumns holds the widths of the title and author columns, which
+// share the space left over by the fixed columns.
+type tableColumns struct {
+	title  int
+	author int
+}
+
+// layoutColumns sizes the title and author columns for a terminal of the
+// given width, giving the title roughly two thirds of the space.
+func layoutColumns(terminalWidth int) tableColumns {
+	fixed := yearColumnWidth + langColumnWidth + sizeColumnWidth + formatColumnWidth + 5*columnGap
+	flexible := max(terminalWidth-fixed, minTitleWidth+columnGap)
+	title := max(flexible*2/3, minTitleWidth)
+	return tableColumns{title: title, author: max(flexible-title, 0)}
+}
+
+// tableRow formats b as one line of the given column widths.
+func tableRow(b lib.Book, cols tableColumns) string {
+	return tableLine(cols, titleCell(b), oneLine(b.Authors), yearCell(b), b.Meta.Language, oneLine(b.Size), oneLine(b.Extension))
+}
+
+// tableLine lays out the cells of one row in the given column widths.
+func tableLine(cols tableColumns, title, author, year, lang, size, format string) string {
+	gap := strings.Repeat(" ", columnGap)
+	cells := []string{
+		padRight(title, cols.title),
+		padRight(author, cols.author),
+		padRight(year, yearColumnWidth),
+		padRight(lang, langColumnWidth),
+		padRight(size, sizeColumnWidth),
+		padRight(format, formatColumnWidth),
+	}
+	if cols.author == 0 {
+		cells = append(cells[:1], cells[2:]...)
+	}
+	return strings.Join(cells, gap)
+}
+
+// libraryMark prefixes the titles of books already in the library.
+const libraryMark = "✓ "
+
+// titleCell returns b's title on one line, marked if it is in the library.
+func titleCell(b lib.Book) string {
+	if b.InLibrary {
+		return libraryMark + oneLine(b.Title)
+	}
+	return oneLine(b.Title)
+}
+
+// yearCell returns b's parsed publication year, or an empty string if it is
+// unknown. The raw year may hold several years or other text.
+func yearCell(b lib.Book) string {
+	if b.Meta.Year == 0 {
+		return ""
+	}
+	return strconv.Itoa(b.Meta.Year)
+}
+
+// tableHeader returns the column titles laid out like tableRow.
+func tableHeader(cols tableColumns) string {
+	return tableLine(cols, "Title", "Author(s)", "Year", "Lang", "Size", "Format")
+}
+
+// Display a page of books as a table with one line per book
+func displayBooksTable(books []lib.Book, startIndex, pageSize int) {
+	terminalWidth := getTerminalWidth()
+	cols := layoutColumns(terminalWidth - indexColumnWidth - columnGap)
+	endIndex := min(startIndex+pageSize, len(books))
+
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+	fmt.Println(centered(fmt.Sprintf("Books %d to %d of %d", startIndex+1, endIndex, len(books)), terminalWidth, theme.Bold+theme.Text))
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+
+	fmt.Printf("%s%s%s\n", theme.Bold+theme.Heading, padRight("#", indexColumnWidth)+strings.Repeat(" ", columnGap)+tableHeader(cols), theme.Reset)
+	for i := startIndex; i < endIndex; i++ {
+		index := padRight(fmt.Sprintf("%d", i+1), indexColumnWidth)
+		fmt.Printf("%s%s%s%s%s\n", theme.Bold+theme.Number, index, theme.Reset, strings.Repeat(" ", columnGap), tableRow(books[i], cols))
+	}
+
+	fmt.Println(theme.Muted + strings.Repeat("=", terminalWidth) + theme.Reset)
+}
+
+// centered pads text with spaces to center it in width columns and wraps it
+// in style.
+func centered(text string, width int, style string) string {
+	padding := max((width-displayWidth(text))/2, 0)
+	return strings.Repeat(" ", padding) + style + text + theme.Reset
+}
+
+// runeWidth returns the number of terminal columns r occupies: zero for
+// combining marks and format characters, two for East Asian wide and
+// fullwidth characters, one otherwise.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal columns s occupies.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+// truncate shortens s to at most maxWidth terminal columns, ending in an
+// ellipsis if it was cut. Combining marks stay with their base character.
+func truncate(s string, maxWidth int) string {
+	if maxWidth <= 0 {
+		return ""
+	}
+	if displayWidth(s) <= maxWidth {
+		return s
+	}
+
+	var b strings.Builder
+	w := 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		if w+rw > maxWidth-1 {
+			break
+		}
+		b.WriteRune(r)
+		w += rw
+	}
+	return b.String() + "…"
+}
+
+// padRight truncates or pads s with spaces to exactly columns wide.
+func padRight(s string, columns int) string {
+	s = truncate(s, columns)
+	return s + strings.Repeat(" ", max(columns-displayWidth(s), 0))
+}
@@ -0,0 +1,81 @@
+package ui
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+func TestDisplayWidth(t *testing.T) {
+    cases := map[string]int{
+        "Iliad":        5,
+        "源氏物語":         8,
+        "Ｔｏｓｈｉ":        10,
+        "Cafe\u0301":   4, // combining acute accent
+        "":             0,
+    }
+    for in, want := range cases {
+        if got := displayWidth(in); got != want {
+            t.Fatalf("displayWidth(%q) = %d, want %d", in, got, want)
+        }
+    }
+}
+
+func TestTruncate(t *testing.T) {
+    cases := []struct {
+        in    string
+        width int
+        want  string
+    }{
+        {"The Iliad", 20, "The Iliad"},
+        {"The Iliad", 6, "The I…"},
+        {"源氏物語", 5, "源氏…"},
+        {"Café society", 5, "Café…"},
+        {"anything", 0, ""},
+    }
+    for _, tc := range cases {
+        if got := truncate(tc.in, tc.width); got != tc.want {
+            t.Fatalf("truncate(%q, %d) = %q, want %q", tc.in, tc.width, got, tc.want)
+        }
+        if got := displayWidth(truncate(tc.in, tc.width)); got > tc.width {
+            t.Fatalf("truncate(%q, %d) is %d columns wide", tc.in, tc.width, got)
+        }
+    }
+}
+
+func TestTableRow_FitsWidth(t *testing.T) {
+    b := lib.Book{
+        Title:     "源氏物語 The Tale of Genji, a very long title that has to be cut",
+        Authors:   "Murasaki Shikibu; Royall Tyler",
+        Year:      "2001",
+        Size:      "3 Mb",
+        Extension: "epub",
+        Meta:      lib.Metadata{Language: "en"},
+    }
+    for _, width := range []int{60, 80, 120, 200} {
+        row := tableRow(b, layoutColumns(width))
+        if got := displayWidth(row); got != width {
+            t.Fatalf("row width for terminal %d = %d: %q", width, got, row)
+        }
+        if !strings.Contains(row, "epub") {
+            t.Fatalf("row lost the format column: %q", row)
+        }
+    }
+}
+
+func TestTableRow_ShowsParsedYear(t *testing.T) {
+    b := lib.Book{Title: "Dubliners", Year: "2004; 2010", Meta: lib.Metadata{Year: 2004}}
+    cols := layoutColumns(80)
+    if row := tableRow(b, cols); !strings.Contains(row, "2004") || strings.Contains(row, "…") {
+        t.Fatalf("row = %q, want the parsed year", row)
+    }
+
+    b.Meta.Year = 0
+    if row := tableRow(b, cols); strings.Contains(row, "200") {
+        t.Fatalf("row = %q, want no year", row)
+    }
+    if line := pickerLine(0, b); line != "1\tDubliners\t\t\t\t\t" {
+        t.Fatalf("pickerLine = %q, want an empty year", line)
+    }
+}
@@ -0,0 +1,448 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/mfkd/toshi/internal/fuzzy"
+	"github.com/mfkd/toshi/internal/lib"
+)
+
+// Terminal control sequences used by the TUI.
+const (
+	altScreenOn  = "\033[?1049h"
+	altScreenOff = "\033[?1049l"
+	cursorHide   = "\033[?25l"
+	cursorShow   = "\033[?25h"
+	clearScreen  = "\033[H\033[2J"
+)
+
+// detailLines is the height of the detail pane below the table.
+const detailLines = 8
+
+// TUI selects a book in a full-screen terminal interface with keyboard
+// navigation, live filtering and sorting. Sort is the order the books are
+// given in; Query and Preferences rank results when sorting by relevance.
+// Fallback is used when the terminal cannot be put in raw mode.
+type TUI struct {
+	Query       string
+	Sort        string
+	Preferences lib.Preferences
+	Fallback    CLI
+}
+
+// Available reports whether stdin and stdout are terminals the TUI can use.
+// Dumb terminals cannot draw it.
+func (TUI) Available() bool {
+	return os.Getenv("TERM") != "dumb" && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func (t TUI) SelectBook(books []lib.Book) *lib.Book {
+	if len(books) == 0 {
+		fmt.Println("No books found.")
+		return nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return t.Fallback.SelectBook(books)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	restore := func() {
+		out.WriteString(cursorShow + altScreenOff)
+		out.Flush()
+		_ = term.Restore(fd, oldState)
+	}
+
+	// Restore the terminal if we are killed while in raw mode.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+	defer close(done)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			// The main loop may be writing to out, so bypass it.
+			_ = term.Restore(fd, oldState)
+			os.Stdout.WriteString(cursorShow + altScreenOff)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	defer restore()
+	out.WriteString(altScreenOn + cursorHide)
+
+	state := newTUIState(books, t.Query, t.Sort, t.Preferences)
+	// mu guards state and out, which are drawn from both the key loop and
+	// the resize handler.
+	var mu sync.Mutex
+	draw := func() {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		state.resize(height)
+		state.render(out, width)
+		out.Flush()
+	}
+
+	// Redraw as soon as the terminal is resized, not at the next key. The
+	// handler is stopped before the terminal is restored.
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	stopResize := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	defer func() {
+		signal.Stop(resized)
+		close(stopResize)
+		wg.Wait()
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-resized:
+				mu.Lock()
+				draw()
+				mu.Unlock()
+			case <-stopResize:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 64)
+	for {
+		mu.Lock()
+		draw()
+		mu.Unlock()
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil
+		}
+		mu.Lock()
+		for _, ev := range parseKeys(buf[:n]) {
+			if quit, selected := state.handle(ev); quit {
+				mu.Unlock()
+				return selected
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyInterrupt
+	keyUnknown
+)
+
+type keyEvent struct {
+	code keyCode
+	r    rune
+}
+
+// escapeSequences maps the terminal escape sequences toshi understands.
+var escapeSequences = map[string]keyCode{
+	"\033[A":  keyUp,
+	"\033[B":  keyDown,
+	"\033OA":  keyUp,
+	"\033OB":  keyDown,
+	"\033[5~": keyPageUp,
+	"\033[6~": keyPageDown,
+	"\033[H":  keyHome,
+	"\033[F":  keyEnd,
+	"\033[1~": keyHome,
+	"\033[4~": keyEnd,
+	"\033OH":  keyHome,
+	"\033OF":  keyEnd,
+}
+
+// parseKeys decodes one read from a raw-mode terminal into key events.
+func parseKeys(b []byte) []keyEvent {
+	var events []keyEvent
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			if len(b) == 1 {
+				return append(events, keyEvent{code: keyEscape})
+			}
+			matched := false
+			for seq, code := range escapeSequences {
+				if strings.HasPrefix(string(b), seq) {
+					events = append(events, keyEvent{code: code})
+					b = b[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// Unknown sequence: drop the rest of the read.
+				return append(events, keyEvent{code: keyUnknown})
+			}
+			continue
+		}
+
+		switch b[0] {
+		case '\r', '\n':
+			events = append(events, keyEvent{code: keyEnter})
+		case 0x7f, 0x08:
+			events = append(events, keyEvent{code: keyBackspace})
+		case 0x03:
+			events = append(events, keyEvent{code: keyInterrupt})
+		case 0x06:
+			events = append(events, keyEvent{code: keyPageDown})
+		case 0x02:
+			events = append(events, keyEvent{code: keyPageUp})
+		default:
+			r, size := utf8.DecodeRune(b)
+			events = append(events, keyEvent{code: keyRune, r: r})
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return events
+}
+
+// tuiState holds what the TUI shows and reacts to key events. It does no
+// terminal IO so it can be driven in tests.
+type tuiState struct {
+	all       []lib.Book
+	view      []lib.Book
+	query     string
+	prefs     lib.Preferences
+	sortIndex int
+	filter    string
+	filtering bool
+	cursor    int
+	offset    int
+	rows      int
+}
+
+func newTUIState(books []lib.Book, query, sortKey string, prefs lib.Preferences) *tuiState {
+	s := &tuiState{all: books, query: query, prefs: prefs, rows: 10}
+	if i := slices.Index(lib.SortKeys, sortKey); i >= 0 {
+		s.sortIndex = i
+	}
+	s.refresh()
+	return s
+}
+
+// resize sets the number of table rows that fit a terminal of height lines.
+func (s *tuiState) resize(height int) {
+	s.rows = max(height-detailLines-4, 1)
+	s.scroll()
+}
+
+// refresh recomputes the visible books from the filter and sort key.
+func (s *tuiState) refresh() {
+	s.view = s.view[:0]
+	for _, b := range s.all {
+		if s.filter == "" || fuzzy.Contains(b.Title+" "+b.Authors+" "+b.Publisher+" "+b.Year+" "+b.Extension, s.filter) {
+			s.view = append(s.view, b)
+		}
+	}
+	_ = lib.SortBooks(s.view, lib.SortKeys[s.sortIndex], s.query, s.prefs)
+	s.cursor = 0
+	s.offset = 0
+}
+
+func (s *tuiState) move(delta int) {
+	s.cursor = min(max(s.cursor+delta, 0), max(len(s.view)-1, 0))
+	s.scroll()
+}
+
+// scroll keeps the cursor inside the visible window.
+func (s *tuiState) scroll() {
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+s.rows {
+		s.offset = s.cursor - s.rows + 1
+	}
+}
+
+// handle applies a key event. It returns quit=true with the selected book,
+// or nil if the user left without choosing.
+func (s *tuiState) handle(ev keyEvent) (quit bool, selected *lib.Book) {
+	switch ev.code {
+	case keyInterrupt:
+		return true, nil
+	case keyUp:
+		s.move(-1)
+	case keyDown:
+		s.move(1)
+	case keyPageUp:
+		s.move(-s.rows)
+	case keyPageDown:
+		s.move(s.rows)
+	case keyHome:
+		s.move(-len(s.view))
+	case keyEnd:
+		s.move(len(s.view))
+	case keyEnter:
+		if s.filtering {
+			s.filtering = false
+			return false, nil
+		}
+		if len(s.view) > 0 {
+			b := s.view[s.cursor]
+			return true, &b
+		}
+	case keyEscape:
+		if s.filtering || s.filter != "" {
+			s.filtering = false
+			s.filter = ""
+			s.refresh()
+			return false, nil
+		}
+		return true, nil
+	case keyBackspace:
+		if s.filtering && s.filter != "" {
+			_, size := utf8.DecodeLastRuneInString(s.filter)
+			s.filter = s.filter[:len(s.filter)-size]
+			s.refresh()
+		}
+	case keyRune:
+		if s.filtering {
+			if unicode.IsPrint(ev.r) {
+				s.filter += string(ev.r)
+				s.refresh()
+			}
+			return false, nil
+		}
+		return s.command(ev.r)
+	}
+	return false, nil
+}
+
+// command handles a key pressed outside filter mode.
+func (s *tuiState) command(r rune) (bool, *lib.Book) {
+	switch r {
+	case 'q':
+		return true, nil
+	case 'j':
+		s.move(1)
+	case 'k':
+		s.move(-1)
+	case 'g':
+		s.move(-len(s.view))
+	case 'G':
+		s.move(len(s.view))
+	case '/':
+		s.filtering = true
+	case 's':
+		s.sortIndex = (s.sortIndex + 1) % len(lib.SortKeys)
+		s.refresh()
+	case 'S':
+		s.sortIndex = (s.sortIndex + len(lib.SortKeys) - 1) % len(lib.SortKeys)
+		s.refresh()
+	}
+	return false, nil
+}
+
+// render draws the header, table, detail pane and key help.
+func (s *tuiState) render(w *bufio.Writer, width int) {
+	w.WriteString(clearScreen)
+
+	header := fmt.Sprintf(" toshi: %q  %d/%d books  sort: %s", s.query, len(s.view), len(s.all), lib.SortKeys[s.sortIndex])
+	if s.filtering || s.filter != "" {
+		header += "  filter: " + s.filter
+		if s.filtering {
+			header += "_"
+		}
+	}
+	writeLine(w, theme.Bold+theme.Text+truncate(header, width)+theme.Reset)
+
+	cols := layoutColumns(width)
+	writeLine(w, theme.Heading+truncate(tableHeader(cols), width)+theme.Reset)
+	for i := s.offset; i < s.offset+s.rows; i++ {
+		if i >= len(s.view) {
+			writeLine(w, "")
+			continue
+		}
+		line := padRight(tableRow(s.view[i], cols), width)
+		if i == s.cursor {
+			// The plain theme keeps reverse video but has no reset of its
+			// own, so always close the highlight.
+			line = theme.Highlight + line + ansiReset
+		}
+		writeLine(w, line)
+	}
+
+	writeLine(w, theme.Muted+strings.Repeat("─", width)+theme.Reset)
+	var details [][2]string
+	if len(s.view) > 0 {
+		details = detailRows(s.view[s.cursor])
+	}
+	for i := 0; i < detailLines; i++ {
+		if i < len(details) {
+			label := fmt.Sprintf("%-11s", details[i][0])
+			writeLine(w, theme.Heading+label+theme.Reset+" "+truncate(details[i][1], width-len(label)-1))
+		} else {
+			writeLine(w, "")
+		}
+	}
+
+	help := "↑/↓ j/k move  PgUp/PgDn  g/G top/bottom  / filter  s/S sort  Enter select  q quit"
+	if s.filtering {
+		help = "type to filter  Backspace delete  Enter keep filter  Esc clear"
+	}
+	w.WriteString(theme.Hint + truncate(help, width) + theme.Reset)
+}
+
+func writeLine(w *bufio.Writer, s string) {
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// detailRows lists the labels and values of b's non-empty fields for the
+// detail pane.
+func detailRows(b lib.Book) [][2]string {
+	var rows [][2]string
+	add := func(label, value string) {
+		if value = oneLine(value); value != "" {
+			rows = append(rows, [2]string{label, value})
+		}
+	}
+	add("Title:", b.Title)
+	add("Author(s):", b.Authors)
+	add("Publisher:", b.Publisher)
+	add("Year:", b.Year)
+	add("Pages:", b.Pages)
+	add("Language:", b.Language)
+	add("Size:", b.Size+" "+b.Extension)
+	add("ISBN(s):", strings.Join(b.ISBN, ", "))
+	add("Source:", b.Source)
+	if b.InLibrary {
+		add("Library:", "already in library")
+	}
+	return rows
+}
@@ -0,0 +1,135 @@
+package ui
+
+import (
+    "bufio"
+    "strings"
+    "testing"
+
+    "github.com/mfkd/toshi/internal/lib"
+)
+
+func TestParseKeys(t *testing.T) {
+    events := parseKeys([]byte("j\033[B\033[6~/é\r\033"))
+    want := []keyEvent{
+        {code: keyRune, r: 'j'},
+        {code: keyDown},
+        {code: keyPageDown},
+        {code: keyRune, r: '/'},
+        {code: keyRune, r: 'é'},
+        {code: keyEnter},
+        {code: keyEscape},
+    }
+    if len(events) != len(want) {
+        t.Fatalf("parseKeys = %#v, want %#v", events, want)
+    }
+    for i := range want {
+        if events[i] != want[i] {
+            t.Fatalf("event %d = %#v, want %#v", i, events[i], want[i])
+        }
+    }
+}
+
+func press(s *tuiState, keys string) (bool, *lib.Book) {
+    for _, ev := range parseKeys([]byte(keys)) {
+        if quit, b := s.handle(ev); quit {
+            return quit, b
+        }
+    }
+    return false, nil
+}
+
+func TestTUIState_NavigateAndSelect(t *testing.T) {
+    books := []lib.Book{{Title: "A"}, {Title: "B"}, {Title: "C"}, {Title: "D"}}
+    s := newTUIState(books, "", lib.SortNone, lib.Preferences{})
+    s.resize(detailLines + 4 + 2) // two table rows
+
+    press(s, "jjj")
+    if s.cursor != 3 || s.offset != 2 {
+        t.Fatalf("cursor=%d offset=%d, want 3 and 2", s.cursor, s.offset)
+    }
+    press(s, "g")
+    if s.cursor != 0 || s.offset != 0 {
+        t.Fatalf("after g cursor=%d offset=%d", s.cursor, s.offset)
+    }
+    quit, b := press(s, "\033[B\r")
+    if !quit || b == nil || b.Title != "B" {
+        t.Fatalf("select = %v, %#v", quit, b)
+    }
+}
+
+func TestTUIState_FilterAndSort(t *testing.T) {
+    books := []lib.Book{
+        {Title: "Der Prozeß", Authors: "Kafka", Meta: lib.Metadata{Year: 1925}},
+        {Title: "Das Schloss", Authors: "Kafka", Meta: lib.Metadata{Year: 1926}},
+        {Title: "Anna Karenina", Authors: "Tolstoy", Meta: lib.Metadata{Year: 1878}},
+    }
+    s := newTUIState(books, "", lib.SortNone, lib.Preferences{})
+
+    press(s, "/kafka")
+    if len(s.view) != 2 || !s.filtering {
+        t.Fatalf("filter view = %d books, filtering=%v", len(s.view), s.filtering)
+    }
+    press(s, "\r")
+    if s.filtering || s.filter != "kafka" {
+        t.Fatalf("enter should keep filter, got %q filtering=%v", s.filter, s.filtering)
+    }
+
+    s.sortIndex = 0
+    press(s, "s") // relevance -> year
+    if lib.SortKeys[s.sortIndex] != lib.SortYear || s.view[0].Title != "Das Schloss" {
+        t.Fatalf("sort = %s, first = %s", lib.SortKeys[s.sortIndex], s.view[0].Title)
+    }
+
+    press(s, "\033")
+    if s.filter != "" || len(s.view) != 3 {
+        t.Fatalf("escape should clear filter, got %q with %d books", s.filter, len(s.view))
+    }
+    if quit, b := press(s, "q"); !quit || b != nil {
+        t.Fatalf("q = %v, %#v", quit, b)
+    }
+}
+
+func TestTUIState_RenderClosesHighlightWithoutColors(t *testing.T) {
+    defer func(saved Theme) { theme = saved }(theme)
+    t.Setenv("NO_COLOR", "1")
+    if err := Configure(ColorAuto, "dark"); err != nil {
+        t.Fatalf("Configure error = %v", err)
+    }
+
+    books := []lib.Book{{Title: "A"}, {Title: "B"}}
+    s := newTUIState(books, "", lib.SortNone, lib.Preferences{})
+    s.resize(detailLines + 4 + 2)
+
+    var sb strings.Builder
+    w := bufio.NewWriter(&sb)
+    s.render(w, 80)
+    w.Flush()
+
+    out := sb.String()
+    start := strings.Index(out, ansiReverse)
+    if start < 0 {
+        t.Fatalf("render did not highlight the cursor row:\n%q", out)
+    }
+    rest := out[start:]
+    end := strings.Index(rest, ansiReset)
+    if end < 0 || strings.Contains(rest[:end], "\n") {
+        t.Fatalf("highlight is not closed on the cursor row:\n%q", rest)
+    }
+    if strings.Count(out, ansiReverse) != 1 {
+        t.Fatalf("render highlighted %d rows, want 1", strings.Count(out, ansiReverse))
+    }
+}
+
+func TestTUIState_SortNoneRestoresSourceOrder(t *testing.T) {
+    // Ranked by relevance before they reach the TUI.
+    books := []lib.Book{{Title: "B", Position: 2}, {Title: "C", Position: 3}, {Title: "A", Position: 1}}
+    s := newTUIState(books, "", lib.SortRelevance, lib.Preferences{})
+
+    press(s, "S") // relevance -> none
+    if lib.SortKeys[s.sortIndex] != lib.SortNone {
+        t.Fatalf("sort = %s, want none", lib.SortKeys[s.sortIndex])
+    }
+    if s.view[0].Title != "A" || s.view[1].Title != "B" || s.view[2].Title != "C" {
+        t.Fatalf("view = %v, want source order A B C", s.view)
+    }
+}